@@ -2,10 +2,25 @@ package blades
 
 import (
 	"context"
+	"errors"
+	"fmt"
+)
+
+// defaultMaxIterations is the default number of model calls allowed for a single run.
+const defaultMaxIterations = 3
+
+var (
+	_ Runner      = (*Agent)(nil)
+	_ EventRunner = (*Agent)(nil)
 )
 
 var (
-	_ Runner = (*Agent)(nil)
+	// ErrToolNotFound indicates the model requested a tool that is not registered on the agent.
+	ErrToolNotFound = errors.New("tool not found")
+	// ErrMaxIterationsExceeded indicates the model kept requesting tools after MaxIterations calls.
+	ErrMaxIterationsExceeded = errors.New("max iterations exceeded")
+	// ErrNoGeneration indicates the model stream ended without yielding any generation.
+	ErrNoGeneration = errors.New("no generation")
 )
 
 // Option is an option for configuring the Agent.
@@ -46,6 +61,47 @@ func WithMemory(m Memory) Option {
 	}
 }
 
+// WithContextWindow sets the context window of the model in tokens. When set, the oldest
+// memory history is dropped so that the request leaves room for MaxOutputTokens.
+func WithContextWindow(tokens int) Option {
+	return func(a *Agent) {
+		a.contextWindow = tokens
+	}
+}
+
+// WithTokenizer sets the tokenizer used to fit the history into the context window,
+// the default is EstimateTokens.
+func WithTokenizer(tokenizer Tokenizer) Option {
+	return func(a *Agent) {
+		a.tokenizer = tokenizer
+	}
+}
+
+// ReasoningPolicy controls whether the reasoning of the model is stored in memory.
+type ReasoningPolicy int
+
+const (
+	// KeepReasoning stores reasoning parts in memory alongside the answer, this is the default.
+	KeepReasoning ReasoningPolicy = iota
+	// DropReasoning removes reasoning parts from the messages stored in memory. Reasoning is
+	// still returned to the caller and sent back to the model within the same run.
+	DropReasoning
+)
+
+// WithReasoningPolicy sets whether the reasoning of the model is stored in memory.
+func WithReasoningPolicy(policy ReasoningPolicy) Option {
+	return func(a *Agent) {
+		a.reasoningPolicy = policy
+	}
+}
+
+// WithPricing sets the pricing used to compute the cost of every model call from its usage.
+func WithPricing(pricing Pricing) Option {
+	return func(a *Agent) {
+		a.pricing = pricing
+	}
+}
+
 // WithMiddleware sets the middleware for the Agent.
 func WithMiddleware(m Middleware) Option {
 	return func(a *Agent) {
@@ -55,13 +111,17 @@ func WithMiddleware(m Middleware) Option {
 
 // Agent is a struct that represents an AI agent.
 type Agent struct {
-	name         string
-	model        string
-	instructions string
-	middleware   Middleware
-	provider     ModelProvider
-	memory       Memory
-	tools        []*Tool
+	name            string
+	model           string
+	instructions    string
+	middleware      Middleware
+	provider        ModelProvider
+	memory          Memory
+	tools           []*Tool
+	contextWindow   int
+	tokenizer       Tokenizer
+	reasoningPolicy ReasoningPolicy
+	pricing         Pricing
 }
 
 // NewAgent creates a new Agent with the given name and options.
@@ -69,6 +129,7 @@ func NewAgent(name string, opts ...Option) *Agent {
 	a := &Agent{
 		name:       name,
 		middleware: func(h Handler) Handler { return h },
+		tokenizer:  TokenizerFunc(EstimateTokens),
 	}
 	for _, opt := range opts {
 		opt(a)
@@ -76,6 +137,22 @@ func NewAgent(name string, opts ...Option) *Agent {
 	return a
 }
 
+// Name returns the name of the Agent.
+func (a *Agent) Name() string {
+	return a.name
+}
+
+// SupportsResponseFormat reports whether the provider of the Agent honors the ResponseFormat
+// of the model options.
+func (a *Agent) SupportsResponseFormat() bool {
+	return SupportsResponseFormat(a.provider)
+}
+
+// KeepsConversation reports whether the Agent has a memory storing its conversations.
+func (a *Agent) KeepsConversation() bool {
+	return a.memory != nil
+}
+
 func (a *Agent) buildContext(ctx context.Context) context.Context {
 	return NewContext(ctx, &AgentContext{
 		Model:        a.model,
@@ -84,7 +161,8 @@ func (a *Agent) buildContext(ctx context.Context) context.Context {
 }
 
 // buildRequest builds the request for the Agent by combining system instructions and user messages.
-func (a *Agent) buildRequest(ctx context.Context, prompt *Prompt) (*ModelRequest, error) {
+// With a context window, the memory history is trimmed to fit.
+func (a *Agent) buildRequest(ctx context.Context, prompt *Prompt, opts ...ModelOption) (*ModelRequest, error) {
 	req := ModelRequest{Model: a.model, Tools: a.tools}
 	// system messages
 	if a.instructions != "" {
@@ -96,6 +174,9 @@ func (a *Agent) buildRequest(ctx context.Context, prompt *Prompt) (*ModelRequest
 		if err != nil {
 			return nil, err
 		}
+		if history, err = a.fitHistory(req.Messages, history, prompt, opts...); err != nil {
+			return nil, err
+		}
 		req.Messages = append(req.Messages, history...)
 	}
 	// user messages
@@ -105,41 +186,299 @@ func (a *Agent) buildRequest(ctx context.Context, prompt *Prompt) (*ModelRequest
 	return &req, nil
 }
 
-func (a *Agent) addMemory(ctx context.Context, prompt *Prompt, res *ModelResponse) error {
+// fitHistory trims the history so that the request fits the context window minus the
+// MaxOutputTokens headroom.
+func (a *Agent) fitHistory(system, history []*Message, prompt *Prompt, opts ...ModelOption) ([]*Message, error) {
+	if a.contextWindow <= 0 {
+		return history, nil
+	}
+	opt := ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	required := make([]*Message, 0, len(system)+len(prompt.Messages))
+	required = append(required, system...)
+	required = append(required, prompt.Messages...)
+	return fitHistory(a.tokenizer, a.contextWindow-int(opt.MaxOutputTokens), required, history)
+}
+
+func (a *Agent) addMemory(ctx context.Context, prompt *Prompt, messages []*Message) error {
 	if a.memory != nil {
-		messages := make([]*Message, 0, len(prompt.Messages)+1)
-		messages = append(messages, prompt.Messages...)
-		messages = append(messages, res.Messages...)
-		if err := a.memory.AddMessages(ctx, prompt.ConversationID, messages); err != nil {
+		history := make([]*Message, 0, len(prompt.Messages)+len(messages))
+		history = append(history, prompt.Messages...)
+		if a.reasoningPolicy == DropReasoning {
+			messages = withoutReasoning(messages)
+		}
+		history = append(history, messages...)
+		if err := a.memory.AddMessages(ctx, prompt.ConversationID, history); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// withoutReasoning returns copies of the messages without their reasoning parts, messages
+// left with neither parts nor tool calls are omitted.
+func withoutReasoning(messages []*Message) []*Message {
+	out := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		parts := make([]Part, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			if _, ok := part.(ReasoningPart); !ok {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == len(msg.Parts) {
+			out = append(out, msg)
+			continue
+		}
+		if len(parts) == 0 && len(msg.ToolCalls) == 0 {
+			continue
+		}
+		stripped := *msg
+		stripped.Parts = parts
+		out = append(out, &stripped)
+	}
+	return out
+}
+
+// maxIterations returns the maximum number of model calls allowed for a single run.
+func (a *Agent) maxIterations(opts ...ModelOption) int {
+	opt := ModelOptions{MaxIterations: defaultMaxIterations}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	return opt.MaxIterations
+}
+
 // Run runs the agent with the given prompt and options, returning the response message.
+// When the model requests tool calls, the tools are executed and their results are fed
+// back to the model until it produces a final answer or MaxIterations is reached.
 func (a *Agent) Run(ctx context.Context, prompt *Prompt, opts ...ModelOption) (*Generation, error) {
-	req, err := a.buildRequest(ctx, prompt)
+	req, err := a.buildRequest(ctx, prompt, opts...)
 	if err != nil {
 		return nil, err
 	}
 	ctx = a.buildContext(ctx)
-	handler := a.middleware(a.handler(req))
-	return handler.Run(ctx, prompt, opts...)
+	var (
+		turn  []*Message
+		usage *Usage
+	)
+	for i := 0; i < a.maxIterations(opts...); i++ {
+		handler := a.middleware(a.handler(req))
+		res, err := handler.Run(ctx, prompt, opts...)
+		if err != nil {
+			return nil, err
+		}
+		turn = append(turn, res.Messages...)
+		usage = SumUsage(usage, res.Usage)
+		calls := toolCalls(res.Messages)
+		if len(calls) == 0 {
+			if err := a.addMemory(ctx, prompt, turn); err != nil {
+				return nil, err
+			}
+			return withUsage(res, usage), nil
+		}
+		toolMessage, err := a.callTools(ctx, calls, nil)
+		if err != nil {
+			return nil, err
+		}
+		turn = append(turn, toolMessage)
+		req.Messages = append(req.Messages, res.Messages...)
+		req.Messages = append(req.Messages, toolMessage)
+	}
+	return nil, ErrMaxIterationsExceeded
 }
 
 // RunStream runs the agent with the given prompt and options, returning a streamable response.
+// Each model iteration is streamed, followed by a tool message carrying the tool results
+// whenever the model requests tool calls. The completed generation of each iteration carries
+// the usage of the run so far.
 func (a *Agent) RunStream(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[*Generation], error) {
-	req, err := a.buildRequest(ctx, prompt)
+	pipe := NewStreamPipe[*Generation]()
+	run, err := a.stream(ctx, prompt, pipe.Send, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe.Go(func() error {
+		_, err := run()
+		return err
+	})
+	return pipe, nil
+}
+
+// RunEvents runs the agent like RunStream and reports it as typed events: text and reasoning
+// deltas of every model iteration, the start and end of every tool call, and the completion.
+func (a *Agent) RunEvents(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[*RunEvent], error) {
+	pipe := NewStreamPipe[*RunEvent]()
+	events := &eventWriter{send: pipe.Send}
+	run, err := a.stream(ctx, prompt, events.generation, events.toolCall, opts...)
 	if err != nil {
 		return nil, err
 	}
+	pipe.Go(func() error {
+		last, err := run()
+		if err != nil {
+			return err
+		}
+		events.completed(last)
+		return nil
+	})
+	return pipe, nil
+}
+
+// stream starts the first model iteration and returns a function that runs the tool loop
+// to completion, returning the completed generation of the final iteration. Every streamed
+// generation and tool message is passed to onGeneration, and every tool call to onToolCall.
+func (a *Agent) stream(ctx context.Context, prompt *Prompt, onGeneration func(*Generation), onToolCall func(EventKind, *ToolCall), opts ...ModelOption) (func() (*Generation, error), error) {
+	req, err := a.buildRequest(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	iterations := a.maxIterations(opts...)
+	if iterations < 1 {
+		return nil, ErrMaxIterationsExceeded
+	}
 	ctx = a.buildContext(ctx)
 	handler := a.middleware(a.handler(req))
-	return handler.Stream(ctx, prompt, opts...)
+	stream, err := handler.Stream(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return func() (*Generation, error) {
+		var (
+			turn  []*Message
+			usage *Usage
+		)
+		for i := 1; ; i++ {
+			last, err := a.forward(onGeneration, stream)
+			if err != nil {
+				return nil, err
+			}
+			if last == nil {
+				return nil, ErrNoGeneration
+			}
+			usage = SumUsage(usage, last.Usage)
+			last = withUsage(last, usage)
+			onGeneration(last)
+			turn = append(turn, last.Messages...)
+			calls := toolCalls(last.Messages)
+			if len(calls) == 0 {
+				if err := a.addMemory(ctx, prompt, turn); err != nil {
+					return nil, err
+				}
+				return last, nil
+			}
+			if i >= iterations {
+				return nil, ErrMaxIterationsExceeded
+			}
+			toolMessage, err := a.callTools(ctx, calls, onToolCall)
+			if err != nil {
+				return nil, err
+			}
+			onGeneration(&Generation{Messages: []*Message{toolMessage}})
+			turn = append(turn, toolMessage)
+			req.Messages = append(req.Messages, last.Messages...)
+			req.Messages = append(req.Messages, toolMessage)
+			handler := a.middleware(a.handler(req))
+			if stream, err = handler.Stream(ctx, prompt, opts...); err != nil {
+				return nil, err
+			}
+		}
+	}, nil
+}
+
+// forward passes every generation of the stream but the last to onGeneration and returns the
+// last one, which providers emit as the completed message of the iteration.
+func (a *Agent) forward(onGeneration func(*Generation), stream Streamer[*Generation]) (*Generation, error) {
+	defer stream.Close()
+	var last *Generation
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			onGeneration(last)
+		}
+		last = gen
+	}
+	return last, nil
+}
+
+// withUsage returns a shallow copy of the generation carrying the usage.
+func withUsage(gen *Generation, usage *Usage) *Generation {
+	out := *gen
+	out.Usage = usage
+	return &out
+}
+
+// priced returns a copy of the usage of a model call with its cost set by the pricing.
+func (a *Agent) priced(model string, usage *Usage) *Usage {
+	if usage == nil || a.pricing == nil {
+		return usage
+	}
+	out := *usage
+	out.Cost = a.pricing.Cost(model, usage)
+	return &out
 }
 
-// handler constructs the default handlers for Run and Stream using the provider.
+// callTools executes the requested tool calls and returns a tool message with their results.
+// onToolCall, when set, observes each call before and after it is executed.
+func (a *Agent) callTools(ctx context.Context, calls []*ToolCall, onToolCall func(EventKind, *ToolCall)) (*Message, error) {
+	msg := &Message{
+		ID:     NewMessageID(),
+		Role:   RoleTool,
+		Status: StatusCompleted,
+	}
+	for _, call := range calls {
+		tool, ok := a.findTool(call.Name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrToolNotFound, call.Name)
+		}
+		if onToolCall != nil {
+			onToolCall(EventToolCallStart, call)
+		}
+		result, err := tool.Handle(ctx, call.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		done := &ToolCall{
+			ID:        call.ID,
+			Name:      call.Name,
+			Arguments: call.Arguments,
+			Result:    result,
+		}
+		if onToolCall != nil {
+			onToolCall(EventToolCallEnd, done)
+		}
+		msg.ToolCalls = append(msg.ToolCalls, done)
+	}
+	return msg, nil
+}
+
+// findTool looks up a tool by name.
+func (a *Agent) findTool(name string) (*Tool, bool) {
+	for _, tool := range a.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return nil, false
+}
+
+// toolCalls collects the tool calls requested by the assistant messages.
+func toolCalls(messages []*Message) []*ToolCall {
+	var calls []*ToolCall
+	for _, msg := range messages {
+		if msg.Role == RoleAssistant {
+			calls = append(calls, msg.ToolCalls...)
+		}
+	}
+	return calls
+}
+
+// handler constructs the default handlers for a single model iteration using the provider.
 func (a *Agent) handler(req *ModelRequest) Handler {
 	return Handler{
 		Run: func(ctx context.Context, p *Prompt, opts ...ModelOption) (*Generation, error) {
@@ -147,10 +486,7 @@ func (a *Agent) handler(req *ModelRequest) Handler {
 			if err != nil {
 				return nil, err
 			}
-			if err := a.addMemory(ctx, p, res); err != nil {
-				return nil, err
-			}
-			return &Generation{res.Messages}, nil
+			return &Generation{Messages: res.Messages, Usage: a.priced(req.Model, res.Usage)}, nil
 		},
 		Stream: func(ctx context.Context, p *Prompt, opts ...ModelOption) (Streamer[*Generation], error) {
 			stream, err := a.provider.NewStream(ctx, req, opts...)
@@ -158,10 +494,7 @@ func (a *Agent) handler(req *ModelRequest) Handler {
 				return nil, err
 			}
 			return NewMappedStream[*ModelResponse, *Generation](stream, func(m *ModelResponse) (*Generation, error) {
-				if err := a.addMemory(ctx, p, m); err != nil {
-					return nil, err
-				}
-				return &Generation{m.Messages}, nil
+				return &Generation{Messages: m.Messages, Usage: a.priced(req.Model, m.Usage)}, nil
 			}), nil
 		},
 	}
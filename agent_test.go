@@ -0,0 +1,243 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// scriptedProvider returns the queued responses in order and records each request.
+type scriptedProvider struct {
+	responses []*ModelResponse
+	requests  []*ModelRequest
+}
+
+func (p *scriptedProvider) next(req *ModelRequest) (*ModelResponse, error) {
+	snapshot := *req
+	snapshot.Messages = append([]*Message(nil), req.Messages...)
+	p.requests = append(p.requests, &snapshot)
+	if len(p.responses) == 0 {
+		return nil, errors.New("no scripted response")
+	}
+	res := p.responses[0]
+	p.responses = p.responses[1:]
+	return res, nil
+}
+
+func (p *scriptedProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	return p.next(req)
+}
+
+func (p *scriptedProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	res, err := p.next(req)
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Send(res)
+	pipe.Close()
+	return pipe, nil
+}
+
+func toolCallResponse(name string) *ModelResponse {
+	return &ModelResponse{Messages: []*Message{{
+		Role:      RoleAssistant,
+		Status:    StatusCompleted,
+		ToolCalls: []*ToolCall{{ID: "call_" + name, Name: name, Arguments: `{}`}},
+	}}}
+}
+
+func textResponse(text string) *ModelResponse {
+	msg := AssistantMessage(text)
+	msg.Status = StatusCompleted
+	return &ModelResponse{Messages: []*Message{msg}}
+}
+
+func weatherTool() *Tool {
+	return &Tool{
+		Name: "get_weather",
+		Handle: func(ctx context.Context, args string) (string, error) {
+			return "Sunny", nil
+		},
+	}
+}
+
+func TestAgentRunToolLoop(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		toolCallResponse("get_weather"),
+		textResponse("It is sunny."),
+	}}
+	var iterations int
+	agent := NewAgent("weather",
+		WithProvider(provider),
+		WithTools(weatherTool()),
+		WithMiddleware(Unary(func(next RunHandler) RunHandler {
+			return func(ctx context.Context, p *Prompt, opts ...ModelOption) (*Generation, error) {
+				iterations++
+				return next(ctx, p, opts...)
+			}
+		})),
+	)
+	res, err := agent.Run(context.Background(), NewPrompt(UserMessage("weather?")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Text() != "It is sunny." {
+		t.Errorf("Run() text = %q, want %q", res.Text(), "It is sunny.")
+	}
+	if iterations != 2 {
+		t.Errorf("middleware observed %d iterations, want 2", iterations)
+	}
+	if len(provider.requests) != 2 {
+		t.Fatalf("provider received %d requests, want 2", len(provider.requests))
+	}
+	second := provider.requests[1].Messages
+	if len(second) != 3 {
+		t.Fatalf("second request has %d messages, want 3", len(second))
+	}
+	if tool := second[2]; tool.Role != RoleTool || tool.ToolCalls[0].Result != "Sunny" {
+		t.Errorf("second request tool message = %+v", tool)
+	}
+}
+
+func TestAgentRunStreamToolLoop(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		toolCallResponse("get_weather"),
+		textResponse("It is sunny."),
+	}}
+	agent := NewAgent("weather", WithProvider(provider), WithTools(weatherTool()))
+	stream, err := agent.RunStream(context.Background(), NewPrompt(UserMessage("weather?")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var roles []Role
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		roles = append(roles, gen.Messages[0].Role)
+	}
+	want := []Role{RoleAssistant, RoleTool, RoleAssistant}
+	if len(roles) != len(want) {
+		t.Fatalf("RunStream() yielded roles %v, want %v", roles, want)
+	}
+	for i := range want {
+		if roles[i] != want[i] {
+			t.Errorf("RunStream() yielded roles %v, want %v", roles, want)
+		}
+	}
+}
+
+func TestAgentRunErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []*ModelResponse
+		tools     []*Tool
+		want      error
+	}{
+		{
+			name:      "max iterations exceeded",
+			responses: []*ModelResponse{toolCallResponse("get_weather"), toolCallResponse("get_weather")},
+			tools:     []*Tool{weatherTool()},
+			want:      ErrMaxIterationsExceeded,
+		},
+		{
+			name:      "tool not found",
+			responses: []*ModelResponse{toolCallResponse("unknown")},
+			tools:     []*Tool{weatherTool()},
+			want:      ErrToolNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			agent := NewAgent("weather", WithProvider(&scriptedProvider{responses: tt.responses}), WithTools(tt.tools...))
+			_, err := agent.Run(context.Background(), NewPrompt(UserMessage("weather?")), MaxIterations(2))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Run() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgentReasoningPolicy(t *testing.T) {
+	answer := func() *ModelResponse {
+		res := textResponse("It is sunny.")
+		res.Messages[0].Parts = append([]Part{ReasoningPart{Text: "Check the forecast.", Signature: "sig"}}, res.Messages[0].Parts...)
+		return res
+	}
+	tests := []struct {
+		name      string
+		policy    ReasoningPolicy
+		reasoning string
+	}{
+		{name: "keep", policy: KeepReasoning, reasoning: "Check the forecast."},
+		{name: "drop", policy: DropReasoning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := &historyMemory{}
+			agent := NewAgent("weather",
+				WithProvider(&scriptedProvider{responses: []*ModelResponse{answer()}}),
+				WithMemory(mem),
+				WithReasoningPolicy(tt.policy),
+			)
+			res, err := agent.Run(context.Background(), NewPrompt(UserMessage("Weather?")))
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if res.Messages[0].Reasoning() != "Check the forecast." {
+				t.Errorf("Run() reasoning = %q, want it returned to the caller", res.Messages[0].Reasoning())
+			}
+			if len(mem.added) != 2 {
+				t.Fatalf("stored %d messages, want 2", len(mem.added))
+			}
+			stored := mem.added[1]
+			if stored.Reasoning() != tt.reasoning || stored.Text() != "It is sunny." {
+				t.Errorf("stored message = %q (reasoning %q), want reasoning %q", stored.Text(), stored.Reasoning(), tt.reasoning)
+			}
+		})
+	}
+}
+
+func TestAgentUsage(t *testing.T) {
+	responses := func() []*ModelResponse {
+		call := toolCallResponse("get_weather")
+		call.Usage = &Usage{InputTokens: 1000000, OutputTokens: 100000, TotalTokens: 1100000}
+		answer := textResponse("It is sunny.")
+		answer.Usage = &Usage{InputTokens: 1200000, CachedInputTokens: 1000000, OutputTokens: 200000, TotalTokens: 1400000}
+		return []*ModelResponse{call, answer}
+	}
+	pricing := PriceTable{"gpt-4o": {Input: 2, CachedInput: 1, Output: 10}}
+	want := Usage{InputTokens: 2200000, CachedInputTokens: 1000000, OutputTokens: 300000, TotalTokens: 2500000, Cost: 3 + 3.4}
+	newAgent := func() *Agent {
+		return NewAgent("weather",
+			WithModel("gpt-4o"),
+			WithProvider(&scriptedProvider{responses: responses()}),
+			WithTools(weatherTool()),
+			WithPricing(pricing),
+		)
+	}
+	res, err := newAgent().Run(context.Background(), NewPrompt(UserMessage("weather?")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Run() usage = %+v, want %+v", res.Usage, want)
+	}
+	stream, err := newAgent().RunStream(context.Background(), NewPrompt(UserMessage("weather?")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var last *Generation
+	for stream.Next() {
+		if last, err = stream.Current(); err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+	}
+	if last.Usage == nil || *last.Usage != want {
+		t.Errorf("RunStream() last usage = %+v, want %+v", last.Usage, want)
+	}
+}
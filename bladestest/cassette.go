@@ -0,0 +1,350 @@
+package bladestest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+var (
+	// ErrNoInteraction is returned when a replayed request matches no recorded interaction.
+	ErrNoInteraction = errors.New("bladestest: no recorded interaction matches the request")
+)
+
+// redacted replaces secrets in recorded interactions.
+const redacted = "REDACTED"
+
+// Mode selects whether a Recorder replays or records interactions.
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette, without network access.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests to the real transport and writes them to the cassette when the test ends.
+	ModeRecord
+)
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded HTTP request.
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// RecordedResponse is a recorded HTTP response, streamed bodies such as SSE are recorded whole.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body"`
+}
+
+// Body is a recorded body, encoded as text when it is valid UTF-8 and as base64 otherwise.
+type Body []byte
+
+// MarshalJSON encodes the body as a string, prefixed with "base64:" when it is binary.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) && !strings.HasPrefix(string(b), "base64:") {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal("base64:" + base64.StdEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a body encoded by MarshalJSON.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if encoded, ok := strings.CutPrefix(s, "base64:"); ok {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		*b = decoded
+		return nil
+	}
+	*b = Body(s)
+	return nil
+}
+
+// cassette is the file format of a Recorder.
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Matcher reports whether a request matches a recorded request.
+type Matcher func(req *http.Request, body []byte, recorded RecordedRequest) bool
+
+// MatchRequest matches requests by method, path, query and body, ignoring the host so that
+// cassettes replay with any base URL. JSON bodies are compared regardless of formatting and
+// key order.
+func MatchRequest(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	if req.Method != recorded.Method {
+		return false
+	}
+	u := *req.URL
+	u.Scheme, u.Host, u.User = "", "", nil
+	if u.String() != recorded.URL {
+		return false
+	}
+	return bytes.Equal(canonicalJSON(body), canonicalJSON(recorded.Body))
+}
+
+// canonicalJSON returns JSON re-encoded with sorted keys and no formatting, or the data as is
+// when it is not JSON.
+func canonicalJSON(data []byte) []byte {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return data
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return b
+}
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(*Recorder)
+
+// WithMode sets whether the recorder replays or records. Defaults to ModeReplay.
+func WithMode(mode Mode) RecorderOption {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// WithTransport sets the transport requests are sent to when recording. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) RecorderOption {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithMatcher sets how requests are matched to recorded requests. Defaults to MatchRequest.
+func WithMatcher(matcher Matcher) RecorderOption {
+	return func(r *Recorder) {
+		r.matcher = matcher
+	}
+}
+
+// WithRedactedHeaders adds headers whose values are redacted from the cassette. Authorization,
+// Api-Key, X-Api-Key, Cookie, Set-Cookie, OpenAI-Organization and OpenAI-Project are always redacted.
+func WithRedactedHeaders(names ...string) RecorderOption {
+	return func(r *Recorder) {
+		r.headers = append(r.headers, names...)
+	}
+}
+
+// WithSecrets sets strings, such as API keys, that are redacted wherever they appear in the
+// recorded URLs, headers and bodies.
+func WithSecrets(secrets ...string) RecorderOption {
+	return func(r *Recorder) {
+		for _, secret := range secrets {
+			if secret != "" {
+				r.secrets = append(r.secrets, secret)
+			}
+		}
+	}
+}
+
+// Recorder is an http.RoundTripper that records HTTP interactions to a cassette file and
+// replays them offline, so that provider tests run against real payloads without network access.
+// Use it with a provider through its HTTP client option, such as option.WithHTTPClient.
+type Recorder struct {
+	path         string
+	mode         Mode
+	transport    http.RoundTripper
+	matcher      Matcher
+	headers      []string
+	secrets      []string
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewRecorder creates a Recorder for the cassette at path. In ModeReplay the cassette is loaded
+// and requests are answered by the first unused interaction they match, and in ModeRecord the
+// interactions are written to the cassette when the test ends, with secrets redacted.
+func NewRecorder(tb testing.TB, path string, opts ...RecorderOption) *Recorder {
+	tb.Helper()
+	r := &Recorder{
+		path:      path,
+		transport: http.DefaultTransport,
+		matcher:   MatchRequest,
+		headers:   []string{"Authorization", "Api-Key", "X-Api-Key", "Cookie", "Set-Cookie", "OpenAI-Organization", "OpenAI-Project"},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.mode == ModeRecord {
+		tb.Cleanup(func() {
+			if err := r.save(); err != nil {
+				tb.Errorf("bladestest: save cassette %s: %v", path, err)
+			}
+		})
+		return r
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatalf("bladestest: load cassette: %v", err)
+	}
+	var c cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		tb.Fatalf("bladestest: load cassette %s: %v", path, err)
+	}
+	r.interactions = c.Interactions
+	r.used = make([]bool, len(c.Interactions))
+	return r
+}
+
+// Client returns an HTTP client using the recorder as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip replays or records the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+// replay answers the request with the first unused interaction it matches. The secrets are
+// redacted from the request before matching, as they were from the recorded ones.
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	u, err := url.Parse(r.redact(req.URL.String()))
+	if err != nil {
+		return nil, err
+	}
+	match := req.Clone(req.Context())
+	match.URL = u
+	body = []byte(r.redact(string(body)))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, interaction := range r.interactions {
+		if r.used[i] || !r.matcher(match, body, interaction.Request) {
+			continue
+		}
+		r.used[i] = true
+		res := interaction.Response
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+			StatusCode:    res.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        res.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(res.Body)),
+			ContentLength: int64(len(res.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.Path)
+}
+
+// record sends the request to the transport and records it with its response.
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	res, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	u := *req.URL
+	u.Scheme, u.Host, u.User = "", "", nil
+	interaction := &Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.redact(u.String()),
+			Header: r.redactHeader(req.Header),
+			Body:   Body(r.redact(string(body))),
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     r.redactHeader(res.Header),
+			Body:       Body(r.redact(string(resBody))),
+		},
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	return res, nil
+}
+
+// redact replaces the secrets in s.
+func (r *Recorder) redact(s string) string {
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// redactHeader returns a copy of the header with the redacted headers and secrets replaced.
+func (r *Recorder) redactHeader(header http.Header) http.Header {
+	out := make(http.Header, len(header))
+	for name, values := range header {
+		redactAll := false
+		for _, h := range r.headers {
+			if strings.EqualFold(name, h) {
+				redactAll = true
+			}
+		}
+		for _, v := range values {
+			if redactAll {
+				v = redacted
+			}
+			out.Add(name, r.redact(v))
+		}
+	}
+	return out
+}
+
+// save writes the recorded interactions to the cassette.
+func (r *Recorder) save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, err := json.MarshalIndent(cassette{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,70 @@
+package bladestest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Set-Cookie", "session=abc")
+		io.WriteString(w, "data: {\"text\":\"Hello\"}\n\ndata: [DONE]\n\n")
+	}))
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	send := func(client *http.Client, body string) (string, error) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat?key=sk-secret", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer sk-secret")
+		res, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		b, err := io.ReadAll(res.Body)
+		return string(b), err
+	}
+	want := "data: {\"text\":\"Hello\"}\n\ndata: [DONE]\n\n"
+	t.Run("record", func(t *testing.T) {
+		recorder := NewRecorder(t, path, WithMode(ModeRecord), WithSecrets("sk-secret"))
+		if got, err := send(recorder.Client(), `{"model":"gpt-4o","stream":true}`); err != nil || got != want {
+			t.Fatalf("recorded body = %q, %v", got, err)
+		}
+	})
+	server.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "sk-secret") || strings.Contains(string(data), "abc") {
+		t.Errorf("cassette leaks secrets:\n%s", data)
+	}
+	recorder := NewRecorder(t, path, WithSecrets("sk-secret"))
+	if got, err := send(recorder.Client(), "{\n  \"stream\": true,\n  \"model\": \"gpt-4o\"\n}"); err != nil || got != want {
+		t.Errorf("replayed body = %q, %v, want %q", got, err, want)
+	}
+	if _, err := send(recorder.Client(), `{"model":"gpt-4o","stream":true}`); !errors.Is(err, ErrNoInteraction) {
+		t.Errorf("replaying a used interaction = %v, want %v", err, ErrNoInteraction)
+	}
+}
+
+func TestBody(t *testing.T) {
+	for _, body := range []Body{Body("data: hello\n\n"), Body{0xff, 0x00, 0x10}, Body("base64:text")} {
+		data, err := body.MarshalJSON()
+		if err != nil {
+			t.Fatalf("MarshalJSON() error = %v", err)
+		}
+		var got Body
+		if err := got.UnmarshalJSON(data); err != nil || string(got) != string(body) {
+			t.Errorf("round trip of %q = %q, %v", body, got, err)
+		}
+	}
+}
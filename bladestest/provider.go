@@ -0,0 +1,330 @@
+// Package bladestest provides a scripted blades.ModelProvider for testing agents and flows
+// without network access.
+package bladestest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	// ErrUnexpectedRequest is returned when a Provider receives more requests than it has turns.
+	ErrUnexpectedRequest = errors.New("bladestest: unexpected request")
+)
+
+// Check asserts on a request received by a Provider.
+type Check func(*blades.ModelRequest) error
+
+// Turn is the scripted answer of a Provider to one request.
+type Turn struct {
+	response  *blades.ModelResponse
+	err       error
+	checks    []Check
+	latency   time.Duration
+	chunks    []string
+	chunkSize int
+	failAfter int
+	streamErr error
+}
+
+// Respond returns a turn answering with the response.
+func Respond(res *blades.ModelResponse) *Turn {
+	return &Turn{response: res}
+}
+
+// Text returns a turn answering with a completed assistant message holding the text.
+func Text(text string) *Turn {
+	msg := blades.AssistantMessage(text)
+	msg.Status = blades.StatusCompleted
+	return Respond(&blades.ModelResponse{Messages: []*blades.Message{msg}})
+}
+
+// ToolCall returns a turn requesting a call of the named tool with the JSON arguments.
+// The call ID is derived from the tool name.
+func ToolCall(name, arguments string) *Turn {
+	return ToolCalls(&blades.ToolCall{ID: "call_" + name, Name: name, Arguments: arguments})
+}
+
+// ToolCalls returns a turn requesting the tool calls.
+func ToolCalls(calls ...*blades.ToolCall) *Turn {
+	return Respond(&blades.ModelResponse{Messages: []*blades.Message{{
+		ID:        blades.NewMessageID(),
+		Role:      blades.RoleAssistant,
+		Status:    blades.StatusCompleted,
+		ToolCalls: calls,
+	}}})
+}
+
+// Fail returns a turn failing with the error.
+func Fail(err error) *Turn {
+	return &Turn{err: err}
+}
+
+// Expect adds checks run on the request the turn answers. Failed checks are reported to the test,
+// and the turn is answered anyway.
+func (t *Turn) Expect(checks ...Check) *Turn {
+	t.checks = append(t.checks, checks...)
+	return t
+}
+
+// Latency delays the answer, or the first response of a stream, by d. The request fails with
+// the context error when the context is done first.
+func (t *Turn) Latency(d time.Duration) *Turn {
+	t.latency = d
+	return t
+}
+
+// Chunks sets the text deltas streamed before the completed message.
+// By default the text of the message is streamed as a single delta.
+func (t *Turn) Chunks(chunks ...string) *Turn {
+	t.chunks = chunks
+	return t
+}
+
+// ChunkSize streams the text of the message in deltas of n runes.
+func (t *Turn) ChunkSize(n int) *Turn {
+	t.chunkSize = n
+	return t
+}
+
+// FailAfter makes the stream fail with err after n deltas, without sending the completed message.
+func (t *Turn) FailAfter(n int, err error) *Turn {
+	t.failAfter = n
+	t.streamErr = err
+	return t
+}
+
+// Usage sets the usage reported with the response.
+func (t *Turn) Usage(usage *blades.Usage) *Turn {
+	if t.response != nil {
+		t.response.Usage = usage
+	}
+	return t
+}
+
+// deltas returns the responses streamed before the completed response.
+func (t *Turn) deltas() []*blades.ModelResponse {
+	var out []*blades.ModelResponse
+	for _, msg := range t.response.Messages {
+		delta := func(parts []blades.Part, calls []*blades.ToolCall) {
+			out = append(out, &blades.ModelResponse{Messages: []*blades.Message{{
+				ID:        msg.ID,
+				Role:      msg.Role,
+				Status:    blades.StatusIncomplete,
+				Parts:     parts,
+				ToolCalls: calls,
+			}}})
+		}
+		if reasoning := msg.Reasoning(); reasoning != "" {
+			delta([]blades.Part{blades.ReasoningPart{Text: reasoning}}, nil)
+		}
+		for _, chunk := range t.textChunks(msg.Text()) {
+			delta([]blades.Part{blades.TextPart{Text: chunk}}, nil)
+		}
+		for _, call := range msg.ToolCalls {
+			delta(nil, []*blades.ToolCall{{ID: call.ID, Name: call.Name, Arguments: call.Arguments}})
+		}
+	}
+	return out
+}
+
+// textChunks splits the text into the streamed deltas.
+func (t *Turn) textChunks(text string) []string {
+	switch {
+	case t.chunks != nil:
+		return t.chunks
+	case text == "":
+		return nil
+	case t.chunkSize <= 0:
+		return []string{text}
+	}
+	var chunks []string
+	for runes := []rune(text); len(runes) > 0; {
+		n := min(t.chunkSize, len(runes))
+		chunks = append(chunks, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return chunks
+}
+
+// Provider is a blades.ModelProvider answering each request with the next scripted turn.
+// It is safe for concurrent use.
+type Provider struct {
+	tb       testing.TB
+	mu       sync.Mutex
+	turns    []*Turn
+	requests []*blades.ModelRequest
+}
+
+// NewProvider creates a Provider answering with the turns in order. Failed checks and requests
+// beyond the scripted turns are reported to tb, and so are turns left unused when the test ends.
+func NewProvider(tb testing.TB, turns ...*Turn) *Provider {
+	p := &Provider{tb: tb, turns: turns}
+	tb.Cleanup(func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if len(p.turns) > 0 {
+			tb.Errorf("bladestest: %d scripted turns were not requested", len(p.turns))
+		}
+	})
+	return p
+}
+
+// Add queues more turns.
+func (p *Provider) Add(turns ...*Turn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.turns = append(p.turns, turns...)
+}
+
+// Requests returns the requests received so far.
+func (p *Provider) Requests() []*blades.ModelRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.requests)
+}
+
+// next records the request and returns the turn answering it.
+func (p *Provider) next(req *blades.ModelRequest) (*Turn, error) {
+	p.mu.Lock()
+	snapshot := *req
+	snapshot.Messages = slices.Clone(req.Messages)
+	p.requests = append(p.requests, &snapshot)
+	n := len(p.requests)
+	if len(p.turns) == 0 {
+		p.mu.Unlock()
+		p.tb.Errorf("bladestest: request %d has no scripted turn", n)
+		return nil, ErrUnexpectedRequest
+	}
+	turn := p.turns[0]
+	p.turns = p.turns[1:]
+	p.mu.Unlock()
+	for _, check := range turn.checks {
+		if err := check(&snapshot); err != nil {
+			p.tb.Errorf("bladestest: request %d: %v", n, err)
+		}
+	}
+	return turn, nil
+}
+
+// wait waits for the latency of the turn.
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Generate answers the request with the next turn.
+func (p *Provider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	turn, err := p.next(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := wait(ctx, turn.latency); err != nil {
+		return nil, err
+	}
+	if turn.err != nil {
+		return nil, turn.err
+	}
+	return turn.response, nil
+}
+
+// NewStream streams the next turn as text deltas followed by the completed response.
+// A failing turn fails before the first response.
+func (p *Provider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	turn, err := p.next(req)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
+	pipe.Go(func() error {
+		if err := wait(ctx, turn.latency); err != nil {
+			return err
+		}
+		if turn.err != nil {
+			return turn.err
+		}
+		for i, delta := range turn.deltas() {
+			if turn.streamErr != nil && i == turn.failAfter {
+				return turn.streamErr
+			}
+			pipe.Send(delta)
+		}
+		if turn.streamErr != nil {
+			return turn.streamErr
+		}
+		pipe.Send(turn.response)
+		return nil
+	})
+	return pipe, nil
+}
+
+// ExpectModel checks the model of the request.
+func ExpectModel(model string) Check {
+	return func(req *blades.ModelRequest) error {
+		if req.Model != model {
+			return fmt.Errorf("model = %q, want %q", req.Model, model)
+		}
+		return nil
+	}
+}
+
+// ExpectTools checks the names of the tools sent with the request.
+func ExpectTools(names ...string) Check {
+	return func(req *blades.ModelRequest) error {
+		var got []string
+		for _, tool := range req.Tools {
+			got = append(got, tool.Name)
+		}
+		if !slices.Equal(got, names) {
+			return fmt.Errorf("tools = %v, want %v", got, names)
+		}
+		return nil
+	}
+}
+
+// ExpectLastMessage checks the role and text of the last message of the request.
+func ExpectLastMessage(role blades.Role, text string) Check {
+	return func(req *blades.ModelRequest) error {
+		if len(req.Messages) == 0 {
+			return fmt.Errorf("no messages, want a last %s message %q", role, text)
+		}
+		last := req.Messages[len(req.Messages)-1]
+		if last.Role != role || last.Text() != text {
+			return fmt.Errorf("last message = %s %q, want %s %q", last.Role, last.Text(), role, text)
+		}
+		return nil
+	}
+}
+
+// ExpectToolResult checks that the request carries the result of a call of the named tool.
+func ExpectToolResult(name, result string) Check {
+	return func(req *blades.ModelRequest) error {
+		for _, msg := range req.Messages {
+			if msg.Role != blades.RoleTool {
+				continue
+			}
+			for _, call := range msg.ToolCalls {
+				if call.Name == name && call.Result == result {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("no %s result %q", name, result)
+	}
+}
@@ -0,0 +1,164 @@
+package bladestest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// recorder is a testing.TB recording the reported errors and cleanups.
+type recorder struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Cleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+func (r *recorder) finish() {
+	for _, fn := range r.cleanups {
+		fn()
+	}
+}
+
+func weatherTool() *blades.Tool {
+	return &blades.Tool{
+		Name: "get_weather",
+		Handle: func(ctx context.Context, args string) (string, error) {
+			return "Sunny", nil
+		},
+	}
+}
+
+func TestProviderToolLoop(t *testing.T) {
+	provider := NewProvider(t,
+		ToolCall("get_weather", `{"location":"Paris"}`).Expect(
+			ExpectModel("gpt-4o"),
+			ExpectTools("get_weather"),
+			ExpectLastMessage(blades.RoleUser, "Weather in Paris?"),
+		),
+		Text("It is sunny in Paris.").Expect(ExpectToolResult("get_weather", "Sunny")),
+	)
+	agent := blades.NewAgent("weather",
+		blades.WithModel("gpt-4o"),
+		blades.WithProvider(provider),
+		blades.WithTools(weatherTool()),
+	)
+	res, err := agent.Run(context.Background(), blades.NewPrompt(blades.UserMessage("Weather in Paris?")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Text() != "It is sunny in Paris." {
+		t.Errorf("Run() text = %q", res.Text())
+	}
+	if n := len(provider.Requests()); n != 2 {
+		t.Errorf("Requests() = %d requests, want 2", n)
+	}
+}
+
+func TestProviderStream(t *testing.T) {
+	tests := []struct {
+		name string
+		turn *Turn
+		want string
+		err  error
+	}{
+		{name: "single delta", turn: Text("Hello there!"), want: "[incomplete:Hello there! completed:Hello there!]"},
+		{name: "chunks", turn: Text("Hello there!").Chunks("Hel", "lo there!"), want: "[incomplete:Hel incomplete:lo there! completed:Hello there!]"},
+		{name: "chunk size", turn: Text("Hello there!").ChunkSize(5), want: "[incomplete:Hello incomplete: ther incomplete:e! completed:Hello there!]"},
+		{name: "fail after", turn: Text("Hello there!").ChunkSize(5).FailAfter(1, blades.ErrOverloaded), want: "[incomplete:Hello]", err: blades.ErrOverloaded},
+		{name: "fail", turn: Fail(blades.ErrRateLimited), want: "[]", err: blades.ErrRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewProvider(t, tt.turn)
+			stream, err := provider.NewStream(context.Background(), &blades.ModelRequest{})
+			if err != nil {
+				t.Fatalf("NewStream() error = %v", err)
+			}
+			defer stream.Close()
+			got := []string{}
+			for stream.Next() {
+				res, err := stream.Current()
+				if err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Errorf("Current() error = %v, want %v", err, tt.err)
+					}
+					break
+				}
+				msg := res.Messages[0]
+				got = append(got, fmt.Sprintf("%s:%s", msg.Status, msg.Text()))
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("stream = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProviderRetry(t *testing.T) {
+	provider := NewProvider(t,
+		Fail(&blades.ModelError{Kind: blades.ErrRateLimited, StatusCode: 429, Err: errors.New("slow down")}),
+		Text("Hello!").Usage(&blades.Usage{InputTokens: 1, OutputTokens: 2, TotalTokens: 3}),
+	)
+	agent := blades.NewAgent("assistant",
+		blades.WithProvider(provider),
+		blades.WithMiddleware(blades.Retry(blades.WithBackoff(time.Millisecond, time.Millisecond))),
+	)
+	res, err := agent.Run(context.Background(), blades.NewPrompt(blades.UserMessage("Hi")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if res.Text() != "Hello!" || res.Usage == nil || res.Usage.TotalTokens != 3 {
+		t.Errorf("Run() = %q (usage %+v)", res.Text(), res.Usage)
+	}
+}
+
+func TestProviderLatency(t *testing.T) {
+	provider := NewProvider(t, Text("late").Latency(time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := provider.Generate(ctx, &blades.ModelRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Generate() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestProviderReports(t *testing.T) {
+	rec := &recorder{}
+	provider := NewProvider(rec,
+		Text("Hello!").Expect(ExpectModel("gpt-4o"), ExpectLastMessage(blades.RoleUser, "Hi")),
+		Text("unused"),
+	)
+	if _, err := provider.Generate(context.Background(), &blades.ModelRequest{Model: "qwen-plus", Messages: []*blades.Message{blades.UserMessage("Hi")}}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	rec.finish()
+	want := []string{
+		`bladestest: request 1: model = "qwen-plus", want "gpt-4o"`,
+		"bladestest: 1 scripted turns were not requested",
+	}
+	if strings.Join(rec.errors, "\n") != strings.Join(want, "\n") {
+		t.Errorf("reported errors = %q, want %q", rec.errors, want)
+	}
+	rec = &recorder{}
+	provider = NewProvider(rec)
+	if _, err := provider.Generate(context.Background(), &blades.ModelRequest{}); !errors.Is(err, ErrUnexpectedRequest) {
+		t.Errorf("Generate() error = %v, want %v", err, ErrUnexpectedRequest)
+	}
+	if len(rec.errors) != 1 {
+		t.Errorf("reported errors = %q, want the unexpected request", rec.errors)
+	}
+}
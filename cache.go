@@ -0,0 +1,326 @@
+package blades
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheStore stores the responses of model requests by key. A request answered by Generate
+// is stored as a single response, a streamed request as every response of the stream.
+type CacheStore interface {
+	Get(ctx context.Context, key string) ([]*ModelResponse, bool, error)
+	Set(ctx context.Context, key string, responses []*ModelResponse) error
+}
+
+// CacheKey returns the canonical hash of a request and the options that affect its response.
+// Message and tool call IDs are left out, since they vary between otherwise identical requests.
+func CacheKey(req *ModelRequest, opts ...ModelOption) (string, error) {
+	opt := ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	// MaxIterations bounds the agent loop, not the model call.
+	opt.MaxIterations = 0
+	key := struct {
+		Model    string       `json:"model"`
+		Tools    []*Tool      `json:"tools,omitempty"`
+		Messages []*Message   `json:"messages"`
+		Options  ModelOptions `json:"options"`
+	}{Model: req.Model, Tools: req.Tools, Options: opt}
+	for _, msg := range req.Messages {
+		m := *msg
+		m.ID = ""
+		m.Status = ""
+		m.ToolCalls = make([]*ToolCall, 0, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			c := *call
+			c.ID = ""
+			m.ToolCalls = append(m.ToolCalls, &c)
+		}
+		key.Messages = append(key.Messages, &m)
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CacheOption configures a cache provider.
+type CacheOption func(*cacheProvider)
+
+// WithCacheErrorHandler sets a function reporting the errors of the cache store, which do not
+// fail model calls. Defaults to ignoring them.
+func WithCacheErrorHandler(handler func(ctx context.Context, key string, err error)) CacheOption {
+	return func(p *cacheProvider) {
+		p.onError = handler
+	}
+}
+
+// cacheProvider is a ModelProvider that answers repeated requests from a CacheStore.
+type cacheProvider struct {
+	provider ModelProvider
+	store    CacheStore
+	onError  func(ctx context.Context, key string, err error)
+}
+
+// NewCacheProvider wraps a ModelProvider to answer requests already seen from the store, keyed
+// by CacheKey. Streams are replayed from the cache response by response. Cached responses carry
+// no Usage, since no tokens were consumed to answer them. Requests whose options cannot be
+// hashed are not cached. A store that fails to read an entry is treated as a miss, and a store
+// that fails to write one does not fail the call, see WithCacheErrorHandler.
+func NewCacheProvider(provider ModelProvider, store CacheStore, opts ...CacheOption) ModelProvider {
+	p := &cacheProvider{provider: provider, store: store}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// SupportsResponseFormat reports whether the wrapped provider honors the ResponseFormat.
+func (p *cacheProvider) SupportsResponseFormat() bool {
+	return SupportsResponseFormat(p.provider)
+}
+
+// Generate returns the cached response of the request, or generates and caches it.
+func (p *cacheProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	key, err := CacheKey(req, opts...)
+	if err != nil {
+		return p.provider.Generate(ctx, req, opts...)
+	}
+	if responses, ok := p.get(ctx, key); ok {
+		return cached(responses[len(responses)-1]), nil
+	}
+	res, err := p.provider.Generate(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.set(ctx, key, []*ModelResponse{res})
+	return res, nil
+}
+
+// NewStream replays the cached responses of the request, or streams and caches them once the
+// stream completes successfully.
+func (p *cacheProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	key, err := CacheKey(req, opts...)
+	if err != nil {
+		return p.provider.NewStream(ctx, req, opts...)
+	}
+	if responses, ok := p.get(ctx, key); ok {
+		pipe := NewStreamPipe[*ModelResponse]()
+		pipe.Go(func() error {
+			for _, res := range responses {
+				pipe.Send(cached(res))
+			}
+			return nil
+		})
+		return pipe, nil
+	}
+	stream, err := p.provider.NewStream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Go(func() error {
+		defer stream.Close()
+		var responses []*ModelResponse
+		for stream.Next() {
+			res, err := stream.Current()
+			if err != nil {
+				return err
+			}
+			responses = append(responses, res)
+			pipe.Send(res)
+		}
+		if len(responses) > 0 {
+			p.set(ctx, key, responses)
+		}
+		return nil
+	})
+	return pipe, nil
+}
+
+// get returns the responses cached under the key, a store error is reported and is a miss.
+func (p *cacheProvider) get(ctx context.Context, key string) ([]*ModelResponse, bool) {
+	responses, ok, err := p.store.Get(ctx, key)
+	if err != nil {
+		p.report(ctx, key, err)
+		return nil, false
+	}
+	return responses, ok && len(responses) > 0
+}
+
+// set caches the responses under the key, a store error is reported.
+func (p *cacheProvider) set(ctx context.Context, key string, responses []*ModelResponse) {
+	if err := p.store.Set(ctx, key, responses); err != nil {
+		p.report(ctx, key, err)
+	}
+}
+
+func (p *cacheProvider) report(ctx context.Context, key string, err error) {
+	if p.onError != nil {
+		p.onError(ctx, key, err)
+	}
+}
+
+// cached returns a cached response without its usage.
+func cached(res *ModelResponse) *ModelResponse {
+	out := *res
+	out.Usage = nil
+	return &out
+}
+
+// memoryCache is an in-memory CacheStore evicting the least recently used entries.
+type memoryCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+// memoryEntry is an entry of the memory cache, the responses are kept encoded so that callers
+// cannot modify them.
+type memoryEntry struct {
+	key       string
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates an in-memory CacheStore holding at most size entries, evicting the
+// least recently used ones. Entries expire after ttl, a zero size or ttl means no limit.
+func NewMemoryCache(size int, ttl time.Duration) CacheStore {
+	return &memoryCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Get returns the responses cached under the key, unless they expired.
+func (c *memoryCache) Get(ctx context.Context, key string) ([]*ModelResponse, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := elem.Value.(*memoryEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+	var responses []*ModelResponse
+	if err := json.Unmarshal(entry.data, &responses); err != nil {
+		return nil, false, err
+	}
+	return responses, true, nil
+}
+
+// Set caches the responses under the key, evicting the least recently used entry when full.
+func (c *memoryCache) Set(ctx context.Context, key string, responses []*ModelResponse) error {
+	data, err := json.Marshal(responses)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &memoryEntry{key: key, data: data}
+	if c.ttl > 0 {
+		entry.expiresAt = c.now().Add(c.ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+// fileCache is a CacheStore keeping each entry in a JSON file of a directory.
+type fileCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewFileCache creates a CacheStore keeping each entry in a JSON file named after its key in dir,
+// which is created when needed, so that the cache is kept across runs. Entries expire ttl after
+// they were written, a zero ttl means they never expire.
+func NewFileCache(dir string, ttl time.Duration) CacheStore {
+	return &fileCache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+func (c *fileCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get returns the responses cached under the key, unless they expired.
+func (c *fileCache) Get(ctx context.Context, key string) ([]*ModelResponse, bool, error) {
+	path := c.path(key)
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if c.ttl > 0 && !c.now().Before(info.ModTime().Add(c.ttl)) {
+		return nil, false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	var responses []*ModelResponse
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, false, err
+	}
+	return responses, true, nil
+}
+
+// Set writes the responses under the key, through a temporary file so that readers never see
+// a partial entry.
+func (c *fileCache) Set(ctx context.Context, key string, responses []*ModelResponse) error {
+	data, err := json.MarshalIndent(responses, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
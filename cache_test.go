@@ -0,0 +1,232 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	request := func() *ModelRequest {
+		call := &Message{ID: NewMessageID(), Role: RoleAssistant, ToolCalls: []*ToolCall{{ID: NewMessageID(), Name: "get_weather", Arguments: `{}`}}}
+		return &ModelRequest{Model: "gpt-4o", Messages: []*Message{UserMessage("Weather?"), call}}
+	}
+	key := func(req *ModelRequest, opts ...ModelOption) string {
+		k, err := CacheKey(req, opts...)
+		if err != nil {
+			t.Fatalf("CacheKey() error = %v", err)
+		}
+		return k
+	}
+	base := key(request(), Temperature(0.2))
+	if got := key(request(), Temperature(0.2), MaxIterations(3)); got != base {
+		t.Errorf("CacheKey() differs with message IDs or max iterations")
+	}
+	if got := key(request(), Temperature(0.7)); got == base {
+		t.Errorf("CacheKey() ignores the temperature")
+	}
+	other := request()
+	other.Model = "gpt-4o-mini"
+	if got := key(other, Temperature(0.2)); got == base {
+		t.Errorf("CacheKey() ignores the model")
+	}
+}
+
+func TestCacheProvider(t *testing.T) {
+	answer := textResponse("Hello!")
+	answer.Usage = &Usage{InputTokens: 3, OutputTokens: 2, TotalTokens: 5}
+	inner := &scriptedProvider{responses: []*ModelResponse{answer, textResponse("Bye!")}}
+	provider := NewCacheProvider(inner, NewMemoryCache(10, 0))
+	req := func(text string) *ModelRequest {
+		return &ModelRequest{Model: "gpt-4o", Messages: []*Message{UserMessage(text)}}
+	}
+	first, err := provider.Generate(context.Background(), req("Hi"))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	second, err := provider.Generate(context.Background(), req("Hi"))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if len(inner.requests) != 1 {
+		t.Errorf("provider received %d requests, want 1", len(inner.requests))
+	}
+	if first.Usage == nil || second.Usage != nil || second.Messages[0].Text() != "Hello!" {
+		t.Errorf("cached response = %q (usage %+v), want Hello! without usage", second.Messages[0].Text(), second.Usage)
+	}
+	if _, err := provider.Generate(context.Background(), req("Bye")); err != nil || len(inner.requests) != 2 {
+		t.Errorf("Generate() of another prompt = %v after %d requests, want a provider call", err, len(inner.requests))
+	}
+}
+
+// brokenCache is a CacheStore failing every write.
+type brokenCache struct{}
+
+func (brokenCache) Get(ctx context.Context, key string) ([]*ModelResponse, bool, error) {
+	return nil, false, nil
+}
+
+func (brokenCache) Set(ctx context.Context, key string, responses []*ModelResponse) error {
+	return errors.New("disk full")
+}
+
+func TestCacheProviderStoreErrors(t *testing.T) {
+	ctx := context.Background()
+	req := &ModelRequest{Model: "gpt-4o", Messages: []*Message{UserMessage("Hi")}}
+	var reported []error
+	onError := WithCacheErrorHandler(func(ctx context.Context, key string, err error) {
+		reported = append(reported, err)
+	})
+
+	// A failed write does not discard the generated response.
+	provider := NewCacheProvider(&scriptedProvider{responses: []*ModelResponse{textResponse("Hello!")}}, brokenCache{}, onError)
+	if res, err := provider.Generate(ctx, req); err != nil || res.Messages[0].Text() != "Hello!" {
+		t.Fatalf("Generate() = %v, want the response despite the store error", err)
+	}
+	stream, err := NewCacheProvider(&chunkProvider{words: []string{"Hel", "lo!"}}, brokenCache{}, onError).NewStream(ctx, req)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	for stream.Next() {
+		if _, err := stream.Current(); err != nil {
+			t.Fatalf("Current() error = %v, want the stream to complete", err)
+		}
+	}
+	if len(reported) != 2 {
+		t.Errorf("reported %d store errors, want 2", len(reported))
+	}
+
+	// A corrupt entry is a miss, and is replaced by the generated response.
+	dir := t.TempDir()
+	key, _ := CacheKey(req)
+	if err := os.WriteFile(filepath.Join(dir, key+".json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	inner := &scriptedProvider{responses: []*ModelResponse{textResponse("Hello!")}}
+	provider = NewCacheProvider(inner, NewFileCache(dir, 0), onError)
+	for i := 0; i < 2; i++ {
+		if res, err := provider.Generate(ctx, req); err != nil || res.Messages[0].Text() != "Hello!" {
+			t.Fatalf("Generate() = %v, want the response despite the corrupt entry", err)
+		}
+	}
+	if len(inner.requests) != 1 || len(reported) != 3 {
+		t.Errorf("provider received %d requests with %d store errors, want 1 and 3", len(inner.requests), len(reported))
+	}
+}
+
+// chunkProvider streams its text word by word.
+type chunkProvider struct {
+	words []string
+	calls int
+}
+
+func (p *chunkProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (p *chunkProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	p.calls++
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Go(func() error {
+		var text string
+		for _, word := range p.words {
+			text += word
+			pipe.Send(&ModelResponse{Messages: []*Message{{Role: RoleAssistant, Status: StatusIncomplete, Parts: []Part{TextPart{Text: word}}}}})
+		}
+		msg := AssistantMessage(text)
+		msg.Status = StatusCompleted
+		pipe.Send(&ModelResponse{Messages: []*Message{msg}})
+		return nil
+	})
+	return pipe, nil
+}
+
+func TestCacheProviderStream(t *testing.T) {
+	inner := &chunkProvider{words: []string{"Hel", "lo!"}}
+	provider := NewCacheProvider(inner, NewMemoryCache(10, 0))
+	req := &ModelRequest{Model: "gpt-4o", Messages: []*Message{UserMessage("Hi")}}
+	var replays []string
+	for i := 0; i < 2; i++ {
+		stream, err := provider.NewStream(context.Background(), req)
+		if err != nil {
+			t.Fatalf("NewStream() error = %v", err)
+		}
+		var texts []string
+		for stream.Next() {
+			res, err := stream.Current()
+			if err != nil {
+				t.Fatalf("Current() error = %v", err)
+			}
+			texts = append(texts, fmt.Sprintf("%s:%s", res.Messages[0].Status, res.Messages[0].Text()))
+		}
+		stream.Close()
+		replays = append(replays, fmt.Sprint(texts))
+	}
+	if inner.calls != 1 {
+		t.Errorf("provider streamed %d times, want 1", inner.calls)
+	}
+	want := "[incomplete:Hel incomplete:lo! completed:Hello!]"
+	if replays[0] != want || replays[1] != want {
+		t.Errorf("streams = %v, want %s twice", replays, want)
+	}
+	res, err := provider.Generate(context.Background(), req)
+	if err != nil || res.Messages[0].Text() != "Hello!" {
+		t.Errorf("Generate() from the cached stream = %v, %v, want Hello!", res, err)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	now := time.Now()
+	cache := NewMemoryCache(2, time.Minute).(*memoryCache)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+	for _, key := range []string{"a", "b"} {
+		if err := cache.Set(ctx, key, []*ModelResponse{textResponse(key)}); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("Get(a) missed")
+	}
+	_ = cache.Set(ctx, "c", []*ModelResponse{textResponse("c")})
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Error("Get(b) hit, want the least recently used entry evicted")
+	}
+	responses, ok, err := cache.Get(ctx, "a")
+	if err != nil || !ok || responses[0].Messages[0].Text() != "a" {
+		t.Errorf("Get(a) = %v, %v, %v", responses, ok, err)
+	}
+	now = now.Add(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Error("Get(a) hit after the ttl")
+	}
+}
+
+func TestFileCache(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	res := textResponse("Hello!")
+	res.Messages[0].Parts = append([]Part{ReasoningPart{Text: "Greet back."}}, res.Messages[0].Parts...)
+	if err := NewFileCache(dir, 0).Set(ctx, "key", []*ModelResponse{res}); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	responses, ok, err := NewFileCache(dir, 0).Get(ctx, "key")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if msg := responses[0].Messages[0]; msg.Text() != "Hello!" || msg.Reasoning() != "Greet back." {
+		t.Errorf("Get() message = %q (reasoning %q)", msg.Text(), msg.Reasoning())
+	}
+	if _, ok, err := NewFileCache(dir, 0).Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("Get(missing) = %v, %v, want a miss", ok, err)
+	}
+	expired := NewFileCache(dir, time.Minute).(*fileCache)
+	expired.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, ok, _ := expired.Get(ctx, "key"); ok {
+		t.Error("Get() hit after the ttl")
+	}
+}
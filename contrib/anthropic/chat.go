@@ -0,0 +1,376 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/anthropics/anthropic-sdk-go/packages/param"
+	"github.com/go-kratos/blades"
+)
+
+var (
+	// ErrEmptyResponse indicates the provider returned no content.
+	ErrEmptyResponse = errors.New("anthropic: empty message response")
+)
+
+// defaultMaxTokens is used when MaxOutputTokens is not set, since the Messages API requires max_tokens.
+const defaultMaxTokens = 4096
+
+// thinkingBudgets maps ReasoningEffort levels to extended thinking budget tokens.
+var thinkingBudgets = map[string]int64{
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    16384,
+}
+
+// ChatProvider implements blades.ModelProvider for the Anthropic Messages API.
+type ChatProvider struct {
+	client anthropic.Client
+}
+
+// NewChatProvider constructs an Anthropic provider. The API key is read from
+// the ANTHROPIC_API_KEY environment variable. If ANTHROPIC_BASE_URL is set,
+// it is used as the API base URL; otherwise the library default is used.
+func NewChatProvider(opts ...option.RequestOption) blades.ModelProvider {
+	return &ChatProvider{client: anthropic.NewClient(opts...)}
+}
+
+// SupportsResponseFormat reports that the ResponseFormat is emulated with a system prompt.
+func (p *ChatProvider) SupportsResponseFormat() bool {
+	return true
+}
+
+// Generate executes a non-streaming Messages API request.
+func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	params, err := toMessageParams(req, opt)
+	if err != nil {
+		return nil, err
+	}
+	message, err := p.client.Messages.New(ctx, params)
+	if err != nil {
+		return nil, toError(err)
+	}
+	return messageToResponse(message)
+}
+
+// NewStream streams Messages API events and converts each content delta into
+// a ModelResponse for incremental consumption. The accumulated message is sent
+// as the last response of the stream.
+func (p *ChatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	params, err := toMessageParams(req, opt)
+	if err != nil {
+		return nil, err
+	}
+	stream := p.client.Messages.NewStreaming(ctx, params)
+	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
+	pipe.Go(func() error {
+		defer stream.Close()
+		message := anthropic.Message{}
+		for stream.Next() {
+			event := stream.Current()
+			if err := message.Accumulate(event); err != nil {
+				return err
+			}
+			if res := eventToResponse(&message, event); res != nil {
+				pipe.Send(res)
+			}
+		}
+		if err := stream.Err(); err != nil {
+			return toError(err)
+		}
+		lastResponse, err := messageToResponse(&message)
+		if err != nil {
+			return err
+		}
+		pipe.Send(lastResponse)
+		return nil
+	})
+	return pipe, nil
+}
+
+// toMessageParams converts a generic model request into Anthropic params.
+func toMessageParams(req *blades.ModelRequest, opt blades.ModelOptions) (anthropic.MessageNewParams, error) {
+	tools, err := toTools(req.Tools)
+	if err != nil {
+		return anthropic.MessageNewParams{}, err
+	}
+	params := anthropic.MessageNewParams{
+		Tools:     tools,
+		Model:     anthropic.Model(req.Model),
+		MaxTokens: defaultMaxTokens,
+		Messages:  make([]anthropic.MessageParam, 0, len(req.Messages)),
+	}
+	if opt.MaxOutputTokens > 0 {
+		params.MaxTokens = opt.MaxOutputTokens
+	}
+	if opt.TopP > 0 {
+		params.TopP = param.NewOpt(opt.TopP)
+	}
+	if opt.Temperature > 0 {
+		params.Temperature = param.NewOpt(opt.Temperature)
+	}
+	if budget, ok := thinkingBudgets[opt.ReasoningEffort]; ok {
+		params.Thinking = anthropic.ThinkingConfigParamOfEnabled(budget)
+		// max_tokens must be greater than the thinking budget.
+		if params.MaxTokens <= budget {
+			params.MaxTokens = budget + defaultMaxTokens
+		}
+	}
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case blades.RoleSystem:
+			for _, part := range msg.Parts {
+				if text, ok := part.(blades.TextPart); ok {
+					params.System = append(params.System, anthropic.TextBlockParam{Text: text.Text})
+				}
+			}
+		case blades.RoleUser:
+			params.Messages = append(params.Messages, anthropic.NewUserMessage(toContentBlocks(msg)...))
+		case blades.RoleAssistant:
+			blocks, err := toAssistantBlocks(msg)
+			if err != nil {
+				return anthropic.MessageNewParams{}, err
+			}
+			params.Messages = append(params.Messages, anthropic.NewAssistantMessage(blocks...))
+		case blades.RoleTool:
+			blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.ToolCalls))
+			for _, call := range msg.ToolCalls {
+				blocks = append(blocks, anthropic.NewToolResultBlock(call.ID, call.Result, false))
+			}
+			params.Messages = append(params.Messages, anthropic.NewUserMessage(blocks...))
+		}
+	}
+	// The Messages API has no structured output, so the schema is given as instructions.
+	if opt.ResponseFormat != nil {
+		instructions, err := opt.ResponseFormat.Instructions()
+		if err != nil {
+			return anthropic.MessageNewParams{}, err
+		}
+		params.System = append(params.System, anthropic.TextBlockParam{Text: instructions})
+	}
+	return params, nil
+}
+
+// toTools converts blades tools into Anthropic custom tools.
+func toTools(tools []*blades.Tool) ([]anthropic.ToolUnionParam, error) {
+	if len(tools) == 0 {
+		return nil, nil
+	}
+	params := make([]anthropic.ToolUnionParam, 0, len(tools))
+	for _, tool := range tools {
+		schema := anthropic.ToolInputSchemaParam{}
+		if tool.InputSchema != nil {
+			b, err := json.Marshal(tool.InputSchema)
+			if err != nil {
+				return nil, err
+			}
+			fields := make(map[string]any)
+			if err := json.Unmarshal(b, &fields); err != nil {
+				return nil, err
+			}
+			schema.Properties = fields["properties"]
+			schema.Required = tool.InputSchema.Required
+			delete(fields, "type")
+			delete(fields, "properties")
+			delete(fields, "required")
+			if len(fields) > 0 {
+				schema.ExtraFields = fields
+			}
+		}
+		unionParam := anthropic.ToolUnionParamOfTool(schema, tool.Name)
+		if tool.Description != "" {
+			unionParam.OfTool.Description = param.NewOpt(tool.Description)
+		}
+		params = append(params, unionParam)
+	}
+	return params, nil
+}
+
+// toContentBlocks converts message parts to Anthropic content blocks (multi-modal user input).
+func toContentBlocks(message *blades.Message) []anthropic.ContentBlockParamUnion {
+	blocks := make([]anthropic.ContentBlockParamUnion, 0, len(message.Parts))
+	for _, part := range message.Parts {
+		switch v := part.(type) {
+		case blades.TextPart:
+			blocks = append(blocks, anthropic.NewTextBlock(v.Text))
+		case blades.FilePart:
+			switch {
+			case v.MimeType.Type() == "image":
+				blocks = append(blocks, anthropic.NewImageBlock(anthropic.URLImageSourceParam{URL: v.URI}))
+			case v.MimeType.Format() == "pdf":
+				blocks = append(blocks, anthropic.NewDocumentBlock(anthropic.URLPDFSourceParam{URL: v.URI}))
+			default:
+				log.Println("failed to process file part with MIME type:", v.MimeType)
+			}
+		case blades.DataPart:
+			data := base64.StdEncoding.EncodeToString(v.Bytes)
+			switch {
+			case v.MimeType.Type() == "image":
+				blocks = append(blocks, anthropic.NewImageBlockBase64(string(v.MimeType), data))
+			case v.MimeType.Format() == "pdf":
+				blocks = append(blocks, anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{Data: data}))
+			default:
+				log.Println("failed to process data part with MIME type:", v.MimeType)
+			}
+		}
+	}
+	return blocks
+}
+
+// toAssistantBlocks converts an assistant message, including thinking and tool use, to content blocks.
+// Thinking blocks must be passed back unmodified together with their signature, so reasoning
+// without a signature, such as reasoning produced by another provider, is not sent.
+func toAssistantBlocks(message *blades.Message) ([]anthropic.ContentBlockParamUnion, error) {
+	var blocks []anthropic.ContentBlockParamUnion
+	for _, part := range message.Parts {
+		switch v := part.(type) {
+		case blades.ReasoningPart:
+			switch {
+			case v.Redacted != "":
+				blocks = append(blocks, anthropic.NewRedactedThinkingBlock(v.Redacted))
+			case v.Signature != "":
+				blocks = append(blocks, anthropic.NewThinkingBlock(v.Signature, v.Text))
+			}
+		case blades.TextPart:
+			if v.Text != "" {
+				blocks = append(blocks, anthropic.NewTextBlock(v.Text))
+			}
+		}
+	}
+	for _, call := range message.ToolCalls {
+		input := json.RawMessage(call.Arguments)
+		if strings.TrimSpace(call.Arguments) == "" {
+			input = json.RawMessage("{}")
+		}
+		if !json.Valid(input) {
+			return nil, errors.New("anthropic: invalid tool call arguments for " + call.Name)
+		}
+		blocks = append(blocks, anthropic.NewToolUseBlock(call.ID, input, call.Name))
+	}
+	return blocks, nil
+}
+
+// messageToResponse converts a complete Anthropic message to a ModelResponse.
+func messageToResponse(message *anthropic.Message) (*blades.ModelResponse, error) {
+	if message == nil || (len(message.Content) == 0 && message.StopReason == "") {
+		return nil, ErrEmptyResponse
+	}
+	msg := &blades.Message{
+		ID:       message.ID,
+		Role:     blades.RoleAssistant,
+		Status:   blades.StatusCompleted,
+		Metadata: map[string]string{},
+	}
+	if message.StopReason != "" {
+		msg.Metadata["finish_reason"] = string(message.StopReason)
+	}
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			msg.Parts = append(msg.Parts, blades.TextPart{Text: block.Text})
+		case "thinking":
+			msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: block.Thinking, Signature: block.Signature})
+		case "redacted_thinking":
+			msg.Parts = append(msg.Parts, blades.ReasoningPart{Redacted: block.Data})
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
+	}
+	return &blades.ModelResponse{Messages: []*blades.Message{msg}, Usage: toUsage(message.Usage)}, nil
+}
+
+// toUsage converts Anthropic token usage, whose input tokens exclude the tokens read from
+// and written to the prompt cache, to a blades Usage.
+func toUsage(usage anthropic.Usage) *blades.Usage {
+	input := usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens
+	if input == 0 && usage.OutputTokens == 0 {
+		return nil
+	}
+	return &blades.Usage{
+		InputTokens:       input,
+		OutputTokens:      usage.OutputTokens,
+		TotalTokens:       input + usage.OutputTokens,
+		CachedInputTokens: usage.CacheReadInputTokens,
+	}
+}
+
+// eventToResponse converts a streaming content delta to a ModelResponse, it returns nil for
+// events that carry no content.
+func eventToResponse(message *anthropic.Message, event anthropic.MessageStreamEventUnion) *blades.ModelResponse {
+	msg := &blades.Message{
+		ID:       message.ID,
+		Role:     blades.RoleAssistant,
+		Status:   blades.StatusIncomplete,
+		Metadata: map[string]string{},
+	}
+	switch event.Type {
+	case "content_block_start":
+		if event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
+			ID:   event.ContentBlock.ID,
+			Name: event.ContentBlock.Name,
+		})
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			msg.Parts = append(msg.Parts, blades.TextPart{Text: event.Delta.Text})
+		case "thinking_delta":
+			msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: event.Delta.Thinking})
+		case "input_json_delta":
+			if int(event.Index) >= len(message.Content) {
+				return nil
+			}
+			block := message.Content[event.Index]
+			msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: event.Delta.PartialJSON,
+			})
+		default:
+			return nil
+		}
+	case "message_delta":
+		if event.Delta.StopReason == "" {
+			return nil
+		}
+		msg.Metadata["finish_reason"] = string(event.Delta.StopReason)
+	default:
+		return nil
+	}
+	return &blades.ModelResponse{Messages: []*blades.Message{msg}}
+}
+
+// toError classifies Anthropic API errors into blades.ModelError, other errors are returned unchanged.
+func toError(err error) error {
+	var apiErr *anthropic.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	var header http.Header
+	if apiErr.Response != nil {
+		header = apiErr.Response.Header
+	}
+	return blades.NewModelError(apiErr.StatusCode, header, err)
+}
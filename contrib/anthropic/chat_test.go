@@ -0,0 +1,263 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// newTestProvider starts a stand-in Messages API server that replays the given testdata file
+// and records the decoded request body.
+func newTestProvider(t *testing.T, file, contentType string, body *map[string]any) blades.ModelProvider {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		if body != nil {
+			_ = json.Unmarshal(b, body)
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return NewChatProvider(
+		option.WithBaseURL(server.URL),
+		option.WithAPIKey("test"),
+		option.WithMaxRetries(0),
+	)
+}
+
+func TestGenerate(t *testing.T) {
+	var body map[string]any
+	provider := newTestProvider(t, "testdata/message_tool_use.json", "application/json", &body)
+	req := &blades.ModelRequest{
+		Model: "claude-sonnet-4-5",
+		Tools: []*blades.Tool{
+			{
+				Name:        "get_weather",
+				Description: "Get the current weather for a given city",
+				InputSchema: &jsonschema.Schema{
+					Type: "object",
+					Properties: map[string]*jsonschema.Schema{
+						"location": {Type: "string"},
+					},
+					Required: []string{"location"},
+				},
+			},
+		},
+		Messages: []*blades.Message{
+			blades.SystemMessage("You are a weather assistant."),
+			blades.UserMessage("What is the weather in San Francisco?"),
+		},
+	}
+	res, err := provider.Generate(context.Background(), req, blades.ReasoningEffort("low"))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if body["system"] == nil {
+		t.Errorf("request system = nil, want system blocks")
+	}
+	if thinking, _ := body["thinking"].(map[string]any); thinking["type"] != "enabled" {
+		t.Errorf("request thinking = %v, want enabled", body["thinking"])
+	}
+	tools, _ := body["tools"].([]any)
+	if len(tools) != 1 {
+		t.Fatalf("request tools = %v, want 1 tool", body["tools"])
+	}
+	if schema := tools[0].(map[string]any)["input_schema"].(map[string]any); schema["type"] != "object" || schema["properties"] == nil {
+		t.Errorf("request input_schema = %v", schema)
+	}
+	msg := res.Messages[0]
+	if msg.Text() != "Let me check the weather." {
+		t.Errorf("Generate() text = %q", msg.Text())
+	}
+	if reasoning, ok := msg.Parts[0].(blades.ReasoningPart); !ok || reasoning.Text != "I should call the weather tool." || reasoning.Signature == "" {
+		t.Errorf("Generate() reasoning = %+v", msg.Parts[0])
+	}
+	if msg.Metadata["finish_reason"] != "tool_use" {
+		t.Errorf("Generate() finish_reason = %q, want tool_use", msg.Metadata["finish_reason"])
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Name != "get_weather" || msg.ToolCalls[0].Arguments != `{"location": "San Francisco"}` {
+		t.Errorf("Generate() tool calls = %+v", msg.ToolCalls)
+	}
+	want := blades.Usage{InputTokens: 3119, OutputTokens: 503, TotalTokens: 3622, CachedInputTokens: 1024}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Generate() usage = %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestNewStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		text      string
+		reason    string
+		toolCalls int
+		arguments string
+		thinking  string
+		usage     blades.Usage
+	}{
+		{
+			name:     "text with thinking",
+			file:     "testdata/stream_text.sse",
+			text:     "Hello!",
+			reason:   "end_turn",
+			thinking: "The user greets me.",
+			usage:    blades.Usage{InputTokens: 25, OutputTokens: 15, TotalTokens: 40},
+		},
+		{
+			name:      "tool use",
+			file:      "testdata/stream_tool_use.sse",
+			text:      "Let me check the weather.",
+			reason:    "tool_use",
+			toolCalls: 1,
+			arguments: `{"location": "San Francisco"}`,
+			usage:     blades.Usage{InputTokens: 472, OutputTokens: 89, TotalTokens: 561},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t, tt.file, "text/event-stream", nil)
+			req := &blades.ModelRequest{
+				Model:    "claude-sonnet-4-5",
+				Messages: []*blades.Message{blades.UserMessage("Hi")},
+			}
+			stream, err := provider.NewStream(context.Background(), req)
+			if err != nil {
+				t.Fatalf("NewStream() error = %v", err)
+			}
+			defer stream.Close()
+			var (
+				deltas   string
+				thinking string
+				last     *blades.ModelResponse
+			)
+			for stream.Next() {
+				res, err := stream.Current()
+				if err != nil {
+					t.Fatalf("Current() error = %v", err)
+				}
+				if msg := res.Messages[0]; msg.Status == blades.StatusIncomplete {
+					deltas += msg.Text()
+					thinking += msg.Reasoning()
+				}
+				last = res
+			}
+			if deltas != tt.text {
+				t.Errorf("streamed text = %q, want %q", deltas, tt.text)
+			}
+			msg := last.Messages[0]
+			if msg.Status != blades.StatusCompleted || msg.Text() != tt.text {
+				t.Errorf("last message = %q (%s), want completed %q", msg.Text(), msg.Status, tt.text)
+			}
+			if msg.Metadata["finish_reason"] != tt.reason {
+				t.Errorf("finish_reason = %q, want %q", msg.Metadata["finish_reason"], tt.reason)
+			}
+			if last.Usage == nil || *last.Usage != tt.usage {
+				t.Errorf("usage = %+v, want %+v", last.Usage, tt.usage)
+			}
+			if thinking != tt.thinking || msg.Reasoning() != tt.thinking {
+				t.Errorf("thinking = %q, streamed %q, want %q", msg.Reasoning(), thinking, tt.thinking)
+			}
+			if len(msg.ToolCalls) != tt.toolCalls {
+				t.Fatalf("tool calls = %d, want %d", len(msg.ToolCalls), tt.toolCalls)
+			}
+			if tt.toolCalls > 0 && msg.ToolCalls[0].Arguments != tt.arguments {
+				t.Errorf("tool arguments = %q, want %q", msg.ToolCalls[0].Arguments, tt.arguments)
+			}
+		})
+	}
+}
+
+func TestToMessageParams(t *testing.T) {
+	req := &blades.ModelRequest{
+		Model: "claude-sonnet-4-5",
+		Messages: []*blades.Message{
+			blades.UserMessage(
+				blades.TextPart{Text: "Describe this image"},
+			),
+			{
+				Role:  blades.RoleUser,
+				Parts: []blades.Part{blades.DataPart{Name: "cat.png", Bytes: []byte{0x89, 0x50}, MimeType: blades.MimeImagePNG}},
+			},
+			{
+				Role: blades.RoleAssistant,
+				Parts: []blades.Part{
+					blades.ReasoningPart{Text: "Need a tool.", Signature: "sig"},
+					blades.ReasoningPart{Redacted: "opaque"},
+					blades.ReasoningPart{Text: "Unsigned reasoning is not sent."},
+				},
+				ToolCalls: []*blades.ToolCall{
+					{ID: "toolu_1", Name: "lookup", Arguments: `{"q":"cat"}`},
+				},
+			},
+			{
+				Role: blades.RoleTool,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "toolu_1", Name: "lookup", Result: "a cat"},
+				},
+			},
+		},
+	}
+	params, err := toMessageParams(req, blades.ModelOptions{MaxOutputTokens: 100})
+	if err != nil {
+		t.Fatalf("toMessageParams() error = %v", err)
+	}
+	if params.MaxTokens != 100 {
+		t.Errorf("MaxTokens = %d, want 100", params.MaxTokens)
+	}
+	if len(params.Messages) != 4 {
+		t.Fatalf("toMessageParams() returned %d messages, want 4", len(params.Messages))
+	}
+	if image := params.Messages[1].Content[0].OfImage; image == nil || image.Source.OfBase64 == nil {
+		t.Errorf("image block = %+v, want base64 image", params.Messages[1].Content[0])
+	}
+	assistant := params.Messages[2].Content
+	if len(assistant) != 3 || assistant[0].OfThinking == nil || assistant[1].OfRedactedThinking == nil || assistant[2].OfToolUse == nil {
+		t.Errorf("assistant blocks = %+v, want thinking, redacted_thinking and tool_use", assistant)
+	}
+	if result := params.Messages[3].Content[0].OfToolResult; result == nil || result.ToolUseID != "toolu_1" {
+		t.Errorf("tool result block = %+v", params.Messages[3].Content[0])
+	}
+	if _, err := toMessageParams(&blades.ModelRequest{Messages: []*blades.Message{{
+		Role:      blades.RoleAssistant,
+		ToolCalls: []*blades.ToolCall{{ID: "toolu_2", Name: "lookup", Arguments: "{"}},
+	}}}, blades.ModelOptions{}); err == nil {
+		t.Errorf("toMessageParams() with invalid arguments error = nil, want error")
+	}
+}
+
+func TestToMessageParamsResponseFormat(t *testing.T) {
+	format := &blades.ResponseFormat{Name: "place", Schema: &jsonschema.Schema{
+		Type:       "object",
+		Properties: map[string]*jsonschema.Schema{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}}
+	req := &blades.ModelRequest{
+		Model:    "claude-sonnet-4-5",
+		Messages: []*blades.Message{blades.SystemMessage("Answer briefly."), blades.UserMessage("Where is the Eiffel Tower?")},
+	}
+	params, err := toMessageParams(req, blades.ModelOptions{ResponseFormat: format})
+	if err != nil {
+		t.Fatalf("toMessageParams() error = %v", err)
+	}
+	if len(params.System) != 2 || params.System[0].Text != "Answer briefly." || !strings.Contains(params.System[1].Text, `"required":["city"]`) {
+		t.Errorf("system = %+v, want the schema instructions after the system prompt", params.System)
+	}
+}
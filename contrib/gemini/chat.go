@@ -0,0 +1,438 @@
+package gemini
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/blades"
+	"google.golang.org/genai"
+)
+
+var (
+	// ErrEmptyResponse indicates the provider returned no candidates.
+	ErrEmptyResponse = errors.New("gemini: empty content response")
+	// ErrPromptBlocked indicates the prompt was blocked by safety filters.
+	ErrPromptBlocked = errors.New("gemini: prompt blocked")
+)
+
+// thinkingBudgets maps ReasoningEffort levels to thinking budget tokens.
+var thinkingBudgets = map[string]int32{
+	"minimal": 512,
+	"low":     2048,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// ChatProvider implements blades.ModelProvider for Gemini generateContent models.
+type ChatProvider struct {
+	client *genai.Client
+}
+
+// NewChatProvider constructs a Gemini provider. When config is nil, the API key
+// is read from the GOOGLE_API_KEY or GEMINI_API_KEY environment variable, and
+// Vertex AI is used when GOOGLE_GENAI_USE_VERTEXAI is set.
+func NewChatProvider(ctx context.Context, config *genai.ClientConfig) (blades.ModelProvider, error) {
+	client, err := genai.NewClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatProvider{client: client}, nil
+}
+
+// SupportsResponseFormat reports that the ResponseFormat is sent as the response JSON schema.
+func (p *ChatProvider) SupportsResponseFormat() bool {
+	return true
+}
+
+// Generate executes a non-streaming generateContent request.
+func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	contents, config, err := toContents(req, opt)
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.client.Models.GenerateContent(ctx, req.Model, contents, config)
+	if err != nil {
+		return nil, toError(err)
+	}
+	out, err := contentToResponse(res, blades.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	out.Usage = toUsage(res.UsageMetadata)
+	return out, nil
+}
+
+// NewStream executes a streamGenerateContent request and converts each chunk
+// into a ModelResponse for incremental consumption. The accumulated message is
+// sent as the last response of the stream.
+func (p *ChatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	contents, config, err := toContents(req, opt)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
+	pipe.Go(func() error {
+		acc := &blades.Message{
+			Role:     blades.RoleAssistant,
+			Status:   blades.StatusCompleted,
+			Metadata: map[string]string{},
+		}
+		var (
+			text, reasoning strings.Builder
+			usage           *blades.Usage
+		)
+		for chunk, err := range p.client.Models.GenerateContentStream(ctx, req.Model, contents, config) {
+			if err != nil {
+				return toError(err)
+			}
+			// Each chunk reports the usage of the response so far.
+			if chunk != nil && chunk.UsageMetadata != nil {
+				usage = toUsage(chunk.UsageMetadata)
+			}
+			res, err := contentToResponse(chunk, blades.StatusIncomplete)
+			if err != nil {
+				return err
+			}
+			for _, msg := range res.Messages {
+				accumulate(acc, &text, &reasoning, msg)
+			}
+			pipe.Send(res)
+		}
+		if text.Len() > 0 {
+			acc.Parts = append([]blades.Part{blades.TextPart{Text: text.String()}}, acc.Parts...)
+		}
+		if reasoning.Len() > 0 {
+			acc.Parts = append([]blades.Part{blades.ReasoningPart{Text: reasoning.String()}}, acc.Parts...)
+		}
+		pipe.Send(&blades.ModelResponse{Messages: []*blades.Message{acc}, Usage: usage})
+		return nil
+	})
+	return pipe, nil
+}
+
+// accumulate merges a streamed chunk message into the accumulated message. Thought text is
+// merged, while the reasoning parts holding signatures are kept as they are.
+func accumulate(acc *blades.Message, text, reasoning *strings.Builder, msg *blades.Message) {
+	if acc.ID == "" {
+		acc.ID = msg.ID
+	}
+	for _, part := range msg.Parts {
+		switch v := part.(type) {
+		case blades.TextPart:
+			text.WriteString(v.Text)
+		case blades.ReasoningPart:
+			reasoning.WriteString(v.Text)
+			if v.Signature != "" {
+				acc.Parts = append(acc.Parts, blades.ReasoningPart{Signature: v.Signature})
+			}
+		default:
+			acc.Parts = append(acc.Parts, part)
+		}
+	}
+	acc.ToolCalls = append(acc.ToolCalls, msg.ToolCalls...)
+	for k, v := range msg.Metadata {
+		acc.Metadata[k] = v
+	}
+}
+
+// toUsage converts Gemini usage metadata to a blades Usage, thoughts are counted as output.
+func toUsage(metadata *genai.GenerateContentResponseUsageMetadata) *blades.Usage {
+	if metadata == nil {
+		return nil
+	}
+	output := int64(metadata.CandidatesTokenCount) + int64(metadata.ThoughtsTokenCount)
+	return &blades.Usage{
+		InputTokens:       int64(metadata.PromptTokenCount),
+		OutputTokens:      output,
+		TotalTokens:       int64(metadata.TotalTokenCount),
+		ReasoningTokens:   int64(metadata.ThoughtsTokenCount),
+		CachedInputTokens: int64(metadata.CachedContentTokenCount),
+	}
+}
+
+// toContents converts a generic model request into Gemini contents and config.
+func toContents(req *blades.ModelRequest, opt blades.ModelOptions) ([]*genai.Content, *genai.GenerateContentConfig, error) {
+	config := &genai.GenerateContentConfig{
+		Tools: toTools(req.Tools),
+	}
+	if opt.TopP > 0 {
+		config.TopP = genai.Ptr(float32(opt.TopP))
+	}
+	if opt.Temperature > 0 {
+		config.Temperature = genai.Ptr(float32(opt.Temperature))
+	}
+	if opt.MaxOutputTokens > 0 {
+		config.MaxOutputTokens = int32(opt.MaxOutputTokens)
+	}
+	if budget, ok := thinkingBudgets[opt.ReasoningEffort]; ok {
+		config.ThinkingConfig = &genai.ThinkingConfig{
+			IncludeThoughts: true,
+			ThinkingBudget:  genai.Ptr(budget),
+		}
+	}
+	contents := make([]*genai.Content, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case blades.RoleSystem:
+			if config.SystemInstruction == nil {
+				config.SystemInstruction = &genai.Content{}
+			}
+			config.SystemInstruction.Parts = append(config.SystemInstruction.Parts, toParts(msg)...)
+		case blades.RoleUser:
+			contents = append(contents, &genai.Content{Role: genai.RoleUser, Parts: toParts(msg)})
+		case blades.RoleAssistant:
+			parts, err := toModelParts(msg)
+			if err != nil {
+				return nil, nil, err
+			}
+			contents = append(contents, &genai.Content{Role: genai.RoleModel, Parts: parts})
+		case blades.RoleTool:
+			parts := make([]*genai.Part, 0, len(msg.ToolCalls))
+			for _, call := range msg.ToolCalls {
+				parts = append(parts, &genai.Part{FunctionResponse: &genai.FunctionResponse{
+					ID:       call.ID,
+					Name:     call.Name,
+					Response: toFunctionResponse(call.Result),
+				}})
+			}
+			contents = append(contents, &genai.Content{Role: genai.RoleUser, Parts: parts})
+		}
+	}
+	if opt.ResponseFormat != nil {
+		if err := setResponseFormat(config, opt.ResponseFormat); err != nil {
+			return nil, nil, err
+		}
+	}
+	return contents, config, nil
+}
+
+// setResponseFormat constrains the response to the JSON schema. Gemini does not support a JSON
+// response MIME type together with function calling, so with tools the schema is given as
+// instructions instead.
+func setResponseFormat(config *genai.GenerateContentConfig, format *blades.ResponseFormat) error {
+	if len(config.Tools) == 0 {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseJsonSchema = format.Schema
+		return nil
+	}
+	instructions, err := format.Instructions()
+	if err != nil {
+		return err
+	}
+	if config.SystemInstruction == nil {
+		config.SystemInstruction = &genai.Content{}
+	}
+	config.SystemInstruction.Parts = append(config.SystemInstruction.Parts, &genai.Part{Text: instructions})
+	return nil
+}
+
+// toTools converts blades tools into Gemini function declarations.
+func toTools(tools []*blades.Tool) []*genai.Tool {
+	if len(tools) == 0 {
+		return nil
+	}
+	decls := make([]*genai.FunctionDeclaration, 0, len(tools))
+	for _, tool := range tools {
+		decl := &genai.FunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+		}
+		if tool.InputSchema != nil {
+			decl.ParametersJsonSchema = tool.InputSchema
+		}
+		decls = append(decls, decl)
+	}
+	return []*genai.Tool{{FunctionDeclarations: decls}}
+}
+
+// toParts converts message parts to Gemini parts, inline data is sent as-is so that
+// images, audio, video and documents are all understood natively.
+func toParts(message *blades.Message) []*genai.Part {
+	parts := make([]*genai.Part, 0, len(message.Parts))
+	for _, part := range message.Parts {
+		if p := toPart(part); p != nil {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// toPart converts a text, file or data part to a Gemini part, other parts are skipped.
+func toPart(part blades.Part) *genai.Part {
+	switch v := part.(type) {
+	case blades.TextPart:
+		return &genai.Part{Text: v.Text}
+	case blades.FilePart:
+		return &genai.Part{FileData: &genai.FileData{
+			FileURI:  v.URI,
+			MIMEType: string(v.MimeType),
+		}}
+	case blades.DataPart:
+		return &genai.Part{InlineData: &genai.Blob{
+			Data:     v.Bytes,
+			MIMEType: string(v.MimeType),
+		}}
+	}
+	return nil
+}
+
+// toModelParts converts an assistant message and its function calls to Gemini model parts.
+// Reasoning parts are sent back as thoughts with their signatures. A reasoning part holding
+// only a signature passes it to the part that follows it, or to the last part when none does,
+// as thinking models require the signatures back where they were returned.
+func toModelParts(message *blades.Message) ([]*genai.Part, error) {
+	var (
+		parts   = make([]*genai.Part, 0, len(message.Parts)+len(message.ToolCalls))
+		pending []byte
+	)
+	add := func(part *genai.Part) {
+		part.ThoughtSignature, pending = pending, nil
+		parts = append(parts, part)
+	}
+	for _, part := range message.Parts {
+		reasoning, ok := part.(blades.ReasoningPart)
+		if !ok {
+			if p := toPart(part); p != nil {
+				add(p)
+			}
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(reasoning.Signature)
+		if err != nil {
+			return nil, fmt.Errorf("gemini: invalid thought signature: %w", err)
+		}
+		if reasoning.Text == "" {
+			if len(signature) > 0 {
+				pending = signature
+			}
+			continue
+		}
+		parts = append(parts, &genai.Part{Text: reasoning.Text, Thought: true, ThoughtSignature: signature})
+	}
+	for _, call := range message.ToolCalls {
+		args := make(map[string]any)
+		if strings.TrimSpace(call.Arguments) != "" {
+			if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+				return nil, fmt.Errorf("gemini: invalid function call arguments for %s: %w", call.Name, err)
+			}
+		}
+		add(&genai.Part{FunctionCall: &genai.FunctionCall{ID: call.ID, Name: call.Name, Args: args}})
+	}
+	if pending != nil {
+		for i := len(parts) - 1; i >= 0; i-- {
+			if !parts[i].Thought {
+				parts[i].ThoughtSignature = pending
+				break
+			}
+		}
+	}
+	return parts, nil
+}
+
+// toFunctionResponse wraps a tool result, JSON objects are passed through and other results
+// are reported under the "output" key.
+func toFunctionResponse(result string) map[string]any {
+	response := make(map[string]any)
+	if err := json.Unmarshal([]byte(result), &response); err == nil {
+		return response
+	}
+	return map[string]any{"output": result}
+}
+
+// contentToResponse converts a generateContent response to a ModelResponse.
+func contentToResponse(res *genai.GenerateContentResponse, status blades.Status) (*blades.ModelResponse, error) {
+	if res == nil {
+		return nil, ErrEmptyResponse
+	}
+	if feedback := res.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+		return nil, fmt.Errorf("%w: %s", ErrPromptBlocked, feedback.BlockReason)
+	}
+	out := &blades.ModelResponse{}
+	for _, candidate := range res.Candidates {
+		msg := &blades.Message{
+			ID:       res.ResponseID,
+			Role:     blades.RoleAssistant,
+			Status:   status,
+			Metadata: map[string]string{},
+		}
+		if candidate.FinishReason != "" {
+			msg.Metadata["finish_reason"] = string(candidate.FinishReason)
+		}
+		if len(candidate.SafetyRatings) > 0 {
+			b, err := json.Marshal(candidate.SafetyRatings)
+			if err != nil {
+				return nil, err
+			}
+			msg.Metadata["safety_ratings"] = string(b)
+		}
+		if candidate.Content != nil {
+			for _, part := range candidate.Content.Parts {
+				var signature string
+				if len(part.ThoughtSignature) > 0 {
+					signature = base64.StdEncoding.EncodeToString(part.ThoughtSignature)
+				}
+				if part.Thought {
+					msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: part.Text, Signature: signature})
+					continue
+				}
+				// The signature of another part is kept in a reasoning part preceding it.
+				if signature != "" {
+					msg.Parts = append(msg.Parts, blades.ReasoningPart{Signature: signature})
+				}
+				switch {
+				case part.Text != "":
+					msg.Parts = append(msg.Parts, blades.TextPart{Text: part.Text})
+				case part.InlineData != nil:
+					msg.Parts = append(msg.Parts, blades.DataPart{
+						Name:     part.InlineData.DisplayName,
+						Bytes:    part.InlineData.Data,
+						MimeType: blades.MimeType(part.InlineData.MIMEType),
+					})
+				case part.FileData != nil:
+					msg.Parts = append(msg.Parts, blades.FilePart{
+						Name:     part.FileData.DisplayName,
+						URI:      part.FileData.FileURI,
+						MimeType: blades.MimeType(part.FileData.MIMEType),
+					})
+				case part.FunctionCall != nil:
+					args := part.FunctionCall.Args
+					if args == nil {
+						args = map[string]any{}
+					}
+					b, err := json.Marshal(args)
+					if err != nil {
+						return nil, err
+					}
+					msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
+						ID:        part.FunctionCall.ID,
+						Name:      part.FunctionCall.Name,
+						Arguments: string(b),
+					})
+				}
+			}
+		}
+		out.Messages = append(out.Messages, msg)
+	}
+	return out, nil
+}
+
+// toError classifies Gemini API errors into blades.ModelError, other errors are returned unchanged.
+func toError(err error) error {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	return blades.NewModelError(apiErr.Code, nil, err)
+}
@@ -0,0 +1,205 @@
+package gemini
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+	"google.golang.org/genai"
+)
+
+// newTestProvider starts a stand-in Gemini API server that replays the given testdata file
+// and records the decoded request body.
+func newTestProvider(t *testing.T, file string, body *map[string]any) blades.ModelProvider {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if body != nil {
+			_ = json.Unmarshal(b, body)
+		}
+		if strings.HasSuffix(r.URL.Path, ":streamGenerateContent") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	provider, err := NewChatProvider(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestGenerate(t *testing.T) {
+	var body map[string]any
+	provider := newTestProvider(t, "testdata/generate_function_call.json", &body)
+	req := &blades.ModelRequest{
+		Model: "gemini-2.5-flash",
+		Tools: []*blades.Tool{{Name: "get_weather", Description: "Get the current weather"}},
+		Messages: []*blades.Message{
+			blades.SystemMessage("You are a weather assistant."),
+			{
+				Role: blades.RoleUser,
+				Parts: []blades.Part{
+					blades.TextPart{Text: "What is the weather in this video?"},
+					blades.DataPart{Name: "clip.mp4", Bytes: []byte("video"), MimeType: blades.MimeVideoMP4},
+				},
+			},
+		},
+	}
+	res, err := provider.Generate(context.Background(), req, blades.ReasoningEffort("low"))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if body["systemInstruction"] == nil || body["tools"] == nil {
+		t.Errorf("request body = %v, want systemInstruction and tools", body)
+	}
+	contents, _ := body["contents"].([]any)
+	if len(contents) != 1 {
+		t.Fatalf("request contents = %v, want 1 content", body["contents"])
+	}
+	parts := contents[0].(map[string]any)["parts"].([]any)
+	if inline, _ := parts[1].(map[string]any)["inlineData"].(map[string]any); inline["mimeType"] != "video/mp4" {
+		t.Errorf("request inline data = %v, want video/mp4", parts[1])
+	}
+	msg := res.Messages[0]
+	if msg.Reasoning() != "The user wants the weather." {
+		t.Errorf("reasoning = %q", msg.Reasoning())
+	}
+	if len(msg.Parts) != 2 || msg.Parts[1] != (blades.ReasoningPart{Signature: "c2lnbmF0dXJl"}) {
+		t.Errorf("parts = %+v, want the thought signature of the function call", msg.Parts)
+	}
+	var ratings []*genai.SafetyRating
+	if err := json.Unmarshal([]byte(msg.Metadata["safety_ratings"]), &ratings); err != nil || len(ratings) != 2 {
+		t.Errorf("safety_ratings = %q, err = %v", msg.Metadata["safety_ratings"], err)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].Name != "get_weather" || msg.ToolCalls[0].Arguments != `{"location":"Paris"}` {
+		t.Errorf("tool calls = %+v", msg.ToolCalls)
+	}
+	want := blades.Usage{InputTokens: 12, OutputTokens: 13, TotalTokens: 25, ReasoningTokens: 5}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("usage = %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestNewStream(t *testing.T) {
+	provider := newTestProvider(t, "testdata/stream_text.sse", nil)
+	req := &blades.ModelRequest{
+		Model:    "gemini-2.5-flash",
+		Messages: []*blades.Message{blades.UserMessage("Tell me a story")},
+	}
+	stream, err := provider.NewStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	defer stream.Close()
+	var responses []*blades.ModelResponse
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		responses = append(responses, res)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("stream yielded %d responses, want 3", len(responses))
+	}
+	last := responses[2].Messages[0]
+	if last.Status != blades.StatusCompleted || last.Text() != "A cat chases a laser pointer." {
+		t.Errorf("last message = %q (%s)", last.Text(), last.Status)
+	}
+	if last.Metadata["finish_reason"] != "STOP" || last.Metadata["safety_ratings"] == "" {
+		t.Errorf("last metadata = %v", last.Metadata)
+	}
+	want := blades.Usage{InputTokens: 264, OutputTokens: 8, TotalTokens: 272}
+	if usage := responses[2].Usage; usage == nil || *usage != want {
+		t.Errorf("last usage = %+v, want %+v", usage, want)
+	}
+}
+
+func TestToContents(t *testing.T) {
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{
+			{
+				Role: blades.RoleAssistant,
+				Parts: []blades.Part{
+					blades.ReasoningPart{Text: "Check the weather.", Signature: "Zmlyc3Q="},
+					blades.ReasoningPart{Text: "Then answer.", Signature: "c2Vjb25k"},
+					blades.ReasoningPart{Signature: "c2lnbmF0dXJl"},
+				},
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Paris"}`},
+				},
+			},
+			{
+				Role: blades.RoleTool,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Result: "Sunny"},
+				},
+			},
+		},
+	}
+	contents, _, err := toContents(req, blades.ModelOptions{})
+	if err != nil {
+		t.Fatalf("toContents() error = %v", err)
+	}
+	if len(contents) != 2 {
+		t.Fatalf("toContents() returned %d contents, want 2", len(contents))
+	}
+	parts := contents[0].Parts
+	if contents[0].Role != genai.RoleModel || len(parts) != 3 {
+		t.Fatalf("model content = %+v, want two thoughts and the function call", contents[0])
+	}
+	// Every thought keeps its own signature.
+	if !parts[0].Thought || string(parts[0].ThoughtSignature) != "first" || !parts[1].Thought || string(parts[1].ThoughtSignature) != "second" {
+		t.Errorf("thoughts = %+v, %+v", parts[0], parts[1])
+	}
+	if call := parts[2]; call.FunctionCall == nil || string(call.ThoughtSignature) != "signature" {
+		t.Errorf("function call = %+v", call)
+	}
+	response := contents[1].Parts[0].FunctionResponse
+	if response == nil || response.Name != "get_weather" || response.Response["output"] != "Sunny" {
+		t.Errorf("function response = %+v", response)
+	}
+}
+
+func TestToContentsResponseFormat(t *testing.T) {
+	format := &blades.ResponseFormat{Name: "place", Schema: &jsonschema.Schema{
+		Type:       "object",
+		Properties: map[string]*jsonschema.Schema{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}}
+	req := &blades.ModelRequest{Messages: []*blades.Message{blades.UserMessage("Where is the Eiffel Tower?")}}
+	_, config, err := toContents(req, blades.ModelOptions{ResponseFormat: format})
+	if err != nil {
+		t.Fatalf("toContents() error = %v", err)
+	}
+	if config.ResponseMIMEType != "application/json" || config.ResponseJsonSchema != format.Schema || config.SystemInstruction != nil {
+		t.Errorf("config = %+v, want a JSON response schema", config)
+	}
+	req.Tools = []*blades.Tool{{Name: "get_weather"}}
+	_, config, err = toContents(req, blades.ModelOptions{ResponseFormat: format})
+	if err != nil {
+		t.Fatalf("toContents() error = %v", err)
+	}
+	if config.ResponseMIMEType != "" || config.SystemInstruction == nil || !strings.Contains(config.SystemInstruction.Parts[0].Text, `"required":["city"]`) {
+		t.Errorf("config with tools = %+v, want the schema as instructions", config)
+	}
+}
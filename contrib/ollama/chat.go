@@ -0,0 +1,414 @@
+package ollama
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+var (
+	// ErrEmptyResponse indicates the server returned no message.
+	ErrEmptyResponse = errors.New("ollama: empty chat response")
+)
+
+// defaultBaseURL is the address of a local Ollama server.
+const defaultBaseURL = "http://localhost:11434"
+
+// Error is returned when the server responds with an error status or an error line in the stream.
+// Error statuses are wrapped in a blades.ModelError classifying them.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return "ollama: " + e.Message
+	}
+	return fmt.Sprintf("ollama: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// ChatProvider implements blades.ModelProvider for the native Ollama /api/chat endpoint.
+type ChatProvider struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewChatProvider constructs an Ollama provider. The server address is read from
+// the OLLAMA_HOST environment variable, or defaults to http://localhost:11434.
+func NewChatProvider(opts ...Option) blades.ModelProvider {
+	p := &ChatProvider{
+		baseURL: baseURLFromEnv(),
+		client:  http.DefaultClient,
+	}
+	for _, apply := range opts {
+		apply(p)
+	}
+	return p
+}
+
+// baseURLFromEnv resolves OLLAMA_HOST, which may omit the scheme.
+func baseURLFromEnv() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return defaultBaseURL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host
+}
+
+// SupportsResponseFormat reports that the ResponseFormat is sent as the format of the request.
+func (p *ChatProvider) SupportsResponseFormat() bool {
+	return true
+}
+
+// Generate executes a non-streaming chat request.
+func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	params, err := toChatRequest(req, opt, false)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.do(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var res chatResponse
+	if err := json.NewDecoder(body).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, &Error{Message: res.Error}
+	}
+	msg, err := toMessage(blades.NewMessageID(), &res, blades.StatusCompleted)
+	if err != nil {
+		return nil, err
+	}
+	return &blades.ModelResponse{Messages: []*blades.Message{msg}, Usage: toUsage(&res)}, nil
+}
+
+// NewStream executes a streaming chat request and converts each NDJSON chunk into
+// a ModelResponse for incremental consumption. The accumulated message is sent as
+// the last response of the stream.
+func (p *ChatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	params, err := toChatRequest(req, opt, true)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.do(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
+	pipe.Go(func() error {
+		defer body.Close()
+		id := blades.NewMessageID()
+		acc := &blades.Message{
+			ID:       id,
+			Role:     blades.RoleAssistant,
+			Status:   blades.StatusCompleted,
+			Metadata: map[string]string{},
+		}
+		var (
+			text, reasoning strings.Builder
+			usage           *blades.Usage
+		)
+		decoder := json.NewDecoder(body)
+		for {
+			var chunk chatResponse
+			if err := decoder.Decode(&chunk); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return err
+			}
+			if chunk.Error != "" {
+				return &Error{Message: chunk.Error}
+			}
+			msg, err := toMessage(id, &chunk, blades.StatusIncomplete)
+			if err != nil {
+				return err
+			}
+			text.WriteString(chunk.Message.Content)
+			reasoning.WriteString(chunk.Message.Thinking)
+			acc.ToolCalls = append(acc.ToolCalls, msg.ToolCalls...)
+			for k, v := range msg.Metadata {
+				acc.Metadata[k] = v
+			}
+			if len(msg.Parts) > 0 || len(msg.ToolCalls) > 0 || len(msg.Metadata) > 0 {
+				pipe.Send(&blades.ModelResponse{Messages: []*blades.Message{msg}})
+			}
+			if chunk.Done {
+				usage = toUsage(&chunk)
+				break
+			}
+		}
+		if reasoning.Len() > 0 {
+			acc.Parts = append(acc.Parts, blades.ReasoningPart{Text: reasoning.String()})
+		}
+		if text.Len() > 0 {
+			acc.Parts = append(acc.Parts, blades.TextPart{Text: text.String()})
+		}
+		pipe.Send(&blades.ModelResponse{Messages: []*blades.Message{acc}, Usage: usage})
+		return nil
+	})
+	return pipe, nil
+}
+
+// do posts the chat request and returns the response body, non-2xx responses are returned as *Error.
+func (p *ChatProvider) do(ctx context.Context, params *chatRequest) (io.ReadCloser, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(p.baseURL, "/")+"/api/chat", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	res, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		data, _ := io.ReadAll(res.Body)
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(data, &body); err != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(data))
+		}
+		return nil, blades.NewModelError(res.StatusCode, res.Header, &Error{StatusCode: res.StatusCode, Message: body.Error})
+	}
+	return res.Body, nil
+}
+
+type chatRequest struct {
+	Model     string             `json:"model"`
+	Messages  []chatMessage      `json:"messages"`
+	Tools     []chatTool         `json:"tools,omitempty"`
+	Stream    bool               `json:"stream"`
+	Think     bool               `json:"think,omitempty"`
+	Format    *jsonschema.Schema `json:"format,omitempty"`
+	KeepAlive string             `json:"keep_alive,omitempty"`
+	Options   map[string]any     `json:"options,omitempty"`
+}
+
+type chatMessage struct {
+	Role      string         `json:"role"`
+	Content   string         `json:"content"`
+	Thinking  string         `json:"thinking,omitempty"`
+	Images    [][]byte       `json:"images,omitempty"`
+	ToolCalls []chatToolCall `json:"tool_calls,omitempty"`
+	ToolName  string         `json:"tool_name,omitempty"`
+}
+
+type chatToolCall struct {
+	ID       string           `json:"id,omitempty"`
+	Function chatToolFunction `json:"function"`
+}
+
+type chatToolFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type chatTool struct {
+	Type     string       `json:"type"`
+	Function chatToolSpec `json:"function"`
+}
+
+type chatToolSpec struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description,omitempty"`
+	Parameters  *jsonschema.Schema `json:"parameters,omitempty"`
+}
+
+type chatResponse struct {
+	Model      string      `json:"model"`
+	Message    chatMessage `json:"message"`
+	Done       bool        `json:"done"`
+	DoneReason string      `json:"done_reason"`
+	Error      string      `json:"error"`
+	// PromptEvalCount and EvalCount are the input and output tokens, reported on the done response.
+	PromptEvalCount int64 `json:"prompt_eval_count"`
+	EvalCount       int64 `json:"eval_count"`
+}
+
+// toUsage returns the token usage reported by a done response.
+func toUsage(res *chatResponse) *blades.Usage {
+	if res.PromptEvalCount == 0 && res.EvalCount == 0 {
+		return nil
+	}
+	return &blades.Usage{
+		InputTokens:  res.PromptEvalCount,
+		OutputTokens: res.EvalCount,
+		TotalTokens:  res.PromptEvalCount + res.EvalCount,
+	}
+}
+
+// toChatRequest converts a generic model request into an Ollama chat request.
+func toChatRequest(req *blades.ModelRequest, opt blades.ModelOptions, stream bool) (*chatRequest, error) {
+	params := &chatRequest{
+		Model:    req.Model,
+		Stream:   stream,
+		Think:    opt.ReasoningEffort != "",
+		Messages: make([]chatMessage, 0, len(req.Messages)),
+	}
+	if options, ok := opt.Extensions[ExtensionOptions].(map[string]any); ok {
+		params.Options = make(map[string]any, len(options))
+		for k, v := range options {
+			params.Options[k] = v
+		}
+	}
+	setOption := func(key string, value any) {
+		if params.Options == nil {
+			params.Options = make(map[string]any)
+		}
+		params.Options[key] = value
+	}
+	if opt.TopP > 0 {
+		setOption("top_p", opt.TopP)
+	}
+	if opt.Temperature > 0 {
+		setOption("temperature", opt.Temperature)
+	}
+	if opt.MaxOutputTokens > 0 {
+		setOption("num_predict", opt.MaxOutputTokens)
+	}
+	if n, ok := opt.Extensions[ExtensionNumCtx].(int); ok && n > 0 {
+		setOption("num_ctx", n)
+	}
+	if d, ok := opt.Extensions[ExtensionKeepAlive].(time.Duration); ok {
+		params.KeepAlive = d.String()
+	}
+	if opt.ResponseFormat != nil {
+		params.Format = opt.ResponseFormat.Schema
+	}
+	for _, tool := range req.Tools {
+		params.Tools = append(params.Tools, chatTool{
+			Type: "function",
+			Function: chatToolSpec{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case blades.RoleSystem, blades.RoleUser:
+			params.Messages = append(params.Messages, toChatMessage(msg))
+		case blades.RoleAssistant:
+			m := toChatMessage(msg)
+			m.Thinking = msg.Reasoning()
+			for _, call := range msg.ToolCalls {
+				args := json.RawMessage(call.Arguments)
+				if strings.TrimSpace(call.Arguments) == "" {
+					args = json.RawMessage("{}")
+				}
+				if !json.Valid(args) {
+					return nil, fmt.Errorf("ollama: invalid tool call arguments for %s", call.Name)
+				}
+				m.ToolCalls = append(m.ToolCalls, chatToolCall{
+					ID:       call.ID,
+					Function: chatToolFunction{Name: call.Name, Arguments: args},
+				})
+			}
+			params.Messages = append(params.Messages, m)
+		case blades.RoleTool:
+			for _, call := range msg.ToolCalls {
+				params.Messages = append(params.Messages, chatMessage{
+					Role:     "tool",
+					Content:  call.Result,
+					ToolName: call.Name,
+				})
+			}
+		}
+	}
+	return params, nil
+}
+
+// toChatMessage converts message parts to an Ollama message, images are sent inline
+// as base64 and text parts are joined.
+func toChatMessage(message *blades.Message) chatMessage {
+	m := chatMessage{Role: string(message.Role)}
+	var texts []string
+	for _, part := range message.Parts {
+		switch v := part.(type) {
+		case blades.TextPart:
+			texts = append(texts, v.Text)
+		case blades.DataPart:
+			if v.MimeType.Type() != "image" {
+				log.Println("failed to process data part with MIME type:", v.MimeType)
+				continue
+			}
+			m.Images = append(m.Images, v.Bytes)
+		case blades.FilePart:
+			log.Println("failed to process file part, only inline images are supported:", v.URI)
+		}
+	}
+	m.Content = strings.Join(texts, "\n")
+	return m
+}
+
+// toMessage converts a chat response, or a streamed chunk of one, to a blades message.
+// Ollama does not assign tool call IDs, so missing IDs are generated.
+func toMessage(id string, res *chatResponse, status blades.Status) (*blades.Message, error) {
+	if res.Message.Role == "" && !res.Done {
+		return nil, ErrEmptyResponse
+	}
+	msg := &blades.Message{
+		ID:       id,
+		Role:     blades.RoleAssistant,
+		Status:   status,
+		Metadata: map[string]string{},
+	}
+	if res.Message.Thinking != "" {
+		msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: res.Message.Thinking})
+	}
+	if res.Message.Content != "" {
+		msg.Parts = append(msg.Parts, blades.TextPart{Text: res.Message.Content})
+	}
+	if res.DoneReason != "" {
+		msg.Metadata["finish_reason"] = res.DoneReason
+	}
+	for _, call := range res.Message.ToolCalls {
+		args := call.Function.Arguments
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		callID := call.ID
+		if callID == "" {
+			callID = blades.NewMessageID()
+		}
+		msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
+			ID:        callID,
+			Name:      call.Function.Name,
+			Arguments: string(args),
+		})
+	}
+	return msg, nil
+}
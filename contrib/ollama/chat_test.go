@@ -0,0 +1,231 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// newTestProvider starts a stand-in Ollama server that replays the given testdata file
+// and records the decoded request body.
+func newTestProvider(t *testing.T, file string, body *map[string]any) blades.ModelProvider {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			http.NotFound(w, r)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		if body != nil {
+			_ = json.Unmarshal(b, body)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return NewChatProvider(WithBaseURL(server.URL))
+}
+
+func TestGenerate(t *testing.T) {
+	var body map[string]any
+	provider := newTestProvider(t, "testdata/chat_tool_call.json", &body)
+	req := &blades.ModelRequest{
+		Model: "llama3.2",
+		Tools: []*blades.Tool{{Name: "get_weather", Description: "Get the current weather"}},
+		Messages: []*blades.Message{
+			blades.SystemMessage("You are a weather assistant."),
+			{
+				Role: blades.RoleUser,
+				Parts: []blades.Part{
+					blades.TextPart{Text: "What is the weather in this photo?"},
+					blades.DataPart{Name: "sky.png", Bytes: []byte("image"), MimeType: blades.MimeImagePNG},
+				},
+			},
+		},
+	}
+	res, err := provider.Generate(context.Background(), req,
+		blades.Temperature(0.2),
+		blades.ReasoningEffort("low"),
+		KeepAlive(10*time.Minute),
+		NumCtx(8192),
+		Options(map[string]any{"seed": 42}),
+	)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	if body["stream"] != false || body["think"] != true || body["keep_alive"] != "10m0s" {
+		t.Errorf("request body = %v", body)
+	}
+	options, _ := body["options"].(map[string]any)
+	if options["num_ctx"] != float64(8192) || options["seed"] != float64(42) || options["temperature"] != 0.2 {
+		t.Errorf("request options = %v", options)
+	}
+	messages, _ := body["messages"].([]any)
+	if len(messages) != 2 {
+		t.Fatalf("request messages = %v, want 2 messages", body["messages"])
+	}
+	if images, _ := messages[1].(map[string]any)["images"].([]any); len(images) != 1 || images[0] != "aW1hZ2U=" {
+		t.Errorf("request images = %v", messages[1])
+	}
+	msg := res.Messages[0]
+	if msg.Status != blades.StatusCompleted || msg.Reasoning() != "The user wants the weather." {
+		t.Errorf("message = %+v", msg)
+	}
+	if len(msg.ToolCalls) != 1 || msg.ToolCalls[0].ID == "" || msg.ToolCalls[0].Name != "get_weather" || msg.ToolCalls[0].Arguments != `{"location":"Paris"}` {
+		t.Errorf("tool calls = %+v", msg.ToolCalls)
+	}
+	want := blades.Usage{InputTokens: 42, OutputTokens: 18, TotalTokens: 60}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("usage = %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestNewStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		text      string
+		responses int
+		toolCalls int
+		usage     blades.Usage
+	}{
+		{name: "text", file: "testdata/stream_text.ndjson", text: "A cat chases a laser pointer.", responses: 5,
+			usage: blades.Usage{InputTokens: 12, OutputTokens: 9, TotalTokens: 21}},
+		{name: "tool call", file: "testdata/stream_tool_call.ndjson", responses: 3, toolCalls: 1,
+			usage: blades.Usage{InputTokens: 40, OutputTokens: 16, TotalTokens: 56}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			provider := newTestProvider(t, tt.file, &body)
+			req := &blades.ModelRequest{
+				Model:    "llama3.2",
+				Messages: []*blades.Message{blades.UserMessage("Tell me a story")},
+			}
+			stream, err := provider.NewStream(context.Background(), req)
+			if err != nil {
+				t.Fatalf("NewStream() error = %v", err)
+			}
+			defer stream.Close()
+			var responses []*blades.ModelResponse
+			for stream.Next() {
+				res, err := stream.Current()
+				if err != nil {
+					t.Fatalf("Current() error = %v", err)
+				}
+				responses = append(responses, res)
+			}
+			if body["stream"] != true {
+				t.Errorf("request stream = %v, want true", body["stream"])
+			}
+			if len(responses) != tt.responses {
+				t.Fatalf("stream yielded %d responses, want %d", len(responses), tt.responses)
+			}
+			last := responses[len(responses)-1].Messages[0]
+			if last.Status != blades.StatusCompleted || last.Text() != tt.text {
+				t.Errorf("last message = %q (%s), want completed %q", last.Text(), last.Status, tt.text)
+			}
+			if last.Metadata["finish_reason"] != "stop" {
+				t.Errorf("finish_reason = %q, want stop", last.Metadata["finish_reason"])
+			}
+			if len(last.ToolCalls) != tt.toolCalls {
+				t.Errorf("tool calls = %d, want %d", len(last.ToolCalls), tt.toolCalls)
+			}
+			if usage := responses[len(responses)-1].Usage; usage == nil || *usage != tt.usage {
+				t.Errorf("usage = %+v, want %+v", usage, tt.usage)
+			}
+		})
+	}
+}
+
+func TestToChatRequest(t *testing.T) {
+	req := &blades.ModelRequest{
+		Messages: []*blades.Message{
+			{
+				Role: blades.RoleAssistant,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Paris"}`},
+					{ID: "call_2", Name: "get_time"},
+				},
+			},
+			{
+				Role: blades.RoleTool,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Result: "Sunny"},
+					{ID: "call_2", Name: "get_time", Result: "12:00"},
+				},
+			},
+		},
+	}
+	params, err := toChatRequest(req, blades.ModelOptions{}, false)
+	if err != nil {
+		t.Fatalf("toChatRequest() error = %v", err)
+	}
+	if len(params.Messages) != 3 {
+		t.Fatalf("toChatRequest() returned %d messages, want 3", len(params.Messages))
+	}
+	if calls := params.Messages[0].ToolCalls; len(calls) != 2 || string(calls[1].Function.Arguments) != "{}" {
+		t.Errorf("assistant tool calls = %+v", calls)
+	}
+	if m := params.Messages[2]; m.Role != "tool" || m.ToolName != "get_time" || m.Content != "12:00" {
+		t.Errorf("tool message = %+v", m)
+	}
+	if params.Options != nil || params.KeepAlive != "" {
+		t.Errorf("toChatRequest() options = %v, keep_alive = %q, want unset", params.Options, params.KeepAlive)
+	}
+}
+
+func TestError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"model \"missing\" not found, try pulling it first"}`))
+	}))
+	defer server.Close()
+	provider := NewChatProvider(WithBaseURL(server.URL))
+	_, err := provider.Generate(context.Background(), &blades.ModelRequest{Model: "missing"})
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("Generate() error = %v, want *Error with status 404", err)
+	}
+	if !errors.Is(err, blades.ErrInvalidRequest) {
+		t.Errorf("Generate() error = %v, want %v", err, blades.ErrInvalidRequest)
+	}
+}
+
+func TestToChatRequestResponseFormat(t *testing.T) {
+	schema := &jsonschema.Schema{
+		Type:       "object",
+		Properties: map[string]*jsonschema.Schema{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}
+	req := &blades.ModelRequest{Model: "llama3.2", Messages: []*blades.Message{blades.UserMessage("Where is the Eiffel Tower?")}}
+	params, err := toChatRequest(req, blades.ModelOptions{ResponseFormat: &blades.ResponseFormat{Name: "place", Schema: schema}}, false)
+	if err != nil {
+		t.Fatalf("toChatRequest() error = %v", err)
+	}
+	b, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatal(err)
+	}
+	format, ok := body["format"].(map[string]any)
+	if !ok || format["type"] != "object" || format["required"].([]any)[0] != "city" {
+		t.Errorf("format = %v, want the schema", body["format"])
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/go-kratos/blades/contrib/ollama
+
+go 1.24
+
+require (
+	github.com/go-kratos/blades v0.0.0-20250928061855-93360cba17ff
+	github.com/google/jsonschema-go v0.2.3
+)
+
+require github.com/google/uuid v1.6.0 // indirect
+
+replace github.com/go-kratos/blades => ../../
@@ -0,0 +1,51 @@
+package ollama
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+const (
+	// ExtensionKeepAlive is the ModelOptions extension key for the keep_alive duration.
+	ExtensionKeepAlive = "ollama.keep_alive"
+	// ExtensionNumCtx is the ModelOptions extension key for the num_ctx runtime option.
+	ExtensionNumCtx = "ollama.num_ctx"
+	// ExtensionOptions is the ModelOptions extension key for additional runtime options.
+	ExtensionOptions = "ollama.options"
+)
+
+// Option configures the ChatProvider.
+type Option func(*ChatProvider)
+
+// WithBaseURL sets the server base URL, such as http://localhost:11434.
+func WithBaseURL(url string) Option {
+	return func(p *ChatProvider) {
+		p.baseURL = url
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to call the server.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *ChatProvider) {
+		p.client = client
+	}
+}
+
+// KeepAlive sets how long the model stays loaded in memory after the request,
+// a negative duration keeps it loaded indefinitely and zero unloads it immediately.
+func KeepAlive(d time.Duration) blades.ModelOption {
+	return blades.Extension(ExtensionKeepAlive, d)
+}
+
+// NumCtx sets the context window size, in tokens, used to load the model.
+func NumCtx(n int) blades.ModelOption {
+	return blades.Extension(ExtensionNumCtx, n)
+}
+
+// Options sets additional runtime options such as seed, top_k or num_gpu,
+// see the Ollama Modelfile documentation for the supported keys.
+func Options(options map[string]any) blades.ModelOption {
+	return blades.Extension(ExtensionOptions, options)
+}
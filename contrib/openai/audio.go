@@ -69,7 +69,7 @@ func (p *AudioProvider) Generate(ctx context.Context, req *blades.ModelRequest,
 
 	resp, err := p.client.Audio.Speech.New(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, toError(err)
 	}
 	defer resp.Body.Close()
 
@@ -6,21 +6,20 @@ import (
 	"encoding/json"
 	"errors"
 	"log"
+	"net/http"
+	"strings"
 
 	"github.com/go-kratos/blades"
 	"github.com/openai/openai-go/v2"
 	"github.com/openai/openai-go/v2/option"
 	"github.com/openai/openai-go/v2/packages/param"
+	"github.com/openai/openai-go/v2/packages/respjson"
 	"github.com/openai/openai-go/v2/shared"
 )
 
 var (
 	// ErrEmptyResponse indicates the provider returned no choices.
 	ErrEmptyResponse = errors.New("empty completion response")
-	// ErrToolNotFound indicates a tool call was made to an unknown tool.
-	ErrToolNotFound = errors.New("tool not found")
-	// ErrTooManyIterations indicates the max iterations option is less than 1.
-	ErrTooManyIterations = errors.New("too many iterations requested")
 )
 
 // ChatProvider implements blades.ModelProvider for OpenAI-compatible chat models.
@@ -35,38 +34,38 @@ func NewChatProvider(opts ...option.RequestOption) blades.ModelProvider {
 	return &ChatProvider{client: openai.NewClient(opts...)}
 }
 
-// New executes a non-streaming chat completion request.
-func (p *ChatProvider) New(ctx context.Context,
-	params openai.ChatCompletionNewParams, tools []*blades.Tool, opts blades.ModelOptions) (*blades.ModelResponse, error) {
-	// Ensure we have at least one iteration left.
-	if opts.MaxIterations < 1 {
-		return nil, ErrTooManyIterations
+// SupportsResponseFormat reports that the ResponseFormat is sent as a json_schema response format.
+func (p *ChatProvider) SupportsResponseFormat() bool {
+	return true
+}
+
+// Generate executes a non-streaming chat completion request.
+func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
 	}
-	chatResponse, err := p.client.Chat.Completions.New(ctx, params)
+	params, err := toChatCompletionParams(req, opt)
 	if err != nil {
 		return nil, err
 	}
-	res, err := choiceToResponse(ctx, &params, tools, chatResponse.Choices)
+	chatResponse, err := p.client.Chat.Completions.New(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, toError(err)
 	}
-	for _, msg := range res.Messages {
-		switch msg.Role {
-		case blades.RoleTool:
-			if len(msg.ToolCalls) == 0 {
-				continue
-			}
-			// Recursively call Execute to handle multiple tool calls.
-			opts.MaxIterations--
-			return p.New(ctx, params, tools, opts)
-		}
+	res, err := choiceToResponse(chatResponse.Choices)
+	if err != nil {
+		return nil, err
 	}
+	res.Usage = toUsage(chatResponse.Usage)
 	return res, nil
 }
 
-// Generate executes a non-streaming chat completion request.
-func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
-	opt := blades.ModelOptions{MaxIterations: 3}
+// NewStream streams chat completion chunks and converts each choice delta
+// into a ModelResponse for incremental consumption. The accumulated completion
+// is sent as the last response of the stream.
+func (p *ChatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	opt := blades.ModelOptions{}
 	for _, apply := range opts {
 		apply(&opt)
 	}
@@ -74,80 +73,54 @@ func (p *ChatProvider) Generate(ctx context.Context, req *blades.ModelRequest, o
 	if err != nil {
 		return nil, err
 	}
-	return p.New(ctx, params, req.Tools, opt)
-}
-
-// NewStreaming executes a streaming chat completion request.
-func (p *ChatProvider) NewStreaming(ctx context.Context,
-	params openai.ChatCompletionNewParams, tools []*blades.Tool, opts blades.ModelOptions) (blades.Streamer[*blades.ModelResponse], error) {
-	// Ensure we have at least one iteration left.
-	if opts.MaxIterations < 1 {
-		return nil, ErrTooManyIterations
-	}
+	params.StreamOptions.IncludeUsage = param.NewOpt(true)
 	stream := p.client.Chat.Completions.NewStreaming(ctx, params)
 	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
 	pipe.Go(func() error {
 		defer stream.Close()
 		acc := openai.ChatCompletionAccumulator{}
+		// The accumulator does not know reasoning_content, so it is accumulated per choice index.
+		reasoning := make(map[int64]string)
+		var usage *blades.Usage
 		for stream.Next() {
 			chunk := stream.Current()
 			acc.AddChunk(chunk)
-			res, err := chunkChoiceToResponse(ctx, tools, chunk.Choices)
+			// With include_usage the usage is sent in a last chunk without choices.
+			if u := toUsage(chunk.Usage); u != nil {
+				usage = u
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			for _, choice := range chunk.Choices {
+				reasoning[choice.Index] += reasoningContent(choice.Delta.JSON.ExtraFields)
+			}
+			res, err := chunkChoiceToResponse(chunk.Choices)
 			if err != nil {
 				return err
 			}
 			pipe.Send(res)
 		}
-		lastResponse, err := choiceToResponse(ctx, &params, tools, acc.ChatCompletion.Choices)
+		if err := stream.Err(); err != nil {
+			return toError(err)
+		}
+		lastResponse, err := choiceToResponse(acc.ChatCompletion.Choices)
 		if err != nil {
 			return err
 		}
-		pipe.Send(lastResponse)
-		for _, msg := range lastResponse.Messages {
-			switch msg.Role {
-			case blades.RoleTool:
-				if len(msg.ToolCalls) == 0 {
-					continue
-				}
-				// Recursively call Execute to handle multiple tool calls.
-				opts.MaxIterations--
-				toolStream, err := p.NewStreaming(ctx, params, tools, opts)
-				if err != nil {
-					return err
-				}
-				for toolStream.Next() {
-					res, err := toolStream.Current()
-					if err != nil {
-						return err
-					}
-					pipe.Send(res)
-				}
+		for i, choice := range acc.ChatCompletion.Choices {
+			if text := reasoning[choice.Index]; text != "" {
+				msg := lastResponse.Messages[i]
+				msg.Parts = append([]blades.Part{blades.ReasoningPart{Text: text}}, msg.Parts...)
 			}
 		}
+		lastResponse.Usage = usage
+		pipe.Send(lastResponse)
 		return nil
 	})
 	return pipe, nil
 }
 
-// NewStream streams chat completion chunks and converts each choice delta
-// into a ModelResponse for incremental consumption.
-func (p *ChatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
-	opt := blades.ModelOptions{MaxIterations: 3}
-	for _, apply := range opts {
-		apply(&opt)
-	}
-	if opt.MaxIterations > 0 {
-		opts = append(opts, blades.MaxIterations(opt.MaxIterations-1))
-	} else {
-		return nil, ErrTooManyIterations
-	}
-	params, err := toChatCompletionParams(req, opt)
-	if err != nil {
-		return nil, err
-	}
-	return p.NewStreaming(ctx, params, req.Tools, opt)
-}
-
 // toChatCompletionParams converts a generic model request into OpenAI params.
 func toChatCompletionParams(req *blades.ModelRequest, opt blades.ModelOptions) (openai.ChatCompletionNewParams, error) {
 	tools, err := toTools(req.Tools)
@@ -171,20 +144,101 @@ func toChatCompletionParams(req *blades.ModelRequest, opt blades.ModelOptions) (
 	if opt.ReasoningEffort != "" {
 		params.ReasoningEffort = shared.ReasoningEffort(opt.ReasoningEffort)
 	}
+	if opt.ResponseFormat != nil {
+		format, err := toResponseFormat(opt.ResponseFormat)
+		if err != nil {
+			return openai.ChatCompletionNewParams{}, err
+		}
+		params.ResponseFormat = format
+	}
 	for _, msg := range req.Messages {
-		log.Println("Processing message:", msg.Role, msg.Parts)
 		switch msg.Role {
 		case blades.RoleUser:
 			params.Messages = append(params.Messages, openai.UserMessage(toContentParts(msg)))
 		case blades.RoleAssistant:
-			params.Messages = append(params.Messages, openai.UserMessage(toContentParts(msg)))
+			params.Messages = append(params.Messages, toAssistantMessage(msg))
 		case blades.RoleSystem:
 			params.Messages = append(params.Messages, openai.SystemMessage(toTextParts(msg)))
+		case blades.RoleTool:
+			for _, call := range msg.ToolCalls {
+				params.Messages = append(params.Messages, openai.ToolMessage(call.Result, call.ID))
+			}
 		}
 	}
 	return params, nil
 }
 
+// toResponseFormat converts a response format to a json_schema response format. It is strict,
+// so that the model output is guaranteed to match, when the schema meets the requirements of
+// strict mode.
+func toResponseFormat(format *blades.ResponseFormat) (openai.ChatCompletionNewParamsResponseFormatUnion, error) {
+	b, err := json.Marshal(format.Schema)
+	if err != nil {
+		return openai.ChatCompletionNewParamsResponseFormatUnion{}, err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(b, &schema); err != nil {
+		return openai.ChatCompletionNewParamsResponseFormatUnion{}, err
+	}
+	name := format.Name
+	if name == "" {
+		name = "response"
+	}
+	return openai.ChatCompletionNewParamsResponseFormatUnion{
+		OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+			JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+				Name:   name,
+				Schema: schema,
+				Strict: param.NewOpt(isStrictSchema(schema)),
+			},
+		},
+	}, nil
+}
+
+// isStrictSchema reports whether a schema can be used in strict mode, which requires every
+// object to list all of its properties as required and to disallow additional properties.
+func isStrictSchema(schema map[string]any) bool {
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		if additional, ok := schema["additionalProperties"].(bool); !ok || additional {
+			return false
+		}
+		required := make(map[string]bool)
+		if names, ok := schema["required"].([]any); ok {
+			for _, name := range names {
+				if s, ok := name.(string); ok {
+					required[s] = true
+				}
+			}
+		}
+		for name, property := range properties {
+			sub, ok := property.(map[string]any)
+			if !required[name] || !ok || !isStrictSchema(sub) {
+				return false
+			}
+		}
+	}
+	if items, ok := schema["items"].(map[string]any); ok && !isStrictSchema(items) {
+		return false
+	}
+	for _, key := range []string{"anyOf", "$defs"} {
+		var subs []any
+		switch v := schema[key].(type) {
+		case []any:
+			subs = v
+		case map[string]any:
+			for _, sub := range v {
+				subs = append(subs, sub)
+			}
+		}
+		for _, sub := range subs {
+			if s, ok := sub.(map[string]any); ok && !isStrictSchema(s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func toTools(tools []*blades.Tool) ([]openai.ChatCompletionToolUnionParam, error) {
 	if len(tools) == 0 {
 		return nil, nil
@@ -228,6 +282,30 @@ func toTextParts(message *blades.Message) []openai.ChatCompletionContentPartText
 	return parts
 }
 
+// toAssistantMessage converts an assistant message and its tool calls to an OpenAI assistant message.
+func toAssistantMessage(message *blades.Message) openai.ChatCompletionMessageParamUnion {
+	assistant := openai.ChatCompletionAssistantMessageParam{}
+	if parts := toTextParts(message); len(parts) > 0 {
+		texts := make([]string, 0, len(parts))
+		for _, part := range parts {
+			texts = append(texts, part.Text)
+		}
+		assistant.Content.OfString = param.NewOpt(strings.Join(texts, "\n"))
+	}
+	for _, call := range message.ToolCalls {
+		assistant.ToolCalls = append(assistant.ToolCalls, openai.ChatCompletionMessageToolCallUnionParam{
+			OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+				ID: call.ID,
+				Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+					Name:      call.Name,
+					Arguments: call.Arguments,
+				},
+			},
+		})
+	}
+	return openai.ChatCompletionMessageParamUnion{OfAssistant: &assistant}
+}
+
 // toContentParts converts message parts to OpenAI content parts (multi-modal user input).
 func toContentParts(message *blades.Message) []openai.ChatCompletionContentPartUnionParam {
 	parts := make([]openai.ChatCompletionContentPartUnionParam, 0, len(message.Parts))
@@ -276,45 +354,8 @@ func toContentParts(message *blades.Message) []openai.ChatCompletionContentPartU
 	return parts
 }
 
-// toolCall invokes a tool by name with the given arguments.
-func toolCall(ctx context.Context, tools []*blades.Tool, name, arguments string) (string, error) {
-	for _, tool := range tools {
-		if tool.Name == name {
-			return tool.Handle(ctx, arguments)
-		}
-	}
-	return "", ErrToolNotFound
-}
-
-func choiceToToolCalls(ctx context.Context, tools []*blades.Tool, choices []openai.ChatCompletionChoice) (*blades.ModelResponse, error) {
-	res := &blades.ModelResponse{}
-	for _, choice := range choices {
-		msg := &blades.Message{
-			Role:   blades.RoleTool,
-			Status: blades.StatusCompleted,
-		}
-		if len(choice.Message.ToolCalls) > 0 {
-			for _, call := range choice.Message.ToolCalls {
-				result, err := toolCall(ctx, tools, call.Function.Name, call.Function.Arguments)
-				if err != nil {
-					return nil, err
-				}
-				msg.Role = blades.RoleTool
-				msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
-					ID:        call.ID,
-					Name:      call.Function.Name,
-					Arguments: call.Function.Arguments,
-					Result:    result,
-				})
-			}
-		}
-		res.Messages = append(res.Messages, msg)
-	}
-	return res, nil
-}
-
 // choiceToResponse converts a non-streaming choice to a ModelResponse.
-func choiceToResponse(ctx context.Context, params *openai.ChatCompletionNewParams, tools []*blades.Tool, choices []openai.ChatCompletionChoice) (*blades.ModelResponse, error) {
+func choiceToResponse(choices []openai.ChatCompletionChoice) (*blades.ModelResponse, error) {
 	res := &blades.ModelResponse{}
 	for _, choice := range choices {
 		msg := &blades.Message{
@@ -322,6 +363,9 @@ func choiceToResponse(ctx context.Context, params *openai.ChatCompletionNewParam
 			Status:   blades.StatusCompleted,
 			Metadata: map[string]string{},
 		}
+		if text := reasoningContent(choice.Message.JSON.ExtraFields); text != "" {
+			msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: text})
+		}
 		if choice.Message.Content != "" {
 			msg.Parts = append(msg.Parts, blades.TextPart{Text: choice.Message.Content})
 		}
@@ -338,23 +382,12 @@ func choiceToResponse(ctx context.Context, params *openai.ChatCompletionNewParam
 		if choice.FinishReason != "" {
 			msg.Metadata["finish_reason"] = choice.FinishReason
 		}
-		if len(choice.Message.ToolCalls) > 0 {
-			// If there is a was a function call, continue the conversation
-			params.Messages = append(params.Messages, choice.Message.ToParam())
-		}
 		for _, call := range choice.Message.ToolCalls {
-			result, err := toolCall(ctx, tools, call.Function.Name, call.Function.Arguments)
-			if err != nil {
-				return nil, err
-			}
-			msg.Role = blades.RoleTool
 			msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
 				ID:        call.ID,
 				Name:      call.Function.Name,
 				Arguments: call.Function.Arguments,
-				Result:    result,
 			})
-			params.Messages = append(params.Messages, openai.ToolMessage(result, call.ID))
 		}
 		res.Messages = append(res.Messages, msg)
 	}
@@ -362,7 +395,7 @@ func choiceToResponse(ctx context.Context, params *openai.ChatCompletionNewParam
 }
 
 // chunkChoiceToResponse converts a streaming chunk choice to a ModelResponse.
-func chunkChoiceToResponse(ctx context.Context, tools []*blades.Tool, choices []openai.ChatCompletionChunkChoice) (*blades.ModelResponse, error) {
+func chunkChoiceToResponse(choices []openai.ChatCompletionChunkChoice) (*blades.ModelResponse, error) {
 	res := &blades.ModelResponse{}
 	for _, choice := range choices {
 		msg := &blades.Message{
@@ -370,6 +403,9 @@ func chunkChoiceToResponse(ctx context.Context, tools []*blades.Tool, choices []
 			Status:   blades.StatusIncomplete,
 			Metadata: map[string]string{},
 		}
+		if text := reasoningContent(choice.Delta.JSON.ExtraFields); text != "" {
+			msg.Parts = append(msg.Parts, blades.ReasoningPart{Text: text})
+		}
 		if choice.Delta.Content != "" {
 			msg.Parts = append(msg.Parts, blades.TextPart{Text: choice.Delta.Content})
 		}
@@ -380,7 +416,6 @@ func chunkChoiceToResponse(ctx context.Context, tools []*blades.Tool, choices []
 			msg.Metadata["finish_reason"] = choice.FinishReason
 		}
 		for _, call := range choice.Delta.ToolCalls {
-			msg.Role = blades.RoleTool
 			msg.ToolCalls = append(msg.ToolCalls, &blades.ToolCall{
 				ID:        call.ID,
 				Name:      call.Function.Name,
@@ -391,3 +426,44 @@ func chunkChoiceToResponse(ctx context.Context, tools []*blades.Tool, choices []
 	}
 	return res, nil
 }
+
+// reasoningContent returns the reasoning_content field that DeepSeek and Qwen style models
+// return next to the content, it is not part of the OpenAI schema.
+func reasoningContent(fields map[string]respjson.Field) string {
+	field, ok := fields["reasoning_content"]
+	if !ok {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal([]byte(field.Raw()), &text); err != nil {
+		return ""
+	}
+	return text
+}
+
+// toUsage converts the token usage of a completion, it returns nil when no usage was reported.
+func toUsage(usage openai.CompletionUsage) *blades.Usage {
+	if usage.TotalTokens == 0 && usage.PromptTokens == 0 && usage.CompletionTokens == 0 {
+		return nil
+	}
+	return &blades.Usage{
+		InputTokens:       usage.PromptTokens,
+		OutputTokens:      usage.CompletionTokens,
+		TotalTokens:       usage.TotalTokens,
+		ReasoningTokens:   usage.CompletionTokensDetails.ReasoningTokens,
+		CachedInputTokens: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+// toError classifies OpenAI API errors into blades.ModelError, other errors are returned unchanged.
+func toError(err error) error {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	var header http.Header
+	if apiErr.Response != nil {
+		header = apiErr.Response.Header
+	}
+	return blades.NewModelError(apiErr.StatusCode, header, err)
+}
@@ -0,0 +1,292 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/bladestest"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// newTestProvider starts a stand-in chat completions server that replays the given testdata file.
+func newTestProvider(t *testing.T, file, contentType string) blades.ModelProvider {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/completions" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return NewChatProvider(
+		option.WithBaseURL(server.URL),
+		option.WithAPIKey("test"),
+		option.WithMaxRetries(0),
+	)
+}
+
+func TestGenerateReasoning(t *testing.T) {
+	provider := newTestProvider(t, "testdata/chat_reasoning.json", "application/json")
+	req := &blades.ModelRequest{
+		Model:    "deepseek-reasoner",
+		Messages: []*blades.Message{blades.UserMessage("Which is smaller, 9.11 or 9.8?")},
+	}
+	res, err := provider.Generate(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	msg := res.Messages[0]
+	if msg.Reasoning() != "Compare the decimals: 0.11 < 0.8." {
+		t.Errorf("Generate() reasoning = %q", msg.Reasoning())
+	}
+	if msg.Text() != "9.11 is smaller than 9.8." {
+		t.Errorf("Generate() text = %q", msg.Text())
+	}
+	want := blades.Usage{InputTokens: 20, OutputTokens: 30, TotalTokens: 50, ReasoningTokens: 18, CachedInputTokens: 8}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Generate() usage = %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestNewStreamReasoning(t *testing.T) {
+	provider := newTestProvider(t, "testdata/stream_reasoning.sse", "text/event-stream")
+	req := &blades.ModelRequest{
+		Model:    "deepseek-reasoner",
+		Messages: []*blades.Message{blades.UserMessage("Which is smaller, 9.11 or 9.8?")},
+	}
+	stream, err := provider.NewStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	defer stream.Close()
+	var (
+		reasoning string
+		last      *blades.ModelResponse
+	)
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		if msg := res.Messages[0]; msg.Status == blades.StatusIncomplete {
+			reasoning += msg.Reasoning()
+		}
+		last = res
+	}
+	if reasoning != "Compare the decimals." {
+		t.Errorf("streamed reasoning = %q", reasoning)
+	}
+	msg := last.Messages[0]
+	if msg.Status != blades.StatusCompleted || msg.Reasoning() != "Compare the decimals." || msg.Text() != "9.11 is smaller." {
+		t.Errorf("last message = %q (reasoning %q, %s)", msg.Text(), msg.Reasoning(), msg.Status)
+	}
+	want := blades.Usage{InputTokens: 20, OutputTokens: 12, TotalTokens: 32, ReasoningTokens: 5}
+	if last.Usage == nil || *last.Usage != want {
+		t.Errorf("last usage = %+v, want %+v", last.Usage, want)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		want       error
+		retryAfter time.Duration
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{"error":{"message":"Rate limit reached","type":"requests","code":"rate_limit_exceeded"}}`, want: blades.ErrRateLimited, retryAfter: 2 * time.Second},
+		{name: "context length", status: http.StatusBadRequest, body: `{"error":{"message":"This model's maximum context length is 128000 tokens.","type":"invalid_request_error","code":"context_length_exceeded"}}`, want: blades.ErrContextWindowExceeded},
+		{name: "authentication", status: http.StatusUnauthorized, body: `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`, want: blades.ErrAuthentication},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter > 0 {
+					w.Header().Set("Retry-After", "2")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			provider := NewChatProvider(option.WithBaseURL(server.URL), option.WithAPIKey("test"), option.WithMaxRetries(0))
+			_, err := provider.Generate(context.Background(), &blades.ModelRequest{
+				Model:    "gpt-4o",
+				Messages: []*blades.Message{blades.UserMessage("Hi")},
+			})
+			var modelErr *blades.ModelError
+			if !errors.Is(err, tt.want) || !errors.As(err, &modelErr) {
+				t.Fatalf("Generate() error = %v, want %v", err, tt.want)
+			}
+			if modelErr.StatusCode != tt.status || modelErr.RetryAfter != tt.retryAfter {
+				t.Errorf("Generate() error status = %d, retry after %v", modelErr.StatusCode, modelErr.RetryAfter)
+			}
+		})
+	}
+}
+
+// record makes newCassetteProvider record the cassettes against the real API, authenticated
+// with OPENAI_API_KEY.
+var record = flag.Bool("record", false, "record cassettes against the real API instead of replaying them")
+
+// newCassetteProvider returns a provider replaying the named cassette of testdata/cassettes,
+// or recording it when the tests run with -record.
+// A request that toChatCompletionParams no longer builds as recorded matches no interaction.
+func newCassetteProvider(t *testing.T, name string) blades.ModelProvider {
+	t.Helper()
+	key := "test"
+	var opts []bladestest.RecorderOption
+	if *record {
+		if key = os.Getenv("OPENAI_API_KEY"); key == "" {
+			t.Fatal("OPENAI_API_KEY must be set to record cassettes")
+		}
+		opts = append(opts, bladestest.WithMode(bladestest.ModeRecord), bladestest.WithSecrets(key))
+	}
+	recorder := bladestest.NewRecorder(t, "testdata/cassettes/"+name+".json", opts...)
+	return NewChatProvider(
+		option.WithHTTPClient(recorder.Client()),
+		option.WithAPIKey(key),
+		option.WithMaxRetries(0),
+	)
+}
+
+func weatherTool() *blades.Tool {
+	return &blades.Tool{
+		Name:        "get_weather",
+		Description: "Get the current weather of a city.",
+		InputSchema: &jsonschema.Schema{
+			Type:       "object",
+			Properties: map[string]*jsonschema.Schema{"location": {Type: "string"}},
+			Required:   []string{"location"},
+		},
+	}
+}
+
+func TestCassetteGenerateToolResult(t *testing.T) {
+	provider := newCassetteProvider(t, "generate_tool_result")
+	call := &blades.Message{Role: blades.RoleAssistant, ToolCalls: []*blades.ToolCall{{ID: "call_Qm4rT8", Name: "get_weather", Arguments: `{"location":"Paris"}`}}}
+	result := &blades.Message{Role: blades.RoleTool, ToolCalls: []*blades.ToolCall{{ID: "call_Qm4rT8", Name: "get_weather", Result: "Sunny, 22°C"}}}
+	req := &blades.ModelRequest{
+		Model: "gpt-4o",
+		Tools: []*blades.Tool{weatherTool()},
+		Messages: []*blades.Message{
+			blades.SystemMessage("You are a weather assistant."),
+			blades.UserMessage("What is the weather in Paris?"),
+			call,
+			result,
+		},
+	}
+	res, err := provider.Generate(context.Background(), req, blades.Temperature(0.2), blades.MaxOutputTokens(256))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	msg := res.Messages[0]
+	if msg.Text() != "It is sunny and 22°C in Paris." || msg.Metadata["finish_reason"] != "stop" {
+		t.Errorf("Generate() = %q (finish reason %q)", msg.Text(), msg.Metadata["finish_reason"])
+	}
+	want := blades.Usage{InputTokens: 96, OutputTokens: 12, TotalTokens: 108}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Generate() usage = %+v, want %+v", res.Usage, want)
+	}
+}
+
+func TestCassetteStreamToolCall(t *testing.T) {
+	provider := newCassetteProvider(t, "stream_tool_call")
+	req := &blades.ModelRequest{
+		Model:    "gpt-4o",
+		Tools:    []*blades.Tool{weatherTool()},
+		Messages: []*blades.Message{blades.UserMessage("What is the weather in Paris?")},
+	}
+	stream, err := provider.NewStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	defer stream.Close()
+	var (
+		arguments string
+		last      *blades.ModelResponse
+	)
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		if msg := res.Messages[0]; msg.Status == blades.StatusIncomplete {
+			for _, call := range msg.ToolCalls {
+				arguments += call.Arguments
+			}
+		}
+		last = res
+	}
+	if arguments != `{"location": "Paris"}` {
+		t.Errorf("streamed arguments = %q", arguments)
+	}
+	msg := last.Messages[0]
+	if msg.Status != blades.StatusCompleted || len(msg.ToolCalls) != 1 || msg.Metadata["finish_reason"] != "tool_calls" {
+		t.Fatalf("last message = %+v", msg)
+	}
+	if call := msg.ToolCalls[0]; call.ID != "call_Qm4rT8" || call.Name != "get_weather" || call.Arguments != `{"location": "Paris"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	want := blades.Usage{InputTokens: 71, OutputTokens: 15, TotalTokens: 86}
+	if last.Usage == nil || *last.Usage != want {
+		t.Errorf("last usage = %+v, want %+v", last.Usage, want)
+	}
+}
+
+func TestToChatCompletionParamsResponseFormat(t *testing.T) {
+	type city struct {
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases,omitempty"`
+	}
+	type place struct {
+		Name string `json:"name"`
+	}
+	strict, err := jsonschema.For[place](nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	optional, err := jsonschema.For[city](nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		schema *jsonschema.Schema
+		want   string
+	}{
+		{name: "strict", schema: strict, want: `{"json_schema":{"name":"place","strict":true,"schema":{"additionalProperties":false,"properties":{"name":{"type":"string"}},"required":["name"],"type":"object"}},"type":"json_schema"}`},
+		{name: "optional properties", schema: optional, want: `{"json_schema":{"name":"place","strict":false,"schema":{"additionalProperties":false,"properties":{"aliases":{"items":{"type":"string"},"type":"array"},"name":{"type":"string"}},"required":["name"],"type":"object"}},"type":"json_schema"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &blades.ModelRequest{Model: "gpt-4o", Messages: []*blades.Message{blades.UserMessage("Paris")}}
+			params, err := toChatCompletionParams(req, blades.ModelOptions{ResponseFormat: &blades.ResponseFormat{Name: "place", Schema: tt.schema}})
+			if err != nil {
+				t.Fatalf("toChatCompletionParams() error = %v", err)
+			}
+			b, err := json.Marshal(params.ResponseFormat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("response_format = %s, want %s", b, tt.want)
+			}
+		})
+	}
+}
@@ -4,11 +4,11 @@ go 1.24
 
 require (
 	github.com/go-kratos/blades v0.0.0-20250928061855-93360cba17ff
+	github.com/google/jsonschema-go v0.3.0
 	github.com/openai/openai-go/v2 v2.7.0
 )
 
 require (
-	github.com/google/jsonschema-go v0.3.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/tidwall/gjson v1.18.0 // indirect
 	github.com/tidwall/match v1.2.0 // indirect
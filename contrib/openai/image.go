@@ -50,7 +50,7 @@ func (p *ImageProvider) Generate(ctx context.Context, req *blades.ModelRequest,
 	applyImageOptions(&params, req.Model, modelOpts.Image)
 	res, err := p.client.Images.Generate(ctx, params)
 	if err != nil {
-		return nil, err
+		return nil, toError(err)
 	}
 	return toImageResponse(res)
 }
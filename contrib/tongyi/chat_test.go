@@ -2,10 +2,15 @@ package tongyi
 
 import (
 	"context"
+	"flag"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/bladestest"
 	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/openai/openai-go/v2/option"
 )
 
 func TestNewChatProvider(t *testing.T) {
@@ -339,61 +344,161 @@ func TestToTextParts(t *testing.T) {
 	}
 }
 
-func TestToolCall(t *testing.T) {
-	tools := []*blades.Tool{
-		{
-			Name: "test_tool",
-			Handle: func(ctx context.Context, args string) (string, error) {
-				return "test result", nil
+func TestToChatCompletionParamsToolMessages(t *testing.T) {
+	req := &blades.ModelRequest{
+		Model: QwenTurbo,
+		Messages: []*blades.Message{
+			blades.UserMessage("What is the weather in Hangzhou?"),
+			{
+				Role: blades.RoleAssistant,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Hangzhou"}`},
+				},
 			},
-		},
-		{
-			Name: "another_tool",
-			Handle: func(ctx context.Context, args string) (string, error) {
-				return "another result", nil
+			{
+				Role: blades.RoleTool,
+				ToolCalls: []*blades.ToolCall{
+					{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Hangzhou"}`, Result: "Sunny"},
+				},
 			},
 		},
 	}
+	params, err := toChatCompletionParams(req, blades.ModelOptions{})
+	if err != nil {
+		t.Fatalf("toChatCompletionParams() error = %v", err)
+	}
+	if len(params.Messages) != 3 {
+		t.Fatalf("toChatCompletionParams() returned %d messages, want 3", len(params.Messages))
+	}
+	assistant := params.Messages[1].OfAssistant
+	if assistant == nil || len(assistant.ToolCalls) != 1 || assistant.ToolCalls[0].OfFunction.ID != "call_1" {
+		t.Errorf("toChatCompletionParams() assistant tool calls = %+v", assistant)
+	}
+	tool := params.Messages[2].OfTool
+	if tool == nil || tool.ToolCallID != "call_1" || tool.Content.OfString.Value != "Sunny" {
+		t.Errorf("toChatCompletionParams() tool message = %+v", tool)
+	}
+}
 
-	tests := []struct {
-		name        string
-		toolName    string
-		args        string
-		expected    string
-		expectedErr error
-	}{
-		{
-			name:        "valid tool call",
-			toolName:    "test_tool",
-			args:        "test args",
-			expected:    "test result",
-			expectedErr: nil,
-		},
-		{
-			name:        "another valid tool call",
-			toolName:    "another_tool",
-			args:        "test args",
-			expected:    "another result",
-			expectedErr: nil,
-		},
-		{
-			name:        "tool not found",
-			toolName:    "nonexistent_tool",
-			args:        "test args",
-			expected:    "",
-			expectedErr: ErrToolNotFound,
+// record makes newCassetteProvider record the cassettes against the real API, authenticated
+// with DASHSCOPE_API_KEY.
+var record = flag.Bool("record", false, "record cassettes against the real API instead of replaying them")
+
+// newCassetteProvider returns a provider replaying the named cassette of testdata/cassettes,
+// or recording it when the tests run with -record.
+// A request that toChatCompletionParams no longer builds as recorded matches no interaction.
+func newCassetteProvider(t *testing.T, name string) blades.ModelProvider {
+	t.Helper()
+	key := "test"
+	var opts []bladestest.RecorderOption
+	if *record {
+		if key = os.Getenv("DASHSCOPE_API_KEY"); key == "" {
+			t.Fatal("DASHSCOPE_API_KEY must be set to record cassettes")
+		}
+		opts = append(opts, bladestest.WithMode(bladestest.ModeRecord), bladestest.WithSecrets(key))
+	}
+	recorder := bladestest.NewRecorder(t, "testdata/cassettes/"+name+".json", opts...)
+	return NewChatProviderWithOptions(
+		option.WithHTTPClient(recorder.Client()),
+		option.WithAPIKey(key),
+		option.WithMaxRetries(0),
+	)
+}
+
+func TestCassetteGenerateToolCall(t *testing.T) {
+	provider := newCassetteProvider(t, "generate_tool_call")
+	req := &blades.ModelRequest{
+		Model: QwenPlus,
+		Tools: []*blades.Tool{{
+			Name:        "get_weather",
+			Description: "Get the current weather of a city.",
+			InputSchema: &jsonschema.Schema{
+				Type:       "object",
+				Properties: map[string]*jsonschema.Schema{"location": {Type: "string"}},
+				Required:   []string{"location"},
+			},
+		}},
+		Messages: []*blades.Message{
+			blades.SystemMessage("You are a weather assistant."),
+			blades.UserMessage("杭州天气怎么样？"),
 		},
 	}
+	res, err := provider.Generate(context.Background(), req, blades.TopP(0.8))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	msg := res.Messages[0]
+	if len(msg.ToolCalls) != 1 || msg.Metadata["finish_reason"] != "tool_calls" {
+		t.Fatalf("Generate() message = %+v", msg)
+	}
+	if call := msg.ToolCalls[0]; call.ID != "call_2b7f0d1c9e4a4f6b8a3c5d" || call.Name != "get_weather" || call.Arguments != `{"location": "Hangzhou"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	want := blades.Usage{InputTokens: 184, OutputTokens: 19, TotalTokens: 203}
+	if res.Usage == nil || *res.Usage != want {
+		t.Errorf("Generate() usage = %+v, want %+v", res.Usage, want)
+	}
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			result, err := toolCall(context.Background(), tools, tt.toolName, tt.args)
-			if err != tt.expectedErr {
-				t.Errorf("toolCall() error = %v, wantErr %v", err, tt.expectedErr)
-			}
-			if result != tt.expected {
-				t.Errorf("toolCall() result = %v, want %v", result, tt.expected)
-			}
-		})
+func TestCassetteStreamReasoning(t *testing.T) {
+	provider := newCassetteProvider(t, "stream_reasoning")
+	req := &blades.ModelRequest{
+		Model:    QwenPlus,
+		Messages: []*blades.Message{blades.UserMessage("Which is smaller, 9.11 or 9.8?")},
+	}
+	stream, err := provider.NewStream(context.Background(), req, blades.MaxOutputTokens(512))
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	defer stream.Close()
+	var (
+		reasoning string
+		text      string
+		last      *blades.ModelResponse
+	)
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		if msg := res.Messages[0]; msg.Status == blades.StatusIncomplete {
+			reasoning += msg.Reasoning()
+			text += msg.Text()
+		}
+		last = res
+	}
+	if reasoning != "Compare the decimals: 0.11 < 0.8." || text != "9.11 is smaller." {
+		t.Errorf("streamed %q (reasoning %q)", text, reasoning)
+	}
+	msg := last.Messages[0]
+	if msg.Status != blades.StatusCompleted || msg.Reasoning() != reasoning || msg.Text() != text {
+		t.Errorf("last message = %q (reasoning %q, %s)", msg.Text(), msg.Reasoning(), msg.Status)
+	}
+	want := blades.Usage{InputTokens: 24, OutputTokens: 41, TotalTokens: 65, ReasoningTokens: 33}
+	if last.Usage == nil || *last.Usage != want {
+		t.Errorf("last usage = %+v, want %+v", last.Usage, want)
+	}
+}
+
+func TestToChatCompletionParamsResponseFormat(t *testing.T) {
+	schema := &jsonschema.Schema{
+		Type:       "object",
+		Properties: map[string]*jsonschema.Schema{"city": {Type: "string"}},
+		Required:   []string{"city"},
+	}
+	req := &blades.ModelRequest{Model: QwenPlus, Messages: []*blades.Message{blades.UserMessage("Where is the Eiffel Tower?")}}
+	params, err := toChatCompletionParams(req, blades.ModelOptions{ResponseFormat: &blades.ResponseFormat{Name: "place", Schema: schema}})
+	if err != nil {
+		t.Fatalf("toChatCompletionParams() error = %v", err)
+	}
+	if params.ResponseFormat.OfJSONObject == nil {
+		t.Errorf("response_format = %+v, want json_object", params.ResponseFormat)
+	}
+	if len(params.Messages) != 2 || params.Messages[0].OfSystem == nil {
+		t.Fatalf("messages = %+v, want the schema instructions first", params.Messages)
+	}
+	instructions := params.Messages[0].OfSystem.Content.OfString.Value
+	if !strings.Contains(instructions, `"required":["city"]`) {
+		t.Errorf("instructions = %q, want the schema", instructions)
 	}
 }
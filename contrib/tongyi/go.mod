@@ -0,0 +1,19 @@
+module github.com/go-kratos/blades/contrib/tongyi
+
+go 1.24
+
+require (
+	github.com/go-kratos/blades v0.0.0-20250928061855-93360cba17ff
+	github.com/google/jsonschema-go v0.3.0
+	github.com/openai/openai-go/v2 v2.7.0
+)
+
+require (
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/tidwall/gjson v1.14.4 // indirect
+	github.com/tidwall/match v1.1.1 // indirect
+	github.com/tidwall/pretty v1.2.1 // indirect
+	github.com/tidwall/sjson v1.2.5 // indirect
+)
+
+replace github.com/go-kratos/blades => ../../
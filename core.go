@@ -39,6 +39,11 @@ func (p *Prompt) String() string {
 // Generation represents a single generation of a response from the model.
 type Generation struct {
 	Messages []*Message `json:"message"`
+	// Metadata carries information about how the generation was produced, such as the route chosen by a router.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Usage is the token usage of the run that produced the generation, aggregated over
+	// every model call of an agent and every step of a flow.
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 // Text extracts the text content from the first text part of the generation.
@@ -0,0 +1,127 @@
+package blades
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrRateLimited indicates the provider rejected the request because a rate limit or quota was exceeded.
+	ErrRateLimited = errors.New("rate limited")
+	// ErrOverloaded indicates the provider is overloaded or temporarily unavailable.
+	ErrOverloaded = errors.New("model overloaded")
+	// ErrAuthentication indicates the credentials are missing, invalid or not allowed to use the model.
+	ErrAuthentication = errors.New("authentication failed")
+	// ErrInvalidRequest indicates the provider rejected the request as malformed or unsupported.
+	ErrInvalidRequest = errors.New("invalid request")
+)
+
+// ModelError is an error returned by a model provider, classified by Kind into ErrRateLimited,
+// ErrOverloaded, ErrContextWindowExceeded, ErrAuthentication or ErrInvalidRequest.
+// It matches both its kind and the provider error with errors.Is and errors.As.
+type ModelError struct {
+	Kind error
+	// StatusCode is the HTTP status code of the provider response, when there is one.
+	StatusCode int
+	// RetryAfter is the delay the provider asked for before retrying, zero when not given.
+	RetryAfter time.Duration
+	// Err is the error returned by the provider client.
+	Err error
+}
+
+// Error returns the kind of the error followed by the provider error.
+func (e *ModelError) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+// Unwrap returns the kind and the provider error.
+func (e *ModelError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// NewModelError classifies a provider error by the HTTP status code and message of the response,
+// and reads the delay to retry after from its headers, which may be nil. The error is returned
+// unchanged when it cannot be classified.
+func NewModelError(statusCode int, header http.Header, err error) error {
+	if err == nil {
+		return nil
+	}
+	kind := classify(statusCode, err.Error())
+	if kind == nil {
+		return err
+	}
+	return &ModelError{
+		Kind:       kind,
+		StatusCode: statusCode,
+		RetryAfter: retryAfter(header),
+		Err:        err,
+	}
+}
+
+// contextLengthMessages are the messages providers use to reject prompts that exceed the context window.
+var contextLengthMessages = []string{
+	"context length",
+	"context_length",
+	"context window",
+	"maximum context",
+	"prompt is too long",
+	"input is too long",
+	"too many tokens",
+	"exceeds the maximum number of tokens",
+}
+
+// classify returns the kind of a provider error with the status code and message.
+func classify(statusCode int, message string) error {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrAuthentication
+	case statusCode == http.StatusRequestEntityTooLarge:
+		return ErrContextWindowExceeded
+	case statusCode == http.StatusRequestTimeout || statusCode >= http.StatusInternalServerError:
+		return ErrOverloaded
+	case statusCode >= http.StatusBadRequest:
+		message = strings.ToLower(message)
+		for _, s := range contextLengthMessages {
+			if strings.Contains(message, s) {
+				return ErrContextWindowExceeded
+			}
+		}
+		return ErrInvalidRequest
+	}
+	return nil
+}
+
+// retryAfter returns the delay of the retry-after-ms or Retry-After header, in seconds or as
+// an HTTP date.
+func retryAfter(header http.Header) time.Duration {
+	if header == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// IsRetryable reports whether the error is transient, which is the case for rate limited and
+// overloaded provider errors.
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrOverloaded)
+}
@@ -0,0 +1,143 @@
+package blades
+
+import "context"
+
+// EventKind identifies what a RunEvent reports.
+type EventKind string
+
+const (
+	// EventTextDelta carries a chunk of answer text in Delta.
+	EventTextDelta EventKind = "text_delta"
+	// EventReasoningDelta carries a chunk of model reasoning in Delta.
+	EventReasoningDelta EventKind = "reasoning_delta"
+	// EventToolCallStart reports a tool call that is about to be executed.
+	EventToolCallStart EventKind = "tool_call_start"
+	// EventToolCallEnd reports a tool call that has been executed, together with its result.
+	EventToolCallEnd EventKind = "tool_call_end"
+	// EventStepStart reports that a step of a flow runner has started, Metadata identifies the step.
+	EventStepStart EventKind = "step_start"
+	// EventStepEnd reports that a step of a flow runner has finished with Generation.
+	EventStepEnd EventKind = "step_end"
+	// EventCompleted is the last event of a run and carries the final Generation.
+	EventCompleted EventKind = "completed"
+)
+
+// RunEvent is a typed event emitted while a runner is executing.
+type RunEvent struct {
+	Kind EventKind `json:"kind"`
+	// MessageID is the ID of the message a delta belongs to, when the provider reports one.
+	MessageID string `json:"message_id,omitempty"`
+	// Delta is the text of a text or reasoning delta.
+	Delta string `json:"delta,omitempty"`
+	// ToolCall is the tool call of a tool call event, its Result is set on EventToolCallEnd.
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+	// Generation is the generation of a step end or completed event.
+	Generation *Generation `json:"generation,omitempty"`
+	// Metadata identifies the step that emitted the event, such as the chain step or graph node.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// EventRunner is implemented by runners that emit typed events natively.
+type EventRunner interface {
+	RunEvents(context.Context, *Prompt, ...ModelOption) (Streamer[*RunEvent], error)
+}
+
+// RunEvents runs the runner and streams its typed events, ending with an EventCompleted event.
+// Runners that do not implement EventRunner are streamed with RunStream, and their events are
+// derived from the streamed generations.
+func RunEvents(ctx context.Context, runner Runner, prompt *Prompt, opts ...ModelOption) (Streamer[*RunEvent], error) {
+	if r, ok := runner.(EventRunner); ok {
+		return r.RunEvents(ctx, prompt, opts...)
+	}
+	stream, err := runner.RunStream(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[*RunEvent]()
+	events := &eventWriter{send: pipe.Send, toolMessages: true}
+	pipe.Go(func() error {
+		defer stream.Close()
+		var last *Generation
+		for stream.Next() {
+			gen, err := stream.Current()
+			if err != nil {
+				return err
+			}
+			events.generation(gen)
+			last = gen
+		}
+		if last == nil {
+			return ErrNoGeneration
+		}
+		events.completed(last)
+		return nil
+	})
+	return pipe, nil
+}
+
+// eventWriter derives typed events from streamed generations. Providers stream incomplete
+// messages holding the deltas, followed by the completed message of each model call.
+type eventWriter struct {
+	send func(*RunEvent)
+	// toolMessages reports tool calls from tool messages, for runners whose tool execution
+	// is not observed directly.
+	toolMessages bool
+	// streamed records whether deltas were sent for the current model call.
+	streamed bool
+}
+
+// generation sends the events of a streamed generation.
+func (w *eventWriter) generation(gen *Generation) {
+	for _, msg := range gen.Messages {
+		switch {
+		case msg.Role == RoleTool:
+			if !w.toolMessages {
+				continue
+			}
+			for _, call := range msg.ToolCalls {
+				w.toolCall(EventToolCallStart, &ToolCall{ID: call.ID, Name: call.Name, Arguments: call.Arguments})
+				w.toolCall(EventToolCallEnd, call)
+			}
+		case msg.Status == StatusCompleted:
+			// The completed message repeats the deltas, it is only reported when nothing was streamed.
+			if !w.streamed {
+				w.deltas(msg)
+			}
+			w.streamed = false
+		default:
+			if w.deltas(msg) {
+				w.streamed = true
+			}
+		}
+	}
+}
+
+// deltas sends the reasoning and text of a message as deltas, and reports whether any was sent.
+func (w *eventWriter) deltas(msg *Message) bool {
+	var sent bool
+	for _, part := range msg.Parts {
+		switch v := part.(type) {
+		case ReasoningPart:
+			if v.Text != "" {
+				w.send(&RunEvent{Kind: EventReasoningDelta, MessageID: msg.ID, Delta: v.Text})
+				sent = true
+			}
+		case TextPart:
+			if v.Text != "" {
+				w.send(&RunEvent{Kind: EventTextDelta, MessageID: msg.ID, Delta: v.Text})
+				sent = true
+			}
+		}
+	}
+	return sent
+}
+
+// toolCall sends a tool call event.
+func (w *eventWriter) toolCall(kind EventKind, call *ToolCall) {
+	w.send(&RunEvent{Kind: kind, ToolCall: call})
+}
+
+// completed sends the final event of a run.
+func (w *eventWriter) completed(gen *Generation) {
+	w.send(&RunEvent{Kind: EventCompleted, Generation: gen})
+}
@@ -0,0 +1,109 @@
+package blades
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// collectEvents drains the event stream and returns the kinds and events it yielded.
+func collectEvents(t *testing.T, stream Streamer[*RunEvent]) ([]EventKind, []*RunEvent) {
+	t.Helper()
+	defer stream.Close()
+	var (
+		kinds  []EventKind
+		events []*RunEvent
+	)
+	for stream.Next() {
+		event, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		kinds = append(kinds, event.Kind)
+		events = append(events, event)
+	}
+	return kinds, events
+}
+
+// generationRunner streams the given generations.
+type generationRunner struct {
+	generations []*Generation
+}
+
+func (r *generationRunner) Run(ctx context.Context, prompt *Prompt, opts ...ModelOption) (*Generation, error) {
+	return r.generations[len(r.generations)-1], nil
+}
+
+func (r *generationRunner) RunStream(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[*Generation], error) {
+	pipe := NewStreamPipe[*Generation]()
+	pipe.Go(func() error {
+		for _, gen := range r.generations {
+			pipe.Send(gen)
+		}
+		return nil
+	})
+	return pipe, nil
+}
+
+func TestAgentRunEvents(t *testing.T) {
+	reasoning := toolCallResponse("get_weather")
+	reasoning.Messages[0].Parts = []Part{ReasoningPart{Text: "Need the weather."}}
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		reasoning,
+		textResponse("It is sunny."),
+	}}
+	agent := NewAgent("weather", WithProvider(provider), WithTools(weatherTool()))
+	stream, err := agent.RunEvents(context.Background(), NewPrompt(UserMessage("Weather?")))
+	if err != nil {
+		t.Fatalf("RunEvents() error = %v", err)
+	}
+	kinds, events := collectEvents(t, stream)
+	want := []EventKind{EventReasoningDelta, EventToolCallStart, EventToolCallEnd, EventTextDelta, EventCompleted}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("RunEvents() kinds = %v, want %v", kinds, want)
+	}
+	if events[0].Delta != "Need the weather." {
+		t.Errorf("reasoning delta = %q", events[0].Delta)
+	}
+	if call := events[1].ToolCall; call.Name != "get_weather" || call.Result != "" {
+		t.Errorf("tool call start = %+v", call)
+	}
+	if call := events[2].ToolCall; call.Name != "get_weather" || call.Result != "Sunny" {
+		t.Errorf("tool call end = %+v", call)
+	}
+	if events[3].Delta != "It is sunny." {
+		t.Errorf("text delta = %q", events[3].Delta)
+	}
+	if text := events[4].Generation.Text(); text != "It is sunny." {
+		t.Errorf("completed text = %q", text)
+	}
+}
+
+func TestRunEventsFromStream(t *testing.T) {
+	delta := func(text string) *Generation {
+		return &Generation{Messages: []*Message{{Role: RoleAssistant, Status: StatusIncomplete, Parts: []Part{TextPart{Text: text}}}}}
+	}
+	answer := AssistantMessage("Hello!")
+	answer.Status = StatusCompleted
+	runner := &generationRunner{generations: []*Generation{
+		{Messages: []*Message{{Role: RoleTool, ToolCalls: []*ToolCall{{ID: "call_1", Name: "lookup", Result: "ok"}}}}},
+		delta("Hel"),
+		delta("lo!"),
+		{Messages: []*Message{answer}},
+	}}
+	stream, err := RunEvents(context.Background(), runner, NewPrompt(UserMessage("Hi")))
+	if err != nil {
+		t.Fatalf("RunEvents() error = %v", err)
+	}
+	kinds, events := collectEvents(t, stream)
+	want := []EventKind{EventToolCallStart, EventToolCallEnd, EventTextDelta, EventTextDelta, EventCompleted}
+	if !reflect.DeepEqual(kinds, want) {
+		t.Fatalf("RunEvents() kinds = %v, want %v", kinds, want)
+	}
+	if events[2].Delta+events[3].Delta != "Hello!" {
+		t.Errorf("text deltas = %q, %q", events[2].Delta, events[3].Delta)
+	}
+	if events[4].Generation.Text() != "Hello!" {
+		t.Errorf("completed text = %q", events[4].Generation.Text())
+	}
+}
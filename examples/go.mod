@@ -5,11 +5,13 @@ go 1.24
 replace (
 	github.com/go-kratos/blades => ../
 	github.com/go-kratos/blades/contrib/openai => ../contrib/openai
+	github.com/go-kratos/blades/contrib/tongyi => ../contrib/tongyi
 )
 
 require (
 	github.com/go-kratos/blades v0.0.0-20250928061855-93360cba17ff
 	github.com/go-kratos/blades/contrib/openai v0.0.0-00010101000000-000000000000
+	github.com/go-kratos/blades/contrib/tongyi v0.0.0-00010101000000-000000000000
 	github.com/google/jsonschema-go v0.3.0
 )
 
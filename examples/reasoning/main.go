@@ -18,16 +18,24 @@ func main() {
 	prompt := blades.NewPrompt(
 		blades.UserMessage("What is the capital of France?"),
 	)
-	stream, err := agent.RunStream(context.Background(), prompt, blades.ReasoningEffort("medium"))
+	events, err := agent.RunEvents(context.Background(), prompt, blades.ReasoningEffort("medium"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer stream.Close()
-	for stream.Next() {
-		res, err := stream.Current()
+	defer events.Close()
+	for events.Next() {
+		event, err := events.Current()
 		if err != nil {
 			log.Fatal(err)
 		}
-		log.Println(res.Text())
+		switch event.Kind {
+		case blades.EventReasoningDelta:
+			log.Println("[reasoning]", event.Delta)
+		case blades.EventTextDelta:
+			log.Println("[answer]", event.Delta)
+		case blades.EventCompleted:
+			msg := event.Generation.Messages[0]
+			log.Printf("reasoning: %s\nanswer: %s", msg.Reasoning(), msg.Text())
+		}
 	}
 }
@@ -39,7 +39,7 @@ func main() {
 	if err != nil {
 		log.Fatal("Agent1 error:", err)
 	}
-	log.Println("Agent1 (QwenTurbo):", result1.AsText())
+	log.Println("Agent1 (QwenTurbo):", result1.Text())
 
 	// Test second agent
 	prompt2 := blades.NewPrompt(
@@ -49,5 +49,5 @@ func main() {
 	if err != nil {
 		log.Fatal("Agent2 error:", err)
 	}
-	log.Println("Agent2 (QwenPlus):", result2.AsText())
+	log.Println("Agent2 (QwenPlus):", result2.Text())
 }
@@ -0,0 +1,387 @@
+package blades
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoBackend indicates every backend of a FailoverProvider has its circuit open.
+	ErrNoBackend = errors.New("no backend available")
+)
+
+var _ ModelProvider = (*FailoverProvider)(nil)
+
+// Backend is a provider served by a FailoverProvider.
+type Backend struct {
+	// Name identifies the backend in its stats, it defaults to the model or the backend index.
+	Name     string
+	Provider ModelProvider
+	// Model replaces the model of the requests sent to the backend when set, so that each vendor
+	// is asked for its own model.
+	Model string
+	// Weight is the share of requests of the backend with WeightedRoundRobin, it defaults to 1.
+	Weight int
+}
+
+// BackendStats is the health of a backend observed by a FailoverProvider.
+type BackendStats struct {
+	Name   string
+	Weight int
+	// Latency is the moving average of the time to a response, or to the first response of a stream.
+	Latency time.Duration
+	// Requests and Failures count the calls sent to the backend and the ones that failed.
+	Requests int
+	Failures int
+	// ConsecutiveFailures counts the failures since the last success, and opens the circuit of
+	// the backend when it reaches the circuit breaker threshold.
+	ConsecutiveFailures int
+	// Available reports whether the circuit of the backend is closed, or its cooldown has elapsed
+	// and no probe request is in flight.
+	Available bool
+}
+
+// Strategy returns the order in which the backends are tried for a request, as indexes into
+// stats. Backends that are not available are skipped. It is called with the provider lock held.
+type Strategy func(stats []BackendStats) []int
+
+// Priority tries the backends in the order they were given, falling back to the next one on failure.
+func Priority() Strategy {
+	return func(stats []BackendStats) []int {
+		order := make([]int, len(stats))
+		for i := range order {
+			order[i] = i
+		}
+		return order
+	}
+}
+
+// WeightedRoundRobin spreads requests across the available backends in proportion to their
+// weight, with smooth weighted round-robin. The other backends follow in priority order.
+func WeightedRoundRobin() Strategy {
+	var current []int
+	return func(stats []BackendStats) []int {
+		if len(current) != len(stats) {
+			current = make([]int, len(stats))
+		}
+		picked, total := -1, 0
+		for i, s := range stats {
+			if !s.Available {
+				continue
+			}
+			current[i] += s.Weight
+			total += s.Weight
+			if picked < 0 || current[i] > current[picked] {
+				picked = i
+			}
+		}
+		order := Priority()(stats)
+		if picked < 0 {
+			return order
+		}
+		current[picked] -= total
+		return append([]int{picked}, slices.DeleteFunc(order, func(i int) bool { return i == picked })...)
+	}
+}
+
+// LeastLatency tries the backends with the fewest consecutive failures first, and among them
+// the ones with the lowest average latency. Healthy backends without a successful call yet have
+// no latency, so they are tried first to measure it.
+func LeastLatency() Strategy {
+	return func(stats []BackendStats) []int {
+		order := Priority()(stats)
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Or(
+				cmp.Compare(stats[a].ConsecutiveFailures, stats[b].ConsecutiveFailures),
+				cmp.Compare(stats[a].Latency, stats[b].Latency),
+			)
+		})
+		return order
+	}
+}
+
+// FailoverOption configures a FailoverProvider.
+type FailoverOption func(*FailoverProvider)
+
+// WithStrategy sets the strategy ordering the backends. Defaults to Priority.
+func WithStrategy(strategy Strategy) FailoverOption {
+	return func(p *FailoverProvider) {
+		p.strategy = strategy
+	}
+}
+
+// WithFailoverIf sets the function that decides which errors fail over to the next backend.
+// Defaults to every error but invalid requests and canceled or expired contexts.
+func WithFailoverIf(failover func(error) bool) FailoverOption {
+	return func(p *FailoverProvider) {
+		p.failover = failover
+	}
+}
+
+// WithCircuitBreaker opens the circuit of a backend after threshold consecutive failures,
+// skipping it until cooldown has elapsed. A single request then probes the backend, which
+// closes the circuit when it succeeds and opens it for another cooldown when it fails.
+// Defaults to 5 failures and 30s.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) FailoverOption {
+	return func(p *FailoverProvider) {
+		p.threshold = threshold
+		p.cooldown = cooldown
+	}
+}
+
+// backend is a Backend with the health observed so far.
+type backend struct {
+	Backend
+	stats     BackendStats
+	openUntil time.Time
+	// probing is set while the request probing a backend after its cooldown is in flight.
+	probing bool
+}
+
+// FailoverProvider is a ModelProvider that spreads requests across several backends and fails
+// over to the next backend when one fails, so that callers are not affected when a vendor degrades.
+type FailoverProvider struct {
+	mu        sync.Mutex
+	backends  []*backend
+	strategy  Strategy
+	failover  func(error) bool
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+}
+
+// NewFailoverProvider creates a FailoverProvider serving the backends.
+func NewFailoverProvider(backends []*Backend, opts ...FailoverOption) *FailoverProvider {
+	p := &FailoverProvider{
+		strategy:  Priority(),
+		failover:  shouldFailover,
+		threshold: 5,
+		cooldown:  30 * time.Second,
+		now:       time.Now,
+	}
+	for i, b := range backends {
+		state := &backend{Backend: *b}
+		if state.Name == "" {
+			state.Name = state.Model
+		}
+		if state.Name == "" {
+			state.Name = strconv.Itoa(i)
+		}
+		if state.Weight <= 0 {
+			state.Weight = 1
+		}
+		state.stats = BackendStats{Name: state.Name, Weight: state.Weight}
+		p.backends = append(p.backends, state)
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// shouldFailover reports whether another backend may succeed where one failed with the error.
+func shouldFailover(err error) bool {
+	return !errors.Is(err, ErrInvalidRequest) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// Stats returns the health of every backend.
+func (p *FailoverProvider) Stats() []BackendStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
+
+// snapshot returns the stats of the backends, it is called with the lock held.
+func (p *FailoverProvider) snapshot() []BackendStats {
+	now := p.now()
+	stats := make([]BackendStats, len(p.backends))
+	for i, b := range p.backends {
+		stats[i] = b.stats
+		stats[i].Available = !now.Before(b.openUntil) && !b.probing
+	}
+	return stats
+}
+
+// candidates returns the available backends in the order of the strategy.
+func (p *FailoverProvider) candidates() []*backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := p.snapshot()
+	var out []*backend
+	for _, i := range p.strategy(stats) {
+		if i >= 0 && i < len(stats) && stats[i].Available {
+			out = append(out, p.backends[i])
+		}
+	}
+	return out
+}
+
+// acquire reports whether a request may be sent to the backend. Once the cooldown of an open
+// circuit has elapsed, only the first request is let through to probe the backend.
+func (p *FailoverProvider) acquire(b *backend) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || p.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends the probe of a backend whose call ended with an error that says nothing about
+// its health.
+func (p *FailoverProvider) release(b *backend) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.probing = false
+}
+
+// observe records the outcome of a call to the backend.
+func (p *FailoverProvider) observe(b *backend, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	b.stats.Requests++
+	b.probing = false
+	if err != nil {
+		b.stats.Failures++
+		b.stats.ConsecutiveFailures++
+		if p.threshold > 0 && b.stats.ConsecutiveFailures >= p.threshold {
+			b.openUntil = p.now().Add(p.cooldown)
+		}
+		return
+	}
+	b.stats.ConsecutiveFailures = 0
+	b.openUntil = time.Time{}
+	if b.stats.Latency == 0 {
+		b.stats.Latency = latency
+	} else {
+		b.stats.Latency = (4*b.stats.Latency + latency) / 5
+	}
+}
+
+// request returns the request to send to the backend.
+func (b *backend) request(req *ModelRequest) *ModelRequest {
+	if b.Model == "" {
+		return req
+	}
+	out := *req
+	out.Model = b.Model
+	return &out
+}
+
+// SupportsResponseFormat reports whether every backend honors the ResponseFormat, since a
+// request may be served by any of them.
+func (p *FailoverProvider) SupportsResponseFormat() bool {
+	for _, b := range p.backends {
+		if !SupportsResponseFormat(b.Provider) {
+			return false
+		}
+	}
+	return len(p.backends) > 0
+}
+
+// Generate sends the request to the backends in the order of the strategy until one succeeds,
+// or fails with an error that does not fail over.
+func (p *FailoverProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	var errs []error
+	for _, b := range p.candidates() {
+		if !p.acquire(b) {
+			continue
+		}
+		start := p.now()
+		res, err := b.Provider.Generate(ctx, b.request(req), opts...)
+		if err == nil {
+			p.observe(b, p.now().Sub(start), nil)
+			return res, nil
+		}
+		errs = append(errs, err)
+		if !p.failover(err) {
+			p.release(b)
+			return nil, err
+		}
+		p.observe(b, 0, err)
+	}
+	if len(errs) == 0 {
+		return nil, ErrNoBackend
+	}
+	return nil, errors.Join(errs...)
+}
+
+// NewStream opens a stream on the backends in the order of the strategy. A backend that fails
+// before yielding its first response, or ends its stream without any, fails over to the next
+// one, later errors are returned to the consumer. The outcome of a backend is recorded when its
+// stream ends, so a backend failing mid-stream counts as failed.
+func (p *FailoverProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	candidates := p.candidates()
+	if len(candidates) == 0 {
+		return nil, ErrNoBackend
+	}
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Go(func() error {
+		var errs []error
+		for _, b := range candidates {
+			if !p.acquire(b) {
+				continue
+			}
+			sent, latency, err := p.forward(ctx, pipe, b, req, opts...)
+			if err == nil && !sent {
+				err = ErrNoGeneration
+			}
+			if err == nil {
+				p.observe(b, latency, nil)
+				return nil
+			}
+			if !p.failover(err) {
+				p.release(b)
+				return err
+			}
+			p.observe(b, 0, err)
+			if sent {
+				return err
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) == 0 {
+			return ErrNoBackend
+		}
+		return errors.Join(errs...)
+	})
+	return pipe, nil
+}
+
+// forward opens a stream on the backend and sends its responses to the pipe. It reports
+// whether any response was sent and the time to the first one.
+func (p *FailoverProvider) forward(ctx context.Context, pipe *StreamPipe[*ModelResponse], b *backend, req *ModelRequest, opts ...ModelOption) (bool, time.Duration, error) {
+	start := p.now()
+	stream, err := b.Provider.NewStream(ctx, b.request(req), opts...)
+	if err != nil {
+		return false, 0, err
+	}
+	defer stream.Close()
+	var (
+		sent    bool
+		latency time.Duration
+	)
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			return sent, latency, err
+		}
+		if !sent {
+			latency = p.now().Sub(start)
+			sent = true
+		}
+		pipe.Send(res)
+	}
+	return sent, latency, nil
+}
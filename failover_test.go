@@ -0,0 +1,259 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// backendProvider answers with its name, or fails with err. Its streams fail with streamErr
+// after the first response, and end without any response when empty is set.
+type backendProvider struct {
+	name      string
+	err       error
+	streamErr error
+	empty     bool
+	models    []string
+}
+
+func (p *backendProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	p.models = append(p.models, req.Model)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return textResponse(p.name), nil
+}
+
+func (p *backendProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	p.models = append(p.models, req.Model)
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Go(func() error {
+		if p.err != nil {
+			return p.err
+		}
+		if p.empty {
+			return nil
+		}
+		pipe.Send(textResponse(p.name))
+		return p.streamErr
+	})
+	return pipe, nil
+}
+
+func TestFailoverProvider(t *testing.T) {
+	overloaded := &ModelError{Kind: ErrOverloaded, StatusCode: 503, Err: errors.New("unavailable")}
+	invalid := &ModelError{Kind: ErrInvalidRequest, StatusCode: 400, Err: errors.New("bad request")}
+	tests := []struct {
+		name    string
+		err     error
+		want    string
+		wantErr error
+	}{
+		{name: "fails over", err: overloaded, want: "qwen"},
+		{name: "invalid request", err: invalid, wantErr: ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			gpt := &backendProvider{name: "gpt", err: tt.err}
+			qwen := &backendProvider{name: "qwen"}
+			provider := NewFailoverProvider([]*Backend{
+				{Provider: gpt, Model: "gpt-4o"},
+				{Provider: qwen, Model: "qwen-plus"},
+			})
+			req := &ModelRequest{Model: "default", Messages: []*Message{UserMessage("Hi")}}
+			var (
+				res *ModelResponse
+				err error
+			)
+			if stream {
+				res, err = lastResponse(provider.NewStream(context.Background(), req))
+			} else {
+				res, err = provider.Generate(context.Background(), req)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("%s (stream %v): error = %v, want %v", tt.name, stream, err, tt.wantErr)
+			}
+			if tt.wantErr == nil && res.Messages[0].Text() != tt.want {
+				t.Errorf("%s (stream %v): text = %q, want %q", tt.name, stream, res.Messages[0].Text(), tt.want)
+			}
+			if fmt.Sprint(gpt.models) != "[gpt-4o]" {
+				t.Errorf("%s (stream %v): gpt models = %v, want [gpt-4o]", tt.name, stream, gpt.models)
+			}
+			stats := provider.Stats()
+			if tt.wantErr == nil && (stats[0].Failures != 1 || stats[1].Requests != 1 || qwen.models[0] != "qwen-plus") {
+				t.Errorf("%s (stream %v): stats = %+v, qwen models = %v", tt.name, stream, stats, qwen.models)
+			}
+			if tt.wantErr != nil && (stats[0].Failures != 0 || len(qwen.models) != 0) {
+				t.Errorf("%s (stream %v): invalid request was failed over, stats = %+v", tt.name, stream, stats)
+			}
+		}
+	}
+}
+
+// lastResponse drains the stream and returns its last response or its error.
+func lastResponse(stream Streamer[*ModelResponse], err error) (*ModelResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var last *ModelResponse
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		last = res
+	}
+	return last, nil
+}
+
+func TestFailoverCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	gpt := &backendProvider{name: "gpt", err: &ModelError{Kind: ErrRateLimited, StatusCode: 429, Err: errors.New("slow down")}}
+	qwen := &backendProvider{name: "qwen"}
+	provider := NewFailoverProvider([]*Backend{
+		{Name: "gpt", Provider: gpt},
+		{Name: "qwen", Provider: qwen},
+	}, WithCircuitBreaker(2, time.Minute))
+	provider.now = func() time.Time { return now }
+	req := &ModelRequest{Messages: []*Message{UserMessage("Hi")}}
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Generate(context.Background(), req); err != nil {
+			t.Fatalf("Generate() error = %v", err)
+		}
+	}
+	if len(gpt.models) != 2 {
+		t.Errorf("open backend called %d times, want 2", len(gpt.models))
+	}
+	if stats := provider.Stats(); stats[0].Available || stats[0].ConsecutiveFailures != 2 {
+		t.Errorf("stats = %+v, want the gpt circuit open", stats[0])
+	}
+	now = now.Add(time.Minute)
+	gpt.err = nil
+	res, err := provider.Generate(context.Background(), req)
+	if err != nil || res.Messages[0].Text() != "gpt" {
+		t.Fatalf("Generate() after cooldown = %v, %v, want gpt", res, err)
+	}
+	if stats := provider.Stats(); !stats[0].Available || stats[0].ConsecutiveFailures != 0 {
+		t.Errorf("stats = %+v, want the gpt circuit closed", stats[0])
+	}
+	gpt.err = errors.New("down")
+	qwen.err = errors.New("down")
+	provider = NewFailoverProvider([]*Backend{{Provider: gpt}, {Provider: qwen}}, WithCircuitBreaker(1, time.Minute))
+	if _, err := provider.Generate(context.Background(), req); err == nil {
+		t.Fatal("Generate() error = nil, want the backend errors")
+	}
+	if _, err := provider.Generate(context.Background(), req); !errors.Is(err, ErrNoBackend) {
+		t.Errorf("Generate() error = %v, want %v", err, ErrNoBackend)
+	}
+}
+
+func TestFailoverStreamOutcome(t *testing.T) {
+	gpt := &backendProvider{name: "gpt", streamErr: &ModelError{Kind: ErrOverloaded, StatusCode: 503, Err: errors.New("connection reset")}}
+	qwen := &backendProvider{name: "qwen"}
+	provider := NewFailoverProvider([]*Backend{{Provider: gpt}, {Provider: qwen}}, WithCircuitBreaker(2, time.Minute))
+	req := &ModelRequest{Messages: []*Message{UserMessage("Hi")}}
+	// A failure after the first response is returned, and counted against the backend.
+	for i := 0; i < 2; i++ {
+		if _, err := lastResponse(provider.NewStream(context.Background(), req)); !errors.Is(err, ErrOverloaded) {
+			t.Fatalf("NewStream() error = %v, want %v", err, ErrOverloaded)
+		}
+	}
+	if stats := provider.Stats(); stats[0].Available || stats[0].Failures != 2 || len(qwen.models) != 0 {
+		t.Errorf("stats = %+v, want the gpt circuit open", stats[0])
+	}
+	res, err := lastResponse(provider.NewStream(context.Background(), req))
+	if err != nil || res.Messages[0].Text() != "qwen" {
+		t.Errorf("NewStream() = %v, %v, want qwen", res, err)
+	}
+
+	// An empty stream fails over and is counted as a failure.
+	gpt = &backendProvider{name: "gpt", empty: true}
+	provider = NewFailoverProvider([]*Backend{{Provider: gpt}, {Provider: qwen}})
+	res, err = lastResponse(provider.NewStream(context.Background(), req))
+	if err != nil || res.Messages[0].Text() != "qwen" {
+		t.Errorf("NewStream() = %v, %v, want qwen", res, err)
+	}
+	if stats := provider.Stats(); stats[0].Failures != 1 || stats[1].Failures != 0 {
+		t.Errorf("stats = %+v, want the empty stream counted as a failure", stats)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	stats := []BackendStats{
+		{Name: "a", Weight: 2, Latency: 300 * time.Millisecond, Available: true},
+		{Name: "b", Weight: 1, Latency: 100 * time.Millisecond, Available: true},
+		{Name: "c", Weight: 5, Available: false},
+	}
+	wrr := WeightedRoundRobin()
+	var picks []int
+	for i := 0; i < 6; i++ {
+		picks = append(picks, wrr(stats)[0])
+	}
+	if fmt.Sprint(picks) != "[0 1 0 0 1 0]" {
+		t.Errorf("WeightedRoundRobin() picks = %v, want [0 1 0 0 1 0]", picks)
+	}
+	if got := fmt.Sprint(LeastLatency()(stats)); got != "[2 1 0]" {
+		t.Errorf("LeastLatency() = %s, want [2 1 0]", got)
+	}
+	// A failing backend without latency is tried after the healthy ones.
+	stats[2] = BackendStats{Name: "c", ConsecutiveFailures: 1, Available: true}
+	if got := fmt.Sprint(LeastLatency()(stats)); got != "[1 0 2]" {
+		t.Errorf("LeastLatency() with a failing backend = %s, want [1 0 2]", got)
+	}
+}
+
+// probeProvider answers with its name once released, and reports every call.
+type probeProvider struct {
+	backendProvider
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (p *probeProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	p.called <- struct{}{}
+	<-p.release
+	return p.backendProvider.Generate(ctx, req, opts...)
+}
+
+func TestFailoverProbe(t *testing.T) {
+	now := time.Now()
+	gpt := &probeProvider{
+		backendProvider: backendProvider{name: "gpt"},
+		called:          make(chan struct{}, 2),
+		release:         make(chan struct{}),
+	}
+	qwen := &backendProvider{name: "qwen"}
+	provider := NewFailoverProvider([]*Backend{
+		{Name: "gpt", Provider: gpt},
+		{Name: "qwen", Provider: qwen},
+	}, WithCircuitBreaker(1, time.Minute))
+	provider.now = func() time.Time { return now }
+	provider.observe(provider.backends[0], 0, errors.New("down"))
+	now = now.Add(time.Minute)
+
+	req := &ModelRequest{Messages: []*Message{UserMessage("Hi")}}
+	probe := make(chan string, 1)
+	go func() {
+		res, _ := provider.Generate(context.Background(), req)
+		probe <- res.Messages[0].Text()
+	}()
+	<-gpt.called
+	// Other requests skip the backend while it is probed.
+	res, err := provider.Generate(context.Background(), req)
+	if err != nil || res.Messages[0].Text() != "qwen" {
+		t.Fatalf("Generate() during the probe = %v, %v, want qwen", res, err)
+	}
+	close(gpt.release)
+	if got := <-probe; got != "gpt" {
+		t.Errorf("probe = %q, want gpt", got)
+	}
+	if len(gpt.called) != 0 {
+		t.Errorf("backend called %d more times during the probe, want 0", len(gpt.called))
+	}
+	if stats := provider.Stats(); !stats[0].Available || stats[0].ConsecutiveFailures != 0 {
+		t.Errorf("stats = %+v, want the gpt circuit closed", stats[0])
+	}
+}
@@ -2,17 +2,30 @@ package flow
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strconv"
 
 	"github.com/go-kratos/blades"
 )
 
 var (
-	_ blades.Runner = (*Chain)(nil)
+	_ blades.Runner                  = (*Chain)(nil)
+	_ blades.EventRunner             = (*Chain)(nil)
+	_ blades.ResponseFormatSupporter = (*Chain)(nil)
+)
+
+const (
+	// StepKey is the Generation metadata key holding the 0-based index of the chain step that produced it.
+	StepKey = "step"
+	// RunnerKey is the Generation metadata key holding the name of the runner that produced it.
+	RunnerKey = "runner"
 )
 
 // Chain represents a sequence of Runnable runners that process input sequentially.
 type Chain struct {
-	runners []blades.Runner
+	runners     []blades.Runner
+	streamSteps bool
 }
 
 // NewChain creates a new Chain with the given runners.
@@ -22,32 +35,73 @@ func NewChain(runners ...blades.Runner) *Chain {
 	}
 }
 
+// StreamSteps sets whether RunStream streams intermediate steps as they are generated.
+// By default only the completed generation of an intermediate step is sent.
+func (c *Chain) StreamSteps(enabled bool) *Chain {
+	c.streamSteps = enabled
+	return c
+}
+
+// SupportsResponseFormat reports whether the last runner honors the ResponseFormat, which only
+// constrains the answer of the last step.
+func (c *Chain) SupportsResponseFormat() bool {
+	return len(c.runners) > 0 && blades.SupportsResponseFormat(c.runners[len(c.runners)-1])
+}
+
 // Run executes the chain of runners sequentially, passing the output of one as the input to the next.
+// The returned generation carries the usage of every step.
 func (c *Chain) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
 	var (
-		err  error
-		last *blades.Generation
+		err   error
+		last  *blades.Generation
+		usage *blades.Usage
 	)
-	for _, runner := range c.runners {
-		last, err = runner.Run(ctx, prompt, opts...)
+	for i, runner := range c.runners {
+		last, err = runner.Run(ctx, prompt, c.stepOptions(i, opts)...)
 		if err != nil {
 			return nil, err
 		}
+		usage = blades.SumUsage(usage, last.Usage)
 		prompt = blades.NewPrompt(last.Messages...)
 	}
-	return last, nil
+	if last == nil {
+		return nil, nil
+	}
+	return withUsage(last, usage), nil
 }
 
 // RunStream executes the chain of runners sequentially, streaming the output of the last runner.
+// Every generation is tagged with the step index and runner name under StepKey and RunnerKey,
+// and the completed generation of each step carries the usage of the chain so far.
 func (c *Chain) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
 	pipe := blades.NewStreamPipe[*blades.Generation]()
 	pipe.Go(func() error {
-		for _, runner := range c.runners {
-			last, err := runner.Run(ctx, prompt, opts...)
+		var usage *blades.Usage
+		for i, runner := range c.runners {
+			step := map[string]string{
+				StepKey:   strconv.Itoa(i),
+				RunnerKey: runnerName(runner),
+			}
+			if !c.streamSteps && i < len(c.runners)-1 {
+				last, err := runner.Run(ctx, prompt, c.stepOptions(i, opts)...)
+				if err != nil {
+					return err
+				}
+				usage = blades.SumUsage(usage, last.Usage)
+				pipe.Send(withUsage(withMetadata(last, step), usage))
+				prompt = blades.NewPrompt(last.Messages...)
+				continue
+			}
+			stream, err := runner.RunStream(ctx, prompt, c.stepOptions(i, opts)...)
 			if err != nil {
 				return err
 			}
-			pipe.Send(last)
+			last, err := forwardStep(pipe, stream, step)
+			if err != nil {
+				return err
+			}
+			usage = blades.SumUsage(usage, last.Usage)
+			pipe.Send(withUsage(withMetadata(last, step), usage))
 			prompt = blades.NewPrompt(last.Messages...)
 		}
 		return nil
@@ -55,3 +109,74 @@ func (c *Chain) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...bl
 	return pipe, nil
 }
 
+// RunEvents executes the chain of runners sequentially and reports every runner as a step,
+// identified by StepKey and RunnerKey, with the events of the runner in between.
+func (c *Chain) RunEvents(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.RunEvent], error) {
+	pipe := blades.NewStreamPipe[*blades.RunEvent]()
+	pipe.Go(func() error {
+		var (
+			last  *blades.Generation
+			usage *blades.Usage
+		)
+		for i, runner := range c.runners {
+			step := map[string]string{
+				StepKey:   strconv.Itoa(i),
+				RunnerKey: runnerName(runner),
+			}
+			gen, err := runStep(ctx, pipe, runner, prompt, step, c.stepOptions(i, opts)...)
+			if err != nil {
+				return err
+			}
+			usage = blades.SumUsage(usage, gen.Usage)
+			pipe.Send(stepEnd(withMetadata(gen, step), step))
+			prompt = blades.NewPrompt(gen.Messages...)
+			last = gen
+		}
+		if last == nil {
+			return ErrNoResult
+		}
+		pipe.Send(completed(withUsage(last, usage)))
+		return nil
+	})
+	return pipe, nil
+}
+
+// stepOptions returns the model options of step i. The ResponseFormat is removed from the
+// options of the intermediate steps, whose answers are not the answer of the chain.
+func (c *Chain) stepOptions(i int, opts []blades.ModelOption) []blades.ModelOption {
+	if i == len(c.runners)-1 {
+		return opts
+	}
+	return append(slices.Clip(opts), func(o *blades.ModelOptions) {
+		o.ResponseFormat = nil
+	})
+}
+
+// forwardStep sends every generation of the stream but the last to the pipe tagged with the
+// step metadata, and returns the last one as the completed generation of the step.
+func forwardStep(pipe *blades.StreamPipe[*blades.Generation], stream blades.Streamer[*blades.Generation], step map[string]string) (*blades.Generation, error) {
+	defer stream.Close()
+	var last *blades.Generation
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			pipe.Send(withMetadata(last, step))
+		}
+		last = gen
+	}
+	if last == nil {
+		return nil, ErrNoResult
+	}
+	return last, nil
+}
+
+// runnerName returns the name of runners that have one, such as agents, or their type otherwise.
+func runnerName(runner blades.Runner) string {
+	if named, ok := runner.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", runner)
+}
@@ -0,0 +1,196 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// namedRunner is a draftRunner with a name.
+type namedRunner struct {
+	draftRunner
+	name string
+}
+
+func (r *namedRunner) Name() string {
+	return r.name
+}
+
+func TestChainRunStream(t *testing.T) {
+	tests := []struct {
+		name        string
+		streamSteps bool
+		want        string
+	}{
+		{
+			name: "last step only",
+			want: "[0/writer/draft 1 1/*flow.draftRunner/partial 1/*flow.draftRunner/draft 1]",
+		},
+		{
+			name:        "all steps",
+			streamSteps: true,
+			want:        "[0/writer/partial 0/writer/draft 1 1/*flow.draftRunner/partial 1/*flow.draftRunner/draft 1]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := &draftRunner{}
+			chain := NewChain(&namedRunner{name: "writer"}, editor).StreamSteps(tt.streamSteps)
+			stream, err := chain.RunStream(context.Background(), blades.NewPrompt(blades.UserMessage("Write a haiku")))
+			if err != nil {
+				t.Fatalf("RunStream() error = %v", err)
+			}
+			defer stream.Close()
+			var got []string
+			for stream.Next() {
+				gen, err := stream.Current()
+				if err != nil {
+					t.Fatalf("Current() error = %v", err)
+				}
+				got = append(got, gen.Metadata[StepKey]+"/"+gen.Metadata[RunnerKey]+"/"+gen.Text())
+			}
+			if fmt.Sprint(got) != tt.want {
+				t.Errorf("RunStream() = %v, want %s", got, tt.want)
+			}
+			if prompt := editor.prompts[0]; prompt.Messages[0].Text() != "draft 1" {
+				t.Errorf("second step prompt = %q, want the completed first step", prompt.Messages[0].Text())
+			}
+		})
+	}
+}
+
+// usageRunner wraps a draftRunner and reports a fixed usage on its completed generations.
+type usageRunner struct {
+	draftRunner
+	usage blades.Usage
+}
+
+func (r *usageRunner) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	gen, err := r.draftRunner.Run(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	usage := r.usage
+	gen.Usage = &usage
+	return gen, nil
+}
+
+func (r *usageRunner) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	gen, err := r.Run(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Send(&blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("partial")}})
+	pipe.Send(gen)
+	pipe.Close()
+	return pipe, nil
+}
+
+func TestChainUsage(t *testing.T) {
+	newChain := func() *Chain {
+		return NewChain(
+			&usageRunner{usage: blades.Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15, Cost: 0.5}},
+			&draftRunner{},
+			&usageRunner{usage: blades.Usage{InputTokens: 20, OutputTokens: 8, TotalTokens: 28, Cost: 0.25}},
+		)
+	}
+	want := blades.Usage{InputTokens: 30, OutputTokens: 13, TotalTokens: 43, Cost: 0.75}
+	prompt := blades.NewPrompt(blades.UserMessage("Write a haiku"))
+	gen, err := newChain().Run(context.Background(), prompt)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if gen.Usage == nil || *gen.Usage != want {
+		t.Errorf("Run() usage = %+v, want %+v", gen.Usage, want)
+	}
+	stream, err := newChain().RunStream(context.Background(), prompt)
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var last *blades.Generation
+	for stream.Next() {
+		if last, err = stream.Current(); err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+	}
+	if last.Usage == nil || *last.Usage != want {
+		t.Errorf("RunStream() last usage = %+v, want %+v", last.Usage, want)
+	}
+}
+
+// formatProvider answers with its text, supports the response format natively and records
+// each request with its response format.
+type formatProvider struct {
+	text     string
+	requests []*blades.ModelRequest
+	formats  []*blades.ResponseFormat
+}
+
+func (p *formatProvider) SupportsResponseFormat() bool {
+	return true
+}
+
+func (p *formatProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	opt := blades.ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	p.requests = append(p.requests, req)
+	p.formats = append(p.formats, opt.ResponseFormat)
+	return &blades.ModelResponse{Messages: []*blades.Message{blades.AssistantMessage(p.text)}}, nil
+}
+
+func (p *formatProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	res, err := p.Generate(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.ModelResponse]()
+	pipe.Send(res)
+	pipe.Close()
+	return pipe, nil
+}
+
+func TestChainOutputConverter(t *testing.T) {
+	type city struct {
+		Name string `json:"name"`
+	}
+	researcher := &formatProvider{text: "Paris is the capital of France."}
+	extractor := &formatProvider{text: `{"name":"Paris"}`}
+	chain := NewChain(
+		blades.NewAgent("researcher", blades.WithProvider(researcher)),
+		blades.NewAgent("extractor", blades.WithProvider(extractor)),
+	)
+	got, err := blades.NewOutputConverter[city](chain).Run(context.Background(), blades.NewPrompt(blades.UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got.Name != "Paris" {
+		t.Errorf("Run() = %+v", got)
+	}
+	// The response format constrains the answer of the last step only.
+	if researcher.formats[0] != nil {
+		t.Errorf("first step response format = %+v, want none", researcher.formats[0])
+	}
+	if format := extractor.formats[0]; format == nil || format.Name != "city" {
+		t.Errorf("last step response format = %+v, want the city schema", format)
+	}
+	if messages := researcher.requests[0].Messages; len(messages) != 1 || messages[0].Role != blades.RoleUser {
+		t.Errorf("first step messages = %d, want only the prompt", len(messages))
+	}
+
+	// The schema is sent as instructions when the last step does not support the response format.
+	chain = NewChain(blades.NewAgent("researcher", blades.WithProvider(researcher)), &draftRunner{})
+	if chain.SupportsResponseFormat() {
+		t.Errorf("SupportsResponseFormat() = true, want false")
+	}
+	_, _ = blades.NewOutputConverter[city](chain, blades.WithMaxRepairs(0)).Run(context.Background(), blades.NewPrompt(blades.UserMessage("The capital of France.")))
+	if messages := researcher.requests[1].Messages; messages[0].Role != blades.RoleSystem || !strings.Contains(messages[0].Text(), `"name"`) {
+		t.Errorf("first step messages = %d, want the schema instructions", len(messages))
+	}
+}
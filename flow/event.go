@@ -0,0 +1,58 @@
+package flow
+
+import (
+	"context"
+
+	"github.com/go-kratos/blades"
+)
+
+// runStep sends a step start event, followed by the events of the runner tagged with the step
+// metadata, and returns the generation the runner completed with. The caller sends the step end.
+func runStep(ctx context.Context, pipe *blades.StreamPipe[*blades.RunEvent], runner blades.Runner, prompt *blades.Prompt, step map[string]string, opts ...blades.ModelOption) (*blades.Generation, error) {
+	pipe.Send(&blades.RunEvent{Kind: blades.EventStepStart, Metadata: step})
+	stream, err := blades.RunEvents(ctx, runner, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var last *blades.Generation
+	for stream.Next() {
+		event, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		if event.Kind == blades.EventCompleted {
+			last = event.Generation
+			continue
+		}
+		pipe.Send(withEventMetadata(event, step))
+	}
+	if last == nil {
+		return nil, ErrNoResult
+	}
+	return last, nil
+}
+
+// stepEnd returns the step end event of a step that finished with the generation.
+func stepEnd(gen *blades.Generation, step map[string]string) *blades.RunEvent {
+	return &blades.RunEvent{Kind: blades.EventStepEnd, Generation: gen, Metadata: step}
+}
+
+// completed returns the final event of a run.
+func completed(gen *blades.Generation) *blades.RunEvent {
+	return &blades.RunEvent{Kind: blades.EventCompleted, Generation: gen}
+}
+
+// withEventMetadata returns a shallow copy of the event tagged with the step metadata.
+// Keys already set by a nested runner take precedence, so events keep their innermost step.
+func withEventMetadata(event *blades.RunEvent, step map[string]string) *blades.RunEvent {
+	out := *event
+	out.Metadata = make(map[string]string, len(event.Metadata)+len(step))
+	for k, v := range step {
+		out.Metadata[k] = v
+	}
+	for k, v := range event.Metadata {
+		out.Metadata[k] = v
+	}
+	return &out
+}
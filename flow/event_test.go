@@ -0,0 +1,57 @@
+package flow
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// eventLog drains the event stream and describes each event by its kind, metadata value
+// under key and delta or generation text.
+func eventLog(t *testing.T, stream blades.Streamer[*blades.RunEvent], key string) []string {
+	t.Helper()
+	defer stream.Close()
+	var got []string
+	for stream.Next() {
+		event, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		text := event.Delta
+		if event.Generation != nil {
+			text = event.Generation.Text()
+		}
+		got = append(got, fmt.Sprintf("%s:%s:%s", event.Kind, event.Metadata[key], text))
+	}
+	return got
+}
+
+func TestChainRunEvents(t *testing.T) {
+	chain := NewChain(&namedRunner{name: "writer"}, &draftRunner{})
+	stream, err := chain.RunEvents(context.Background(), blades.NewPrompt(blades.UserMessage("Write a haiku")))
+	if err != nil {
+		t.Fatalf("RunEvents() error = %v", err)
+	}
+	want := "[step_start:0: text_delta:0:partial text_delta:0:draft 1 step_end:0:draft 1 " +
+		"step_start:1: text_delta:1:partial text_delta:1:draft 1 step_end:1:draft 1 completed::draft 1]"
+	if got := eventLog(t, stream, StepKey); fmt.Sprint(got) != want {
+		t.Errorf("RunEvents() = %v, want %s", got, want)
+	}
+}
+
+func TestGraphRunEvents(t *testing.T) {
+	graph := mustGraph(t, map[string]blades.Runner{
+		"a": textNode("a"),
+		"b": textNode("b"),
+	}, []string{"a", "b"}, [][2]string{{"a", "b"}})
+	stream, err := graph.RunEvents(context.Background(), blades.NewPrompt(blades.UserMessage("start")))
+	if err != nil {
+		t.Fatalf("RunEvents() error = %v", err)
+	}
+	want := "[step_start:a: step_end:a:a(start) step_start:b: step_end:b:b(a(start)) completed::b(a(start))]"
+	if got := eventLog(t, stream, GraphNodeKey); fmt.Sprint(got) != want {
+		t.Errorf("RunEvents() = %v, want %s", got, want)
+	}
+}
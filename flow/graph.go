@@ -0,0 +1,447 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	_ blades.Runner      = (*Graph)(nil)
+	_ blades.EventRunner = (*Graph)(nil)
+)
+
+var (
+	// ErrCycle indicates the edges of a graph form a cycle that is not marked as a loop.
+	ErrCycle = errors.New("flow: graph has a cycle")
+	// ErrDuplicateNode indicates a node name is already used in the graph.
+	ErrDuplicateNode = errors.New("flow: duplicate node")
+	// ErrUnknownNode indicates an edge refers to a node that is not in the graph.
+	ErrUnknownNode = errors.New("flow: unknown node")
+)
+
+// GraphNodeKey is the Generation metadata key holding the name of the node that produced
+// a generation streamed by Graph.RunStream.
+const GraphNodeKey = "node"
+
+// defaultLoopTraversals is the number of times a loop edge is followed when AsLoop is given no limit.
+const defaultLoopTraversals = 3
+
+// NodeFunc is a plain Go function that can be used as a graph node.
+type NodeFunc func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error)
+
+// Run calls f(ctx, prompt).
+func (f NodeFunc) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	return f(ctx, prompt)
+}
+
+// RunStream calls f(ctx, prompt) and streams its generation.
+func (f NodeFunc) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		gen, err := f(ctx, prompt)
+		if err != nil {
+			return err
+		}
+		pipe.Send(gen)
+		return nil
+	})
+	return pipe, nil
+}
+
+// EdgeOption configures an edge of a Graph.
+type EdgeOption func(*graphEdge)
+
+// WithCondition makes the edge followed only when cond accepts the generation of its source node.
+func WithCondition(cond func(*blades.Generation) bool) EdgeOption {
+	return func(e *graphEdge) {
+		e.cond = cond
+	}
+}
+
+// AsLoop marks the edge as a loop edge, which may point back to an earlier node. When it is
+// followed, the target node and every node after it run again, with the generation of the
+// source node as input. A loop edge is followed at most maxTraversals times per run, 3 when
+// maxTraversals <= 0, and is usually combined with WithCondition.
+func AsLoop(maxTraversals int) EdgeOption {
+	return func(e *graphEdge) {
+		if maxTraversals <= 0 {
+			maxTraversals = defaultLoopTraversals
+		}
+		e.loop = true
+		e.maxTraversals = maxTraversals
+	}
+}
+
+type graphNode struct {
+	name   string
+	runner blades.Runner
+	in     []*graphEdge
+	out    []*graphEdge
+}
+
+type graphEdge struct {
+	from, to      *graphNode
+	cond          func(*blades.Generation) bool
+	loop          bool
+	maxTraversals int
+}
+
+// Graph is a workflow of runners connected by edges. Nodes without incoming edges receive
+// the graph prompt, and every other node receives the messages of the nodes it depends on
+// once they have all finished or been skipped. Independent nodes run concurrently, and a node
+// is skipped when none of its incoming edges is followed. The graph output concatenates the
+// generations of the nodes without outgoing edges in the order the nodes were added.
+type Graph struct {
+	nodes []*graphNode
+	index map[string]*graphNode
+}
+
+// NewGraph creates an empty graph.
+func NewGraph() *Graph {
+	return &Graph{index: make(map[string]*graphNode)}
+}
+
+// AddNode adds a runner to the graph under a unique name.
+func (g *Graph) AddNode(name string, runner blades.Runner) error {
+	if _, ok := g.index[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateNode, name)
+	}
+	node := &graphNode{name: name, runner: runner}
+	g.nodes = append(g.nodes, node)
+	g.index[name] = node
+	return nil
+}
+
+// AddFunc adds a Go function to the graph under a unique name.
+func (g *Graph) AddFunc(name string, fn NodeFunc) error {
+	return g.AddNode(name, fn)
+}
+
+// AddEdge connects two nodes, the target runs after the source. Edges that would form a cycle
+// are rejected unless marked with AsLoop.
+func (g *Graph) AddEdge(from, to string, opts ...EdgeOption) error {
+	src, ok := g.index[from]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, from)
+	}
+	dst, ok := g.index[to]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownNode, to)
+	}
+	edge := &graphEdge{from: src, to: dst}
+	for _, apply := range opts {
+		apply(edge)
+	}
+	if !edge.loop {
+		if path := g.path(dst, src); path != nil {
+			return fmt.Errorf("%w: %s -> %s", ErrCycle, from, strings.Join(path, " -> "))
+		}
+	}
+	src.out = append(src.out, edge)
+	dst.in = append(dst.in, edge)
+	return nil
+}
+
+// path returns the names of the nodes on a forward path from src to dst, or nil if there is none.
+func (g *Graph) path(src, dst *graphNode) []string {
+	if src == dst {
+		return []string{src.name}
+	}
+	visited := make(map[*graphNode]bool)
+	var walk func(n *graphNode) []string
+	walk = func(n *graphNode) []string {
+		if n == dst {
+			return []string{n.name}
+		}
+		if visited[n] {
+			return nil
+		}
+		visited[n] = true
+		for _, e := range n.out {
+			if e.loop {
+				continue
+			}
+			if rest := walk(e.to); rest != nil {
+				return append([]string{n.name}, rest...)
+			}
+		}
+		return nil
+	}
+	return walk(src)
+}
+
+// Run executes the graph and returns its output, which carries the usage of every node run.
+func (g *Graph) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	return g.execute(ctx, prompt, nil, nil, opts...)
+}
+
+// RunStream executes the graph, streaming the generation of every node as it finishes,
+// tagged with the node name, followed by the graph output.
+func (g *Graph) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		gen, err := g.execute(ctx, prompt, nil, func(node string, gen *blades.Generation) {
+			pipe.Send(withMetadata(gen, map[string]string{GraphNodeKey: node}))
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		pipe.Send(gen)
+		return nil
+	})
+	return pipe, nil
+}
+
+// RunEvents executes the graph and reports every node as a step identified by GraphNodeKey.
+// Nodes run concurrently to completion, so only their boundaries are reported. A node that is
+// reset by a loop edge while running is started again without ending its earlier step.
+func (g *Graph) RunEvents(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.RunEvent], error) {
+	pipe := blades.NewStreamPipe[*blades.RunEvent]()
+	pipe.Go(func() error {
+		gen, err := g.execute(ctx, prompt, func(node string) {
+			pipe.Send(&blades.RunEvent{Kind: blades.EventStepStart, Metadata: map[string]string{GraphNodeKey: node}})
+		}, func(node string, gen *blades.Generation) {
+			step := map[string]string{GraphNodeKey: node}
+			pipe.Send(stepEnd(withMetadata(gen, step), step))
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		pipe.Send(completed(gen))
+		return nil
+	})
+	return pipe, nil
+}
+
+// nodeStatus is the execution state of a node during a run.
+type nodeStatus int
+
+const (
+	nodePending nodeStatus = iota
+	nodeRunning
+	nodeDone
+	nodeSkipped
+)
+
+// edgeState records whether an edge was followed during a run.
+type edgeState int
+
+const (
+	edgeUnresolved edgeState = iota
+	edgeFollowed
+	edgeNotFollowed
+)
+
+// nodeResult is sent by a node goroutine when it finishes.
+type nodeResult struct {
+	node  *graphNode
+	epoch int
+	gen   *blades.Generation
+	err   error
+}
+
+// graphRun holds the state of a single execution. It is only accessed by the scheduler goroutine.
+type graphRun struct {
+	graph      *Graph
+	prompt     *blades.Prompt
+	opts       []blades.ModelOption
+	status     map[*graphNode]nodeStatus
+	output     map[*graphNode]*blades.Generation
+	epoch      map[*graphNode]int
+	edges      map[*graphEdge]edgeState
+	traversals map[*graphEdge]int
+	cancel     map[*graphNode]context.CancelFunc
+	onStart    func(string)
+	results    chan nodeResult
+	running    int
+}
+
+// execute schedules the nodes until all of them have finished or been skipped.
+// onStart, when set, observes every node that is started, and onNode the generation of every node.
+func (g *Graph) execute(ctx context.Context, prompt *blades.Prompt, onStart func(string), onNode func(string, *blades.Generation), opts ...blades.ModelOption) (*blades.Generation, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &graphRun{
+		graph:      g,
+		prompt:     prompt,
+		opts:       opts,
+		status:     make(map[*graphNode]nodeStatus),
+		output:     make(map[*graphNode]*blades.Generation),
+		epoch:      make(map[*graphNode]int),
+		edges:      make(map[*graphEdge]edgeState),
+		traversals: make(map[*graphEdge]int),
+		cancel:     make(map[*graphNode]context.CancelFunc),
+		onStart:    onStart,
+		results:    make(chan nodeResult),
+	}
+	for _, node := range g.nodes {
+		run.schedule(ctx, node)
+	}
+	var usage *blades.Usage
+	for run.running > 0 {
+		res := <-run.results
+		run.running--
+		if res.gen != nil {
+			// Nodes reset by a loop were still paid for.
+			usage = blades.SumUsage(usage, res.gen.Usage)
+		}
+		if res.epoch != run.epoch[res.node] {
+			// The node was reset by a loop while it was running.
+			continue
+		}
+		if res.err != nil {
+			return nil, fmt.Errorf("flow: node %s: %w", res.node.name, res.err)
+		}
+		if res.gen == nil {
+			return nil, fmt.Errorf("flow: node %s: %w", res.node.name, ErrNoResult)
+		}
+		run.status[res.node] = nodeDone
+		run.output[res.node] = res.gen
+		if onNode != nil {
+			onNode(res.node.name, res.gen)
+		}
+		run.complete(ctx, res.node, res.gen)
+	}
+	merged := &blades.Generation{}
+	var sinks []*blades.Generation
+	for _, node := range g.nodes {
+		if run.status[node] == nodeDone && !hasForwardEdges(node) {
+			sinks = append(sinks, run.output[node])
+			merged.Messages = append(merged.Messages, run.output[node].Messages...)
+		}
+	}
+	switch len(sinks) {
+	case 0:
+		return nil, ErrNoResult
+	case 1:
+		return withUsage(sinks[0], usage), nil
+	}
+	return withUsage(merged, usage), nil
+}
+
+// complete follows the outgoing edges of a finished node. A followed loop edge resets the
+// loop and takes precedence over the forward edges.
+func (r *graphRun) complete(ctx context.Context, node *graphNode, gen *blades.Generation) {
+	for _, e := range node.out {
+		if !e.loop || r.traversals[e] >= e.maxTraversals || (e.cond != nil && !e.cond(gen)) {
+			continue
+		}
+		r.traversals[e]++
+		r.reset(e.to)
+		r.start(ctx, e.to, blades.NewConversation(r.prompt.ConversationID, gen.Messages...))
+		return
+	}
+	r.resolve(ctx, node, gen)
+}
+
+// resolve marks the forward edges of a finished or skipped node and schedules their targets.
+func (r *graphRun) resolve(ctx context.Context, node *graphNode, gen *blades.Generation) {
+	for _, e := range node.out {
+		if e.loop {
+			continue
+		}
+		if gen != nil && (e.cond == nil || e.cond(gen)) {
+			r.edges[e] = edgeFollowed
+		} else {
+			r.edges[e] = edgeNotFollowed
+		}
+		r.schedule(ctx, e.to)
+	}
+}
+
+// schedule starts a pending node once all of its forward incoming edges are resolved, or
+// skips it when none of them was followed.
+func (r *graphRun) schedule(ctx context.Context, node *graphNode) {
+	if r.status[node] != nodePending {
+		return
+	}
+	var (
+		messages []*blades.Message
+		inputs   int
+		followed int
+	)
+	for _, e := range node.in {
+		if e.loop {
+			continue
+		}
+		inputs++
+		switch r.edges[e] {
+		case edgeUnresolved:
+			return
+		case edgeFollowed:
+			followed++
+			messages = append(messages, r.output[e.from].Messages...)
+		}
+	}
+	switch {
+	case inputs == 0:
+		r.start(ctx, node, r.prompt)
+	case followed == 0:
+		r.status[node] = nodeSkipped
+		r.resolve(ctx, node, nil)
+	default:
+		r.start(ctx, node, blades.NewConversation(r.prompt.ConversationID, messages...))
+	}
+}
+
+// start runs the node in its own goroutine. The result of a node cancelled by a reset is
+// still delivered, so that the scheduler accounts for it, and only dropped once the run ends.
+func (r *graphRun) start(ctx context.Context, node *graphNode, prompt *blades.Prompt) {
+	nodeCtx, cancel := context.WithCancel(ctx)
+	r.status[node] = nodeRunning
+	r.cancel[node] = cancel
+	r.running++
+	epoch := r.epoch[node]
+	if r.onStart != nil {
+		r.onStart(node.name)
+	}
+	go func() {
+		defer cancel()
+		gen, err := node.runner.Run(nodeCtx, prompt, r.opts...)
+		select {
+		case r.results <- nodeResult{node: node, epoch: epoch, gen: gen, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// reset returns the node and every node after it to pending so that they run again.
+// Nodes that are still running are cancelled and their results are discarded.
+func (r *graphRun) reset(node *graphNode) {
+	visited := make(map[*graphNode]bool)
+	var walk func(n *graphNode)
+	walk = func(n *graphNode) {
+		if visited[n] {
+			return
+		}
+		visited[n] = true
+		if r.status[n] == nodeRunning {
+			r.cancel[n]()
+		}
+		r.status[n] = nodePending
+		r.epoch[n]++
+		delete(r.output, n)
+		for _, e := range n.out {
+			if e.loop {
+				continue
+			}
+			delete(r.edges, e)
+			walk(e.to)
+		}
+	}
+	walk(node)
+}
+
+// hasForwardEdges reports whether the node has outgoing edges other than loop edges.
+func hasForwardEdges(node *graphNode) bool {
+	for _, e := range node.out {
+		if !e.loop {
+			return true
+		}
+	}
+	return false
+}
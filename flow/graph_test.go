@@ -0,0 +1,239 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// textNode returns a node answering with the prompt texts joined and prefixed by name.
+func textNode(name string) NodeFunc {
+	return func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		var texts []string
+		for _, msg := range prompt.Messages {
+			texts = append(texts, msg.Text())
+		}
+		return &blades.Generation{Messages: []*blades.Message{
+			blades.AssistantMessage(name + "(" + strings.Join(texts, ",") + ")"),
+		}}, nil
+	}
+}
+
+func mustGraph(t *testing.T, nodes map[string]blades.Runner, order []string, edges [][2]string) *Graph {
+	t.Helper()
+	g := NewGraph()
+	for _, name := range order {
+		if err := g.AddNode(name, nodes[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range edges {
+		if err := g.AddEdge(e[0], e[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return g
+}
+
+func TestGraphJoin(t *testing.T) {
+	// a and b only finish once both are running, which fails unless they run concurrently.
+	var started atomic.Int32
+	both := make(chan struct{})
+	concurrent := func(name string) NodeFunc {
+		return func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+			if started.Add(1) == 2 {
+				close(both)
+			}
+			select {
+			case <-both:
+			case <-time.After(time.Second):
+				return nil, errors.New("branches did not run concurrently")
+			}
+			return textNode(name)(ctx, prompt)
+		}
+	}
+	g := mustGraph(t, map[string]blades.Runner{
+		"start": textNode("start"),
+		"a":     concurrent("a"),
+		"b":     concurrent("b"),
+		"join":  textNode("join"),
+	}, []string{"start", "a", "b", "join"}, [][2]string{
+		{"start", "a"}, {"start", "b"}, {"a", "join"}, {"b", "join"},
+	})
+	gen, err := g.Run(context.Background(), blades.NewPrompt(blades.UserMessage("in")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if want := "join(a(start(in)),b(start(in)))"; gen.Text() != want {
+		t.Errorf("Run() = %q, want %q", gen.Text(), want)
+	}
+}
+
+func TestGraphConditionalEdges(t *testing.T) {
+	g := NewGraph()
+	_ = g.AddFunc("classify", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("negative")}}, nil
+	})
+	_ = g.AddFunc("thank", textNode("thank"))
+	_ = g.AddFunc("apologize", textNode("apologize"))
+	_ = g.AddFunc("survey", textNode("survey"))
+	is := func(label string) EdgeOption {
+		return WithCondition(func(gen *blades.Generation) bool { return gen.Text() == label })
+	}
+	_ = g.AddEdge("classify", "thank", is("positive"))
+	_ = g.AddEdge("classify", "apologize", is("negative"))
+	_ = g.AddEdge("thank", "survey")
+	gen, err := g.Run(context.Background(), blades.NewPrompt(blades.UserMessage("It broke")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	// thank is skipped, and so is survey which only depends on it.
+	if gen.Text() != "apologize(negative)" || len(gen.Messages) != 1 {
+		t.Errorf("Run() = %v", texts(gen))
+	}
+}
+
+func TestGraphCycle(t *testing.T) {
+	g := mustGraph(t, map[string]blades.Runner{
+		"a": textNode("a"), "b": textNode("b"), "c": textNode("c"),
+	}, []string{"a", "b", "c"}, [][2]string{{"a", "b"}, {"b", "c"}})
+	if err := g.AddEdge("c", "a"); !errors.Is(err, ErrCycle) {
+		t.Errorf("AddEdge(c, a) error = %v, want ErrCycle", err)
+	}
+	if err := g.AddEdge("a", "a"); !errors.Is(err, ErrCycle) {
+		t.Errorf("AddEdge(a, a) error = %v, want ErrCycle", err)
+	}
+	if err := g.AddEdge("c", "a", AsLoop(1)); err != nil {
+		t.Errorf("AddEdge(c, a, AsLoop) error = %v", err)
+	}
+	if err := g.AddEdge("a", "missing"); !errors.Is(err, ErrUnknownNode) {
+		t.Errorf("AddEdge(a, missing) error = %v, want ErrUnknownNode", err)
+	}
+	if err := g.AddNode("a", textNode("a")); !errors.Is(err, ErrDuplicateNode) {
+		t.Errorf("AddNode(a) error = %v, want ErrDuplicateNode", err)
+	}
+}
+
+func TestGraphLoop(t *testing.T) {
+	var drafts int
+	g := NewGraph()
+	_ = g.AddFunc("write", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		drafts++
+		return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage(fmt.Sprint("draft ", drafts))}}, nil
+	})
+	_ = g.AddFunc("review", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		verdict := "revise"
+		if prompt.Messages[0].Text() == "draft 3" {
+			verdict = "approved"
+		}
+		return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage(verdict)}}, nil
+	})
+	_ = g.AddEdge("write", "review")
+	_ = g.AddEdge("review", "write", AsLoop(5), WithCondition(func(gen *blades.Generation) bool {
+		return gen.Text() == "revise"
+	}))
+	gen, err := g.Run(context.Background(), blades.NewPrompt(blades.UserMessage("Write a poem")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if gen.Text() != "approved" || drafts != 3 {
+		t.Errorf("Run() = %q after %d drafts, want approved after 3", gen.Text(), drafts)
+	}
+
+	// The loop edge is not followed again once its limit is reached.
+	drafts = 0
+	g2 := NewGraph()
+	_ = g2.AddFunc("write", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		drafts++
+		return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("draft")}}, nil
+	})
+	_ = g2.AddEdge("write", "write", AsLoop(2))
+	if _, err := g2.Run(context.Background(), blades.NewPrompt()); err != nil || drafts != 3 {
+		t.Errorf("Run() drafts = %d, %v, want 3", drafts, err)
+	}
+}
+
+func TestGraphLoopCancelsRunningBranch(t *testing.T) {
+	// c is still running when b loops back to a, and only finishes once cancelled by the reset.
+	// The cancelled node races the scheduler, so the graph runs several times.
+	for i := 0; i < 10; i++ {
+		testGraphLoopReset(t)
+	}
+}
+
+func testGraphLoopReset(t *testing.T) {
+	t.Helper()
+	var calls atomic.Int32
+	looped := make(chan struct{})
+	g := NewGraph()
+	_ = g.AddFunc("a", textNode("a"))
+	_ = g.AddFunc("b", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		if calls.Add(1) == 2 {
+			close(looped)
+		}
+		return textNode("b")(ctx, prompt)
+	})
+	_ = g.AddFunc("c", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-looped:
+		}
+		return textNode("c")(ctx, prompt)
+	})
+	_ = g.AddEdge("a", "b")
+	_ = g.AddEdge("a", "c")
+	_ = g.AddEdge("b", "a", AsLoop(1))
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.Run(context.Background(), blades.NewPrompt(blades.UserMessage("in")))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after the loop reset a running node")
+	}
+}
+
+func TestGraphRunStream(t *testing.T) {
+	g := mustGraph(t, map[string]blades.Runner{
+		"a": textNode("a"), "b": textNode("b"),
+	}, []string{"a", "b"}, [][2]string{{"a", "b"}})
+	stream, err := g.RunStream(context.Background(), blades.NewPrompt(blades.UserMessage("in")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var got []string
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		got = append(got, gen.Metadata[GraphNodeKey]+":"+gen.Text())
+	}
+	if want := "[a:a(in) b:b(a(in)) :b(a(in))]"; fmt.Sprint(got) != want {
+		t.Errorf("RunStream() = %v, want %s", got, want)
+	}
+}
+
+func TestGraphError(t *testing.T) {
+	g := NewGraph()
+	_ = g.AddFunc("fail", func(ctx context.Context, prompt *blades.Prompt) (*blades.Generation, error) {
+		return nil, errors.New("boom")
+	})
+	_, err := g.Run(context.Background(), blades.NewPrompt())
+	if err == nil || err.Error() != "flow: node fail: boom" {
+		t.Errorf("Run() error = %v, want node error", err)
+	}
+}
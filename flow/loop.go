@@ -0,0 +1,285 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	_ blades.Runner      = (*Loop)(nil)
+	_ blades.EventRunner = (*Loop)(nil)
+)
+
+const (
+	// LoopIterationKey is the Generation metadata key holding the 1-based iteration that produced it.
+	LoopIterationKey = "loop_iteration"
+	// LoopPassedKey is the Generation metadata key set to "true" when the evaluator accepted the generation.
+	LoopPassedKey = "loop_passed"
+)
+
+// defaultLoopIterations is the default maximum number of iterations of a Loop.
+const defaultLoopIterations = 3
+
+// evaluatorInstructions asks an evaluator runner for a verdict that EvaluateWith can parse.
+const evaluatorInstructions = `Evaluate the response to the task below. Answer with a JSON object of the form {"pass": true|false, "feedback": "..."}.
+Set pass to true only if the response needs no further changes, otherwise explain what to improve in feedback.`
+
+// Evaluation is the verdict of an evaluator on a generation.
+type Evaluation struct {
+	// Pass reports whether the generation is accepted and the loop can stop.
+	Pass bool `json:"pass"`
+	// Feedback is sent to the runner in the next iteration when the generation is rejected.
+	Feedback string `json:"feedback"`
+	// Usage is the usage of the evaluator, it is added to the usage of the loop.
+	Usage *blades.Usage `json:"-"`
+}
+
+// EvaluateFunc evaluates the generation of an iteration against the task, the prompt the loop
+// was run with.
+type EvaluateFunc func(ctx context.Context, task *blades.Prompt, gen *blades.Generation) (*Evaluation, error)
+
+// Until returns an EvaluateFunc that accepts a generation when pred returns true.
+func Until(pred func(*blades.Generation) bool) EvaluateFunc {
+	return func(ctx context.Context, task *blades.Prompt, gen *blades.Generation) (*Evaluation, error) {
+		return &Evaluation{Pass: pred(gen)}, nil
+	}
+}
+
+// EvaluateWith returns an EvaluateFunc that asks the evaluator runner to critique the generation.
+// The task and the generation are sent together in a single user message, so that the evaluator
+// judges the generation instead of continuing it. The evaluator should answer with a JSON
+// Evaluation; a plain answer starting with "PASS" is accepted and any other answer is used as feedback.
+func EvaluateWith(evaluator blades.Runner) EvaluateFunc {
+	return func(ctx context.Context, task *blades.Prompt, gen *blades.Generation) (*Evaluation, error) {
+		res, err := evaluator.Run(ctx, blades.NewPrompt(
+			blades.SystemMessage(evaluatorInstructions),
+			blades.UserMessage(evaluationRequest(task, gen)),
+		))
+		if err != nil {
+			return nil, err
+		}
+		eval := parseEvaluation(res.Text())
+		eval.Usage = res.Usage
+		return eval, nil
+	}
+}
+
+// evaluationRequest quotes the messages of the task and the text of the generation.
+func evaluationRequest(task *blades.Prompt, gen *blades.Generation) string {
+	var b strings.Builder
+	b.WriteString("<task>\n")
+	for _, msg := range task.Messages {
+		fmt.Fprintf(&b, "%s: %s\n", msg.Role, msg.Text())
+	}
+	b.WriteString("</task>\n<response>\n")
+	b.WriteString(gen.Text())
+	b.WriteString("\n</response>")
+	return b.String()
+}
+
+// parseEvaluation reads an evaluator answer, which may be wrapped in a Markdown code block.
+func parseEvaluation(text string) *Evaluation {
+	text = strings.TrimSpace(text)
+	trimmed := strings.TrimPrefix(text, "```json")
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	trimmed = strings.TrimSpace(strings.TrimSuffix(trimmed, "```"))
+	var eval Evaluation
+	if err := json.Unmarshal([]byte(trimmed), &eval); err == nil {
+		return &eval
+	}
+	if strings.HasPrefix(strings.ToUpper(text), "PASS") {
+		return &Evaluation{Pass: true}
+	}
+	return &Evaluation{Feedback: text}
+}
+
+// LoopOption configures a Loop.
+type LoopOption func(*Loop)
+
+// WithMaxIterations sets the maximum number of times the runner is run, the default is 3.
+func WithMaxIterations(n int) LoopOption {
+	return func(l *Loop) {
+		l.maxIterations = n
+	}
+}
+
+// Loop runs a runner repeatedly until an evaluator accepts its generation or the maximum
+// number of iterations is reached, as in draft, critique and revise workflows.
+type Loop struct {
+	runner        blades.Runner
+	evaluate      EvaluateFunc
+	maxIterations int
+}
+
+// NewLoop creates a new Loop that runs runner until evaluate accepts the generation.
+func NewLoop(runner blades.Runner, evaluate EvaluateFunc, opts ...LoopOption) *Loop {
+	l := &Loop{
+		runner:        runner,
+		evaluate:      evaluate,
+		maxIterations: defaultLoopIterations,
+	}
+	for _, apply := range opts {
+		apply(l)
+	}
+	return l
+}
+
+// Run runs the loop and returns the last generation. Each iteration receives the prompt of
+// the previous one, followed by its generation and the evaluator feedback, or only the
+// feedback when the runner keeps the conversation, see blades.KeepsConversation. When no generation is accepted
+// within the maximum iterations, the last one is returned with LoopPassedKey set to "false".
+// The returned generation carries the usage of every iteration and evaluation.
+func (l *Loop) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	var (
+		task  = prompt
+		last  *blades.Generation
+		usage *blades.Usage
+	)
+	for i := 1; i <= l.maxIterations; i++ {
+		gen, err := l.runner.Run(ctx, prompt, opts...)
+		if err != nil {
+			return nil, err
+		}
+		eval, err := l.evaluate(ctx, task, gen)
+		if err != nil {
+			return nil, err
+		}
+		usage = blades.SumUsage(usage, gen.Usage, eval.Usage)
+		last = withUsage(withIteration(gen, i, eval.Pass), usage)
+		if eval.Pass {
+			return last, nil
+		}
+		prompt = l.nextPrompt(prompt, gen, eval)
+	}
+	if last == nil {
+		return nil, ErrNoResult
+	}
+	return last, nil
+}
+
+// RunStream runs the loop and streams every iteration. The completed generation of each
+// iteration is sent after it has been evaluated, tagged with the iteration and verdict, and
+// carries the usage of the loop so far.
+func (l *Loop) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		var (
+			task  = prompt
+			last  *blades.Generation
+			usage *blades.Usage
+		)
+		for i := 1; i <= l.maxIterations; i++ {
+			stream, err := l.runner.RunStream(ctx, prompt, opts...)
+			if err != nil {
+				return err
+			}
+			gen, err := forwardAllButLast(pipe, stream)
+			if err != nil {
+				return err
+			}
+			eval, err := l.evaluate(ctx, task, gen)
+			if err != nil {
+				return err
+			}
+			usage = blades.SumUsage(usage, gen.Usage, eval.Usage)
+			last = withUsage(withIteration(gen, i, eval.Pass), usage)
+			pipe.Send(last)
+			if eval.Pass {
+				return nil
+			}
+			prompt = l.nextPrompt(prompt, gen, eval)
+		}
+		if last == nil {
+			return ErrNoResult
+		}
+		return nil
+	})
+	return pipe, nil
+}
+
+// RunEvents runs the loop and reports every iteration as a step identified by LoopIterationKey.
+// The step end carries the evaluated generation tagged with the iteration and verdict.
+func (l *Loop) RunEvents(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.RunEvent], error) {
+	pipe := blades.NewStreamPipe[*blades.RunEvent]()
+	pipe.Go(func() error {
+		var (
+			task  = prompt
+			last  *blades.Generation
+			usage *blades.Usage
+		)
+		for i := 1; i <= l.maxIterations; i++ {
+			step := map[string]string{LoopIterationKey: strconv.Itoa(i)}
+			gen, err := runStep(ctx, pipe, l.runner, prompt, step, opts...)
+			if err != nil {
+				return err
+			}
+			eval, err := l.evaluate(ctx, task, gen)
+			if err != nil {
+				return err
+			}
+			usage = blades.SumUsage(usage, gen.Usage, eval.Usage)
+			last = withUsage(withIteration(gen, i, eval.Pass), usage)
+			pipe.Send(stepEnd(last, last.Metadata))
+			if eval.Pass {
+				break
+			}
+			prompt = l.nextPrompt(prompt, gen, eval)
+		}
+		if last == nil {
+			return ErrNoResult
+		}
+		pipe.Send(completed(last))
+		return nil
+	})
+	return pipe, nil
+}
+
+// forwardAllButLast sends every generation of the stream to the pipe except the last one,
+// which is returned as the completed generation.
+func forwardAllButLast(pipe *blades.StreamPipe[*blades.Generation], stream blades.Streamer[*blades.Generation]) (*blades.Generation, error) {
+	defer stream.Close()
+	var last *blades.Generation
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			pipe.Send(last)
+		}
+		last = gen
+	}
+	if last == nil {
+		return nil, ErrNoResult
+	}
+	return last, nil
+}
+
+// nextPrompt continues the prompt of an iteration with its generation and the evaluator
+// feedback. A runner keeping the conversation already stored the prompt and the generation,
+// so it is sent only the feedback.
+func (l *Loop) nextPrompt(prompt *blades.Prompt, gen *blades.Generation, eval *Evaluation) *blades.Prompt {
+	var messages []*blades.Message
+	if !blades.KeepsConversation(l.runner) {
+		messages = make([]*blades.Message, 0, len(prompt.Messages)+len(gen.Messages)+1)
+		messages = append(messages, prompt.Messages...)
+		messages = append(messages, gen.Messages...)
+	}
+	if eval.Feedback != "" {
+		messages = append(messages, blades.UserMessage(eval.Feedback))
+	}
+	return blades.NewConversation(prompt.ConversationID, messages...)
+}
+
+// withIteration returns a copy of the generation tagged with the loop iteration and verdict.
+func withIteration(gen *blades.Generation, iteration int, passed bool) *blades.Generation {
+	return withMetadata(gen, map[string]string{
+		LoopIterationKey: strconv.Itoa(iteration),
+		LoopPassedKey:    strconv.FormatBool(passed),
+	})
+}
@@ -0,0 +1,183 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// draftRunner answers with a numbered draft and records the prompts it receives.
+// It reports keeping the conversation when keeps is set.
+type draftRunner struct {
+	prompts []*blades.Prompt
+	keeps   bool
+}
+
+func (r *draftRunner) KeepsConversation() bool {
+	return r.keeps
+}
+
+func (r *draftRunner) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	r.prompts = append(r.prompts, prompt)
+	return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage(fmt.Sprintf("draft %d", len(r.prompts)))}}, nil
+}
+
+func (r *draftRunner) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	gen, err := r.Run(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Send(&blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("partial")}})
+	pipe.Send(gen)
+	pipe.Close()
+	return pipe, nil
+}
+
+func TestLoopUntil(t *testing.T) {
+	writer := &draftRunner{}
+	loop := NewLoop(writer, Until(func(gen *blades.Generation) bool { return gen.Text() == "draft 2" }))
+	gen, err := loop.Run(context.Background(), blades.NewConversation("conv", blades.UserMessage("Write a haiku")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if gen.Text() != "draft 2" || gen.Metadata[LoopIterationKey] != "2" || gen.Metadata[LoopPassedKey] != "true" {
+		t.Errorf("Run() = %q %v", gen.Text(), gen.Metadata)
+	}
+	second := writer.prompts[1]
+	if second.ConversationID != "conv" || len(second.Messages) != 2 || second.Messages[0].Text() != "Write a haiku" || second.Messages[1].Text() != "draft 1" {
+		t.Errorf("second prompt = %+v", second)
+	}
+}
+
+func TestLoopNextPrompt(t *testing.T) {
+	tests := []struct {
+		name  string
+		keeps bool
+		want  []string
+	}{
+		{name: "stateless", want: []string{"Write a haiku", "draft 1", "Use fewer words."}},
+		{name: "keeps conversation", keeps: true, want: []string{"Use fewer words."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer := &draftRunner{keeps: tt.keeps}
+			loop := NewLoop(writer, EvaluateWith(&stubRunner{text: "Use fewer words."}), WithMaxIterations(2))
+			if _, err := loop.Run(context.Background(), blades.NewConversation("conv", blades.UserMessage("Write a haiku"))); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			var got []string
+			for _, msg := range writer.prompts[1].Messages {
+				got = append(got, msg.Text())
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("second prompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoopEvaluateWith(t *testing.T) {
+	writer := &draftRunner{}
+	tests := []struct {
+		name       string
+		answer     string
+		iterations int
+		passed     string
+		feedback   string
+	}{
+		{name: "json pass", answer: "```json\n{\"pass\": true}\n```", iterations: 1, passed: "true"},
+		{name: "plain pass", answer: "PASS, looks good", iterations: 1, passed: "true"},
+		{name: "feedback", answer: `{"pass": false, "feedback": "Use fewer words."}`, iterations: 2, passed: "false", feedback: "Use fewer words."},
+		{name: "plain feedback", answer: "Too long.", iterations: 2, passed: "false", feedback: "Too long."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writer.prompts = nil
+			loop := NewLoop(writer, EvaluateWith(&stubRunner{text: tt.answer}), WithMaxIterations(2))
+			gen, err := loop.Run(context.Background(), blades.NewPrompt(blades.UserMessage("Write a haiku")))
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if len(writer.prompts) != tt.iterations || gen.Metadata[LoopPassedKey] != tt.passed {
+				t.Errorf("Run() iterations = %d, passed = %q, want %d, %q", len(writer.prompts), gen.Metadata[LoopPassedKey], tt.iterations, tt.passed)
+			}
+			if tt.feedback != "" {
+				msgs := writer.prompts[1].Messages
+				if last := msgs[len(msgs)-1]; last.Role != blades.RoleUser || last.Text() != tt.feedback {
+					t.Errorf("feedback message = %+v", last)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateWithPrompt(t *testing.T) {
+	evaluator := &draftRunner{}
+	task := blades.NewPrompt(blades.UserMessage("Write a haiku"))
+	draft := &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("An old silent pond")}}
+	if _, err := EvaluateWith(evaluator)(context.Background(), task, draft); err != nil {
+		t.Fatalf("EvaluateWith() error = %v", err)
+	}
+	msgs := evaluator.prompts[0].Messages
+	if len(msgs) != 2 || msgs[0].Role != blades.RoleSystem || msgs[1].Role != blades.RoleUser {
+		t.Fatalf("evaluator prompt = %d messages, want the instructions and a single user message", len(msgs))
+	}
+	if text := msgs[1].Text(); !strings.Contains(text, "Write a haiku") || !strings.Contains(text, "An old silent pond") {
+		t.Errorf("evaluator request = %q, want the task and the draft", text)
+	}
+
+	// The task is the prompt of the loop, not the prompt of the iteration.
+	evaluator.prompts = nil
+	loop := NewLoop(&draftRunner{}, EvaluateWith(evaluator), WithMaxIterations(2))
+	if _, err := loop.Run(context.Background(), task); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if text := evaluator.prompts[1].Messages[1].Text(); !strings.Contains(text, "Write a haiku") || !strings.Contains(text, "draft 2") {
+		t.Errorf("second evaluator request = %q, want the task and the second draft", text)
+	}
+}
+
+func TestLoopRunStream(t *testing.T) {
+	loop := NewLoop(&draftRunner{}, Until(func(gen *blades.Generation) bool { return gen.Text() == "draft 2" }))
+	stream, err := loop.RunStream(context.Background(), blades.NewPrompt(blades.UserMessage("Write a haiku")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var got []string
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		got = append(got, gen.Text()+"/"+gen.Metadata[LoopPassedKey])
+	}
+	if want := "[partial/ draft 1/false partial/ draft 2/true]"; fmt.Sprint(got) != want {
+		t.Errorf("RunStream() = %v, want %s", got, want)
+	}
+}
+
+func TestLoopNoIterations(t *testing.T) {
+	loop := NewLoop(&draftRunner{}, Until(func(gen *blades.Generation) bool { return true }), WithMaxIterations(0))
+	if _, err := loop.Run(context.Background(), blades.NewPrompt()); !errors.Is(err, ErrNoResult) {
+		t.Errorf("Run() error = %v, want %v", err, ErrNoResult)
+	}
+	stream, err := loop.RunStream(context.Background(), blades.NewPrompt())
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	for stream.Next() {
+		if _, err = stream.Current(); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrNoResult) {
+		t.Errorf("RunStream() error = %v, want %v", err, ErrNoResult)
+	}
+}
@@ -0,0 +1,27 @@
+package flow
+
+import "github.com/go-kratos/blades"
+
+// withMetadata returns a shallow copy of the generation with the given metadata added,
+// so that generations shared with the caller of a runner are not modified.
+func withMetadata(gen *blades.Generation, metadata map[string]string) *blades.Generation {
+	if gen == nil {
+		return nil
+	}
+	out := *gen
+	out.Metadata = make(map[string]string, len(gen.Metadata)+len(metadata))
+	for k, v := range gen.Metadata {
+		out.Metadata[k] = v
+	}
+	for k, v := range metadata {
+		out.Metadata[k] = v
+	}
+	return &out
+}
+
+// withUsage returns a shallow copy of the generation carrying the usage.
+func withUsage(gen *blades.Generation, usage *blades.Usage) *blades.Generation {
+	out := *gen
+	out.Usage = usage
+	return &out
+}
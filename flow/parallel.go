@@ -0,0 +1,253 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	_ blades.Runner      = (*Parallel)(nil)
+	_ blades.EventRunner = (*Parallel)(nil)
+)
+
+// BranchKey is the RunEvent metadata key holding the index of the Parallel runner a step belongs to.
+const BranchKey = "branch"
+
+var (
+	// ErrNoResult indicates that no runner of a Parallel produced a generation.
+	ErrNoResult = errors.New("flow: no result")
+)
+
+// Result is the outcome of a single runner of a Parallel.
+type Result struct {
+	// Index is the position of the runner in the Parallel.
+	Index      int
+	Generation *blades.Generation
+	Err        error
+}
+
+// MergeFunc consumes results in completion order and combines them into a single generation.
+// The results channel is closed once every runner has finished. A merge may return before
+// that, in which case the remaining runners are cancelled.
+type MergeFunc func(ctx context.Context, results <-chan Result) (*blades.Generation, error)
+
+// Parallel runs several runners concurrently on the same prompt and merges their generations.
+type Parallel struct {
+	merge   MergeFunc
+	runners []blades.Runner
+}
+
+// NewParallel creates a new Parallel that merges the generations of the runners with merge.
+func NewParallel(merge MergeFunc, runners ...blades.Runner) *Parallel {
+	return &Parallel{
+		merge:   merge,
+		runners: runners,
+	}
+}
+
+// Run dispatches the prompt to every runner concurrently and returns the merged generation.
+// Runners that are still running when the merge returns are cancelled. The merged generation
+// carries the usage of every runner whose result the merge received.
+func (p *Parallel) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	return p.observe(ctx, prompt, func(Result) {}, opts...)
+}
+
+// RunStream dispatches the prompt to every runner concurrently and streams each generation
+// consumed by the merge as it completes, followed by the merged generation.
+func (p *Parallel) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		merged, err := p.observe(ctx, prompt, func(res Result) {
+			pipe.Send(res.Generation)
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		pipe.Send(merged)
+		return nil
+	})
+	return pipe, nil
+}
+
+// RunEvents dispatches the prompt to every runner concurrently and reports every runner as a
+// step identified by BranchKey and RunnerKey. Runners are run to completion, so only their
+// boundaries are reported, the step end is sent once the merge has consumed the result.
+func (p *Parallel) RunEvents(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.RunEvent], error) {
+	pipe := blades.NewStreamPipe[*blades.RunEvent]()
+	pipe.Go(func() error {
+		steps := make([]map[string]string, len(p.runners))
+		for i, runner := range p.runners {
+			steps[i] = map[string]string{
+				BranchKey: strconv.Itoa(i),
+				RunnerKey: runnerName(runner),
+			}
+			pipe.Send(&blades.RunEvent{Kind: blades.EventStepStart, Metadata: steps[i]})
+		}
+		merged, err := p.observe(ctx, prompt, func(res Result) {
+			pipe.Send(stepEnd(withMetadata(res.Generation, steps[res.Index]), steps[res.Index]))
+		}, opts...)
+		if err != nil {
+			return err
+		}
+		pipe.Send(completed(merged))
+		return nil
+	})
+	return pipe, nil
+}
+
+// observe runs the runners and merges their results, passing each successful result to
+// onResult once the merge has received it, so that results of cancelled stragglers are not
+// observed after the merge returns. The merged generation carries the usage of those results.
+// It returns as soon as the merge does, stragglers finish in the background and their results
+// are dropped into the buffered results channel.
+func (p *Parallel) observe(ctx context.Context, prompt *blades.Prompt, onResult func(Result), opts ...blades.ModelOption) (*blades.Generation, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := p.start(ctx, prompt, opts...)
+	forwarded := make(chan Result)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	var usage *blades.Usage
+	go func() {
+		defer close(done)
+		defer close(forwarded)
+		for {
+			var res Result
+			select {
+			case r, ok := <-results:
+				if !ok {
+					return
+				}
+				res = r
+			case <-stop:
+				return
+			}
+			select {
+			case forwarded <- res:
+			case <-stop:
+				return
+			}
+			if res.Err == nil {
+				usage = blades.SumUsage(usage, res.Generation.Usage)
+				onResult(res)
+			}
+		}
+	}()
+	merged, err := p.merge(ctx, forwarded)
+	cancel()
+	close(stop)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	return withUsage(merged, usage), nil
+}
+
+// start runs every runner in its own goroutine and returns the channel of their results.
+func (p *Parallel) start(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) <-chan Result {
+	results := make(chan Result, len(p.runners))
+	var wg sync.WaitGroup
+	for i, runner := range p.runners {
+		wg.Add(1)
+		go func(i int, runner blades.Runner) {
+			defer wg.Done()
+			gen, err := runner.Run(ctx, prompt, opts...)
+			if err == nil && gen == nil {
+				err = ErrNoResult
+			}
+			results <- Result{Index: i, Generation: gen, Err: err}
+		}(i, runner)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// Concat waits for every runner and concatenates their messages in runner order.
+// It fails as soon as any runner fails.
+func Concat() MergeFunc {
+	return func(ctx context.Context, results <-chan Result) (*blades.Generation, error) {
+		var collected []Result
+		for res := range results {
+			if res.Err != nil {
+				return nil, res.Err
+			}
+			collected = append(collected, res)
+		}
+		ordered := make([]*blades.Generation, len(collected))
+		for _, res := range collected {
+			if res.Index < len(ordered) {
+				ordered[res.Index] = res.Generation
+			}
+		}
+		merged := &blades.Generation{}
+		for _, gen := range ordered {
+			if gen != nil {
+				merged.Messages = append(merged.Messages, gen.Messages...)
+			}
+		}
+		return merged, nil
+	}
+}
+
+// PickFirst returns the first generation to complete successfully and cancels the other runners.
+// It fails only when every runner fails.
+func PickFirst() MergeFunc {
+	return func(ctx context.Context, results <-chan Result) (*blades.Generation, error) {
+		var errs []error
+		for res := range results {
+			if res.Err == nil {
+				return res.Generation, nil
+			}
+			errs = append(errs, res.Err)
+		}
+		return nil, errors.Join(append([]error{ErrNoResult}, errs...)...)
+	}
+}
+
+// Vote waits for every runner and returns the generation whose key is shared by the most runners,
+// ties go to the runner listed first. Failed runners do not vote. A nil key compares the trimmed
+// text of the generations.
+func Vote(key func(*blades.Generation) string) MergeFunc {
+	if key == nil {
+		key = func(gen *blades.Generation) string {
+			return strings.TrimSpace(gen.Text())
+		}
+	}
+	return func(ctx context.Context, results <-chan Result) (*blades.Generation, error) {
+		var (
+			errs   []error
+			counts = make(map[string]int)
+			first  = make(map[string]Result)
+		)
+		for res := range results {
+			if res.Err != nil {
+				errs = append(errs, res.Err)
+				continue
+			}
+			k := key(res.Generation)
+			counts[k]++
+			if prev, ok := first[k]; !ok || res.Index < prev.Index {
+				first[k] = res
+			}
+		}
+		var winner *Result
+		for k, res := range first {
+			if winner == nil || counts[k] > counts[key(winner.Generation)] ||
+				(counts[k] == counts[key(winner.Generation)] && res.Index < winner.Index) {
+				winner = &res
+			}
+		}
+		if winner == nil {
+			return nil, errors.Join(append([]error{ErrNoResult}, errs...)...)
+		}
+		return winner.Generation, nil
+	}
+}
@@ -0,0 +1,172 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+// stubRunner answers with a fixed text after a delay, or fails with err.
+type stubRunner struct {
+	text      string
+	delay     time.Duration
+	err       error
+	cancelled chan struct{}
+}
+
+func (r *stubRunner) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	select {
+	case <-time.After(r.delay):
+	case <-ctx.Done():
+		if r.cancelled != nil {
+			close(r.cancelled)
+		}
+		return nil, ctx.Err()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage(r.text)}}, nil
+}
+
+func (r *stubRunner) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		gen, err := r.Run(ctx, prompt, opts...)
+		if err != nil {
+			return err
+		}
+		pipe.Send(gen)
+		return nil
+	})
+	return pipe, nil
+}
+
+func texts(gen *blades.Generation) []string {
+	var out []string
+	for _, msg := range gen.Messages {
+		out = append(out, msg.Text())
+	}
+	return out
+}
+
+func TestParallelConcat(t *testing.T) {
+	p := NewParallel(Concat(),
+		&stubRunner{text: "a", delay: 20 * time.Millisecond},
+		&stubRunner{text: "b"},
+		&stubRunner{text: "c", delay: 10 * time.Millisecond},
+	)
+	gen, err := p.Run(context.Background(), blades.NewPrompt(blades.UserMessage("go")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := texts(gen); len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Errorf("Run() = %v, want [a b c]", got)
+	}
+
+	failing := NewParallel(Concat(), &stubRunner{text: "a"}, &stubRunner{err: errors.New("boom")})
+	if _, err := failing.Run(context.Background(), blades.NewPrompt()); err == nil || err.Error() != "boom" {
+		t.Errorf("Run() error = %v, want boom", err)
+	}
+}
+
+func TestParallelPickFirst(t *testing.T) {
+	slow := &stubRunner{text: "slow", delay: time.Second, cancelled: make(chan struct{})}
+	p := NewParallel(PickFirst(), slow, &stubRunner{err: errors.New("boom")}, &stubRunner{text: "fast", delay: 5 * time.Millisecond})
+	gen, err := p.Run(context.Background(), blades.NewPrompt())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if gen.Text() != "fast" {
+		t.Errorf("Run() = %q, want fast", gen.Text())
+	}
+	select {
+	case <-slow.cancelled:
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("straggler was not cancelled")
+	}
+
+	failing := NewParallel(PickFirst(), &stubRunner{err: errors.New("boom")})
+	if _, err := failing.Run(context.Background(), blades.NewPrompt()); !errors.Is(err, ErrNoResult) {
+		t.Errorf("Run() error = %v, want ErrNoResult", err)
+	}
+}
+
+// stuckRunner ignores cancellation and answers only once release is closed.
+type stuckRunner struct {
+	release chan struct{}
+}
+
+func (r *stuckRunner) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	<-r.release
+	return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("stuck")}}, nil
+}
+
+func (r *stuckRunner) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestParallelIgnoresStragglers(t *testing.T) {
+	stuck := &stuckRunner{release: make(chan struct{})}
+	defer close(stuck.release)
+	p := NewParallel(PickFirst(), stuck, &stubRunner{text: "fast"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gen, err := p.Run(context.Background(), blades.NewPrompt())
+		if err != nil {
+			t.Errorf("Run() error = %v", err)
+			return
+		}
+		if gen.Text() != "fast" {
+			t.Errorf("Run() = %q, want fast", gen.Text())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() waited for a runner that ignores cancellation")
+	}
+}
+
+func TestParallelVote(t *testing.T) {
+	p := NewParallel(Vote(nil),
+		&stubRunner{text: "Paris"},
+		&stubRunner{text: "Lyon"},
+		&stubRunner{text: " Paris "},
+		&stubRunner{err: errors.New("boom")},
+	)
+	gen, err := p.Run(context.Background(), blades.NewPrompt())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if gen.Text() != "Paris" {
+		t.Errorf("Run() = %q, want Paris", gen.Text())
+	}
+}
+
+func TestParallelRunStream(t *testing.T) {
+	p := NewParallel(Concat(), &stubRunner{text: "a"}, &stubRunner{text: "b", delay: 10 * time.Millisecond})
+	stream, err := p.RunStream(context.Background(), blades.NewPrompt())
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var gens []*blades.Generation
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		gens = append(gens, gen)
+	}
+	if len(gens) != 3 {
+		t.Fatalf("RunStream() yielded %d generations, want 3", len(gens))
+	}
+	if gens[0].Text() != "a" || gens[1].Text() != "b" || len(gens[2].Messages) != 2 {
+		t.Errorf("RunStream() = %v, %v, %v", texts(gens[0]), texts(gens[1]), texts(gens[2]))
+	}
+}
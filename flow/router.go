@@ -0,0 +1,322 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-kratos/blades"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+var (
+	_ blades.Runner      = (*Router)(nil)
+	_ blades.EventRunner = (*Router)(nil)
+)
+
+var (
+	// ErrInvalidRoute indicates the classifier chose a route that does not exist and no default route is set.
+	ErrInvalidRoute = errors.New("flow: invalid route")
+)
+
+const (
+	// RouteKey is the Generation metadata key holding the name of the chosen route.
+	RouteKey = "route"
+	// RouteFallbackKey is the Generation metadata key set to "true" when the default route was used
+	// because the classifier did not choose a valid route.
+	RouteFallbackKey = "route_fallback"
+)
+
+// selectRouteTool is the name of the tool offered to the model by a tool-calling router.
+const selectRouteTool = "select_route"
+
+// Route is a named runner that a Router can choose, the description tells the classifier
+// which requests the route handles.
+type Route struct {
+	Name        string
+	Description string
+	Runner      blades.Runner
+}
+
+// RouterOption configures a Router.
+type RouterOption func(*Router)
+
+// WithDefaultRoute sets the route used when the classifier fails or chooses an unknown route.
+func WithDefaultRoute(name string) RouterOption {
+	return func(r *Router) {
+		r.fallback = name
+	}
+}
+
+// WithRouterInstructions replaces the instructions that ask the classifier to choose a route.
+func WithRouterInstructions(instructions string) RouterOption {
+	return func(r *Router) {
+		r.instructions = instructions
+	}
+}
+
+// Router chooses one of several routes for each prompt and runs it.
+type Router struct {
+	routes       []*Route
+	fallback     string
+	instructions string
+	classify     func(ctx context.Context, prompt *blades.Prompt) (string, *blades.Usage, error)
+}
+
+// NewRouter creates a Router that asks the classifier runner for the name of the best route.
+// The classifier receives the route names and descriptions together with the user prompt.
+func NewRouter(classifier blades.Runner, routes []*Route, opts ...RouterOption) *Router {
+	r := newRouter(routes, opts...)
+	r.classify = func(ctx context.Context, prompt *blades.Prompt) (string, *blades.Usage, error) {
+		res, err := classifier.Run(ctx, blades.NewPrompt(
+			blades.SystemMessage(r.instructions),
+			blades.UserMessage(r.describe(prompt)),
+		))
+		if err != nil {
+			return "", nil, err
+		}
+		return res.Text(), res.Usage, nil
+	}
+	return r
+}
+
+// NewToolRouter creates a Router that lets the model choose a route through a native tool call,
+// the tool arguments are restricted to the route names.
+func NewToolRouter(provider blades.ModelProvider, model string, routes []*Route, opts ...RouterOption) *Router {
+	r := newRouter(routes, opts...)
+	names := make([]any, 0, len(routes))
+	for _, route := range routes {
+		names = append(names, route.Name)
+	}
+	tool := &blades.Tool{
+		Name:        selectRouteTool,
+		Description: "Select the route that should handle the user's request.",
+		InputSchema: &jsonschema.Schema{
+			Type: "object",
+			Properties: map[string]*jsonschema.Schema{
+				"route": {Type: "string", Enum: names},
+			},
+			Required: []string{"route"},
+		},
+	}
+	r.classify = func(ctx context.Context, prompt *blades.Prompt) (string, *blades.Usage, error) {
+		res, err := provider.Generate(ctx, &blades.ModelRequest{
+			Model: model,
+			Tools: []*blades.Tool{tool},
+			Messages: []*blades.Message{
+				blades.SystemMessage(r.instructions + "\nCall the " + selectRouteTool + " tool with your choice."),
+				blades.UserMessage(r.describe(prompt)),
+			},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		var text string
+		for _, msg := range res.Messages {
+			for _, call := range msg.ToolCalls {
+				if call.Name != selectRouteTool {
+					continue
+				}
+				var args struct {
+					Route string `json:"route"`
+				}
+				if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+					return "", nil, fmt.Errorf("flow: invalid %s arguments: %w", selectRouteTool, err)
+				}
+				return args.Route, res.Usage, nil
+			}
+			if text == "" {
+				text = msg.Text()
+			}
+		}
+		// Fall back to the text answer for models that reply without calling the tool.
+		return text, res.Usage, nil
+	}
+	return r
+}
+
+func newRouter(routes []*Route, opts ...RouterOption) *Router {
+	r := &Router{
+		routes:       routes,
+		instructions: "You are a routing agent. Choose the single best route for handling the user's request and answer with the route name only.",
+	}
+	for _, apply := range opts {
+		apply(r)
+	}
+	return r
+}
+
+// describe renders the available routes and the user prompt for the classifier.
+func (r *Router) describe(prompt *blades.Prompt) string {
+	var buf strings.Builder
+	buf.WriteString("Available routes:\n")
+	for _, route := range r.routes {
+		buf.WriteString("- " + route.Name + ": " + route.Description + "\n")
+	}
+	buf.WriteString("\nUser request:\n")
+	for _, msg := range prompt.Messages {
+		if text := msg.Text(); text != "" {
+			buf.WriteString(text + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// Run chooses a route for the prompt and runs it. The returned generation carries the
+// name of the chosen route in its metadata, and the usage of the classifier and the route.
+func (r *Router) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	route, fallback, usage, err := r.route(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	gen, err := route.Runner.Run(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return withUsage(withRoute(gen, route, fallback), blades.SumUsage(usage, gen.Usage)), nil
+}
+
+// RunStream chooses a route for the prompt and streams it. Every streamed generation carries
+// the name of the chosen route in its metadata, and the last one the usage of the classifier
+// and the route.
+func (r *Router) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	route, fallback, usage, err := r.route(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := route.Runner.RunStream(ctx, prompt, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.Generation]()
+	pipe.Go(func() error {
+		last, err := forwardStep(pipe, stream, routeMetadata(route, fallback))
+		if err != nil {
+			return err
+		}
+		pipe.Send(withUsage(withRoute(last, route, fallback), blades.SumUsage(usage, last.Usage)))
+		return nil
+	})
+	return pipe, nil
+}
+
+// RunEvents chooses a route for the prompt and reports the route as a single step identified
+// by RouteKey, with the events of the route runner in between.
+func (r *Router) RunEvents(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.RunEvent], error) {
+	route, fallback, usage, err := r.route(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	pipe := blades.NewStreamPipe[*blades.RunEvent]()
+	pipe.Go(func() error {
+		step := routeMetadata(route, fallback)
+		gen, err := runStep(ctx, pipe, route.Runner, prompt, step, opts...)
+		if err != nil {
+			return err
+		}
+		gen = withRoute(gen, route, fallback)
+		pipe.Send(stepEnd(gen, step))
+		pipe.Send(completed(withUsage(gen, blades.SumUsage(usage, gen.Usage))))
+		return nil
+	})
+	return pipe, nil
+}
+
+// Route asks the classifier for a route and validates the choice. It reports whether the
+// default route was used instead of the classifier's choice.
+func (r *Router) Route(ctx context.Context, prompt *blades.Prompt) (*Route, bool, error) {
+	route, fallback, _, err := r.route(ctx, prompt)
+	return route, fallback, err
+}
+
+// route chooses a route like Route and also returns the usage of the classifier. A cancelled
+// or expired context is returned as is rather than sent to the default route.
+func (r *Router) route(ctx context.Context, prompt *blades.Prompt) (*Route, bool, *blades.Usage, error) {
+	choice, usage, err := r.classify(ctx, prompt)
+	if err == nil {
+		if route, ok := r.match(choice); ok {
+			return route, false, usage, nil
+		}
+		err = fmt.Errorf("%w: %q", ErrInvalidRoute, strings.TrimSpace(choice))
+	}
+	if ctx.Err() != nil {
+		return nil, false, usage, ctx.Err()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, false, usage, err
+	}
+	if r.fallback != "" {
+		if route, ok := r.find(r.fallback); ok {
+			return route, true, usage, nil
+		}
+	}
+	return nil, false, usage, err
+}
+
+// match resolves the classifier answer to a route. It accepts the route name with surrounding
+// quotes or punctuation, a JSON object with a "route" field, or text mentioning routes. In text
+// the longest mentioned route wins, unless another mentioned route is not part of its name, in
+// which case the answer is ambiguous.
+func (r *Router) match(choice string) (*Route, bool) {
+	choice = strings.TrimSpace(choice)
+	var obj struct {
+		Route string `json:"route"`
+	}
+	if json.Unmarshal([]byte(choice), &obj) == nil && obj.Route != "" {
+		choice = obj.Route
+	}
+	if route, ok := r.find(strings.Trim(choice, " \t\n\"'`.*")); ok {
+		return route, true
+	}
+	var (
+		found   *Route
+		matched []string
+	)
+	lower := strings.ToLower(choice)
+	for _, route := range r.routes {
+		name := strings.ToLower(route.Name)
+		if name == "" || !strings.Contains(lower, name) {
+			continue
+		}
+		matched = append(matched, name)
+		if found == nil || len(name) > len(found.Name) {
+			found = route
+		}
+	}
+	if found == nil {
+		return nil, false
+	}
+	longest := strings.ToLower(found.Name)
+	for _, name := range matched {
+		if !strings.Contains(longest, name) {
+			return nil, false
+		}
+	}
+	return found, true
+}
+
+// find looks up a route by name, ignoring case.
+func (r *Router) find(name string) (*Route, bool) {
+	for _, route := range r.routes {
+		if strings.EqualFold(route.Name, name) {
+			return route, true
+		}
+	}
+	return nil, false
+}
+
+// withRoute returns a copy of the generation with the route recorded in its metadata.
+func withRoute(gen *blades.Generation, route *Route, fallback bool) *blades.Generation {
+	return withMetadata(gen, routeMetadata(route, fallback))
+}
+
+// routeMetadata returns the metadata identifying the chosen route.
+func routeMetadata(route *Route, fallback bool) map[string]string {
+	metadata := map[string]string{RouteKey: route.Name}
+	if fallback {
+		metadata[RouteFallbackKey] = "true"
+	}
+	return metadata
+}
@@ -0,0 +1,159 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// routeProvider answers every request with a select_route tool call.
+type routeProvider struct {
+	arguments string
+	request   *blades.ModelRequest
+}
+
+func (p *routeProvider) Generate(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (*blades.ModelResponse, error) {
+	p.request = req
+	return &blades.ModelResponse{Messages: []*blades.Message{{
+		Role:      blades.RoleAssistant,
+		ToolCalls: []*blades.ToolCall{{ID: "call_1", Name: selectRouteTool, Arguments: p.arguments}},
+	}}}, nil
+}
+
+func (p *routeProvider) NewStream(ctx context.Context, req *blades.ModelRequest, opts ...blades.ModelOption) (blades.Streamer[*blades.ModelResponse], error) {
+	return nil, errors.New("not implemented")
+}
+
+func testRoutes() []*Route {
+	return []*Route{
+		{Name: "math_agent", Description: "Math problems", Runner: &stubRunner{text: "42"}},
+		{Name: "history_agent", Description: "Historical questions", Runner: &stubRunner{text: "Paris"}},
+	}
+}
+
+func TestRouter(t *testing.T) {
+	tests := []struct {
+		name         string
+		choice       string
+		err          error
+		opts         []RouterOption
+		want         string
+		wantRoute    string
+		wantErr      error
+		wantFallback bool
+	}{
+		{name: "exact", choice: "history_agent", want: "Paris", wantRoute: "history_agent"},
+		{name: "quoted", choice: " `Math_Agent`.\n", want: "42", wantRoute: "math_agent"},
+		{name: "json", choice: `{"route": "history_agent"}`, want: "Paris", wantRoute: "history_agent"},
+		{name: "sentence", choice: "The best route is history_agent.", want: "Paris", wantRoute: "history_agent"},
+		{name: "unknown", choice: "science_agent", wantErr: ErrInvalidRoute},
+		{name: "unknown with default", choice: "science_agent", opts: []RouterOption{WithDefaultRoute("math_agent")}, want: "42", wantRoute: "math_agent", wantFallback: true},
+		{name: "classifier error with default", err: errors.New("boom"), opts: []RouterOption{WithDefaultRoute("history_agent")}, want: "Paris", wantRoute: "history_agent", wantFallback: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewRouter(&stubRunner{text: tt.choice, err: tt.err}, testRoutes(), tt.opts...)
+			gen, err := router.Run(context.Background(), blades.NewPrompt(blades.UserMessage("What is the capital of France?")))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if gen.Text() != tt.want || gen.Metadata[RouteKey] != tt.wantRoute {
+				t.Errorf("Run() = %q (route %q), want %q (route %q)", gen.Text(), gen.Metadata[RouteKey], tt.want, tt.wantRoute)
+			}
+			if (gen.Metadata[RouteFallbackKey] == "true") != tt.wantFallback {
+				t.Errorf("Run() fallback = %q, want %v", gen.Metadata[RouteFallbackKey], tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestRouterCancelled(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		err     error
+		wantErr error
+	}{
+		{name: "cancelled context", cancel: true, wantErr: context.Canceled},
+		{name: "classifier deadline", err: context.DeadlineExceeded, wantErr: context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			fallback := &draftRunner{}
+			router := NewRouter(&stubRunner{text: "unknown", err: tt.err}, []*Route{{Name: "default", Runner: fallback}}, WithDefaultRoute("default"))
+			if _, err := router.Run(ctx, blades.NewPrompt(blades.UserMessage("Hi"))); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(fallback.prompts) != 0 {
+				t.Errorf("the default route was run")
+			}
+		})
+	}
+}
+
+func TestRouterOverlappingNames(t *testing.T) {
+	routes := []*Route{
+		{Name: "billing", Runner: &stubRunner{text: "billing"}},
+		{Name: "refund", Runner: &stubRunner{text: "refund"}},
+		{Name: "refund_billing", Runner: &stubRunner{text: "refund_billing"}},
+	}
+	tests := []struct {
+		choice       string
+		want         string
+		wantFallback bool
+	}{
+		{choice: "Refund_Billing", want: "refund_billing"},
+		{choice: "Route: refund_billing", want: "refund_billing"},
+		{choice: "This is about billing.", want: "billing"},
+		{choice: "Either billing or refund.", want: "refund", wantFallback: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.choice, func(t *testing.T) {
+			router := NewRouter(&stubRunner{text: tt.choice}, routes, WithDefaultRoute("refund"))
+			gen, err := router.Run(context.Background(), blades.NewPrompt(blades.UserMessage("I was charged twice")))
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if gen.Metadata[RouteKey] != tt.want || (gen.Metadata[RouteFallbackKey] == "true") != tt.wantFallback {
+				t.Errorf("Run() route = %q (fallback %q), want %q (fallback %v)", gen.Metadata[RouteKey], gen.Metadata[RouteFallbackKey], tt.want, tt.wantFallback)
+			}
+		})
+	}
+}
+
+func TestToolRouter(t *testing.T) {
+	provider := &routeProvider{arguments: `{"route":"math_agent"}`}
+	router := NewToolRouter(provider, "gpt-5", testRoutes())
+	stream, err := router.RunStream(context.Background(), blades.NewPrompt(blades.UserMessage("What is 6 times 7?")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	defer stream.Close()
+	var last *blades.Generation
+	for stream.Next() {
+		if last, err = stream.Current(); err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+	}
+	if last == nil || last.Text() != "42" || last.Metadata[RouteKey] != "math_agent" {
+		t.Fatalf("RunStream() last = %+v", last)
+	}
+	tools := provider.request.Tools
+	if len(tools) != 1 || len(tools[0].InputSchema.Properties["route"].Enum) != 2 {
+		t.Errorf("request tools = %+v", tools)
+	}
+	if text := provider.request.Messages[1].Text(); !strings.Contains(text, "- history_agent: Historical questions") {
+		t.Errorf("classifier prompt = %q", text)
+	}
+}
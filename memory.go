@@ -8,3 +8,23 @@ type Memory interface {
 	ListMessages(context.Context, string) ([]*Message, error)
 	Clear(context.Context, string) error
 }
+
+// MemoryReplacer is implemented by memories that replace the messages of a conversation in
+// a single step, so that the conversation is never lost or left partially written.
+type MemoryReplacer interface {
+	ReplaceMessages(context.Context, string, []*Message) error
+}
+
+// ConversationKeeper is implemented by runners that store the messages of every run in memory,
+// so that a follow-up prompt of the same conversation only needs the new messages.
+type ConversationKeeper interface {
+	KeepsConversation() bool
+}
+
+// KeepsConversation reports whether the runner stores the messages of every run and loads them
+// back for the next prompt of the same conversation. Runners that do not implement
+// ConversationKeeper are assumed to see only the messages of the prompt.
+func KeepsConversation(v any) bool {
+	k, ok := v.(ConversationKeeper)
+	return ok && k.KeepsConversation()
+}
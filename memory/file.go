@@ -0,0 +1,300 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+// SyncMode controls when FileMemory flushes writes to stable storage.
+type SyncMode int
+
+const (
+	// SyncAlways fsyncs the conversation file after every AddMessages call.
+	SyncAlways SyncMode = iota
+	// SyncNever leaves flushing to the operating system, trading durability for throughput.
+	SyncNever
+)
+
+// FileOption configures a FileMemory.
+type FileOption func(*FileMemory)
+
+// WithMaxMessages retains only the last n messages of each conversation, n <= 0 means unlimited.
+func WithMaxMessages(n int) FileOption {
+	return func(m *FileMemory) {
+		m.maxMessages = n
+	}
+}
+
+// WithSyncMode sets when writes are flushed to stable storage, the default is SyncAlways.
+func WithSyncMode(mode SyncMode) FileOption {
+	return func(m *FileMemory) {
+		m.syncMode = mode
+	}
+}
+
+// FileMemory is a durable memory implementation that stores each conversation
+// as an append-only JSON Lines file in a directory. It is safe for concurrent
+// use by multiple goroutines, but not by multiple processes sharing a directory.
+type FileMemory struct {
+	dir         string
+	maxMessages int
+	syncMode    SyncMode
+	mu          sync.Mutex
+	convs       map[string]*fileConversation
+}
+
+// fileConversation guards a single conversation file.
+type fileConversation struct {
+	mu sync.RWMutex
+	// records is the number of records in the file, or -1 before the file is first loaded.
+	records int
+}
+
+// NewFileMemory creates a file-backed memory storing conversations in dir, which is created if needed.
+func NewFileMemory(dir string, opts ...FileOption) (*FileMemory, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &FileMemory{
+		dir:   dir,
+		convs: make(map[string]*fileConversation),
+	}
+	for _, apply := range opts {
+		apply(m)
+	}
+	return m, nil
+}
+
+// AddMessages appends messages to the conversation file. When a retention limit is set,
+// the file is compacted once it holds twice as many records as are retained.
+func (m *FileMemory) AddMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	conv := m.conversation(id)
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	path := m.path(id)
+	if conv.records < 0 {
+		// Load the file once to count its records and drop a torn write left by a crash.
+		msgs, size, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		if err := os.Truncate(path, size); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		conv.records = len(msgs)
+	}
+	created := conv.records == 0
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if m.syncMode == SyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if created && m.syncMode == SyncAlways {
+		if err := syncDir(m.dir); err != nil {
+			return err
+		}
+	}
+	conv.records += len(msgs)
+	if m.maxMessages > 0 && conv.records >= 2*m.maxMessages {
+		return m.compact(conv, path)
+	}
+	return nil
+}
+
+// ListMessages returns the stored messages for the conversation.
+func (m *FileMemory) ListMessages(ctx context.Context, id string) ([]*blades.Message, error) {
+	conv := m.conversation(id)
+	conv.mu.RLock()
+	defer conv.mu.RUnlock()
+	msgs, _, err := readFile(m.path(id))
+	if err != nil {
+		return nil, err
+	}
+	if m.maxMessages > 0 && len(msgs) > m.maxMessages {
+		msgs = msgs[len(msgs)-m.maxMessages:]
+	}
+	return msgs, nil
+}
+
+// Clear removes the conversation file.
+func (m *FileMemory) Clear(ctx context.Context, id string) error {
+	conv := m.conversation(id)
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if err := os.Remove(m.path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	conv.records = 0
+	return nil
+}
+
+// ReplaceMessages replaces the conversation file with one holding the messages.
+// The new file replaces the old one atomically.
+func (m *FileMemory) ReplaceMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	conv := m.conversation(id)
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	if err := m.writeFile(m.path(id), msgs); err != nil {
+		return err
+	}
+	conv.records = len(msgs)
+	return nil
+}
+
+// Compact rewrites the conversation file so that it only holds the retained messages.
+// The new file replaces the old one atomically.
+func (m *FileMemory) Compact(ctx context.Context, id string) error {
+	conv := m.conversation(id)
+	conv.mu.Lock()
+	defer conv.mu.Unlock()
+	return m.compact(conv, m.path(id))
+}
+
+func (m *FileMemory) compact(conv *fileConversation, path string) error {
+	msgs, _, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 {
+		conv.records = 0
+		return nil
+	}
+	if m.maxMessages > 0 && len(msgs) > m.maxMessages {
+		msgs = msgs[len(msgs)-m.maxMessages:]
+	}
+	if err := m.writeFile(path, msgs); err != nil {
+		return err
+	}
+	conv.records = len(msgs)
+	return nil
+}
+
+// writeFile writes the messages to a temporary file that atomically replaces the conversation file.
+func (m *FileMemory) writeFile(path string, msgs []*blades.Message) error {
+	f, err := os.CreateTemp(m.dir, ".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	for _, msg := range msgs {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(m.dir)
+}
+
+// conversation returns the lock state for the conversation, creating it on first use.
+func (m *FileMemory) conversation(id string) *fileConversation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	conv, ok := m.convs[id]
+	if !ok {
+		conv = &fileConversation{records: -1}
+		m.convs[id] = conv
+	}
+	return conv
+}
+
+// path returns the file of the conversation, the ID is escaped so that it cannot
+// name a file outside of the directory.
+func (m *FileMemory) path(id string) string {
+	return filepath.Join(m.dir, url.PathEscape(id)+".jsonl")
+}
+
+// readFile decodes all records of a conversation file and returns the size of the valid prefix.
+// A final line without a newline is the remainder of an interrupted write and is ignored.
+func readFile(path string) ([]*blades.Message, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+	var (
+		msgs []*blades.Message
+		size int64
+		r    = bufio.NewReader(f)
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return msgs, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		msg := &blades.Message{}
+		if err := json.Unmarshal(line, msg); err != nil {
+			return nil, 0, fmt.Errorf("memory: corrupt record in %s at offset %d: %w", path, size, err)
+		}
+		msgs = append(msgs, msg)
+		size += int64(len(line))
+	}
+}
+
+// syncDir fsyncs a directory so that created and renamed files survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+func TestFileMemory_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	mem, err := NewFileMemory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := []*blades.Message{
+		{
+			ID:   "m1",
+			Role: blades.RoleUser,
+			Parts: []blades.Part{
+				blades.TextPart{Text: "What is in these?"},
+				blades.FilePart{Name: "cat.png", URI: "https://example.com/cat.png", MimeType: blades.MimeImagePNG},
+				blades.DataPart{Name: "dog.png", Bytes: []byte{0x89, 0x50}, MimeType: blades.MimeImagePNG},
+			},
+		},
+		{
+			ID:        "m2",
+			Role:      blades.RoleAssistant,
+			Status:    blades.StatusCompleted,
+			ToolCalls: []*blades.ToolCall{{ID: "call_1", Name: "lookup", Arguments: `{"q":"cat"}`}},
+			Metadata:  map[string]string{"finish_reason": "tool_calls"},
+		},
+	}
+	if err := mem.AddMessages(ctx, "conv/1", msgs); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	// A new instance must read back what the previous one wrote.
+	reopened, err := NewFileMemory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := reopened.ListMessages(ctx, "conv/1")
+	if err != nil {
+		t.Fatalf("ListMessages() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("ListMessages() returned %d messages, want 2", len(got))
+	}
+	if got[0].Text() != "What is in these?" || got[0].File().URI != "https://example.com/cat.png" || !bytes.Equal(got[0].Data().Bytes, []byte{0x89, 0x50}) {
+		t.Errorf("user message = %+v", got[0])
+	}
+	if got[1].Status != blades.StatusCompleted || got[1].ToolCalls[0].Arguments != `{"q":"cat"}` || got[1].Metadata["finish_reason"] != "tool_calls" {
+		t.Errorf("assistant message = %+v", got[1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conv%2F1.jsonl")); err != nil {
+		t.Errorf("conversation file: %v", err)
+	}
+	if err := reopened.Clear(ctx, "conv/1"); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if got, _ := reopened.ListMessages(ctx, "conv/1"); len(got) != 0 {
+		t.Errorf("ListMessages() after Clear() = %d messages, want 0", len(got))
+	}
+}
+
+func TestFileMemory_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	mem, err := NewFileMemory(dir, WithMaxMessages(3), WithSyncMode(SyncNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if err := mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage(fmt.Sprint(i))}); err != nil {
+			t.Fatalf("AddMessages() error = %v", err)
+		}
+	}
+	msgs, _ := mem.ListMessages(ctx, "A")
+	if len(msgs) != 3 || msgs[0].Text() != "3" || msgs[2].Text() != "5" {
+		t.Fatalf("ListMessages() = %v, want 3..5", msgs)
+	}
+	if n := countLines(t, filepath.Join(dir, "A.jsonl")); n != 5 {
+		t.Errorf("file holds %d records before compaction, want 5", n)
+	}
+	// The sixth record reaches twice the limit and triggers compaction.
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("6")})
+	if n := countLines(t, filepath.Join(dir, "A.jsonl")); n != 3 {
+		t.Errorf("file holds %d records after compaction, want 3", n)
+	}
+	msgs, _ = mem.ListMessages(ctx, "A")
+	if len(msgs) != 3 || msgs[0].Text() != "4" || msgs[2].Text() != "6" {
+		t.Errorf("ListMessages() after compaction = %v, want 4..6", msgs)
+	}
+}
+
+func TestFileMemory_Replace(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	mem, err := NewFileMemory(dir, WithSyncMode(SyncNever))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1"), blades.UserMessage("2")})
+	if err := mem.ReplaceMessages(ctx, "A", []*blades.Message{blades.SystemMessage("summary")}); err != nil {
+		t.Fatalf("ReplaceMessages() error = %v", err)
+	}
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("3")})
+	msgs, _ := mem.ListMessages(ctx, "A")
+	if len(msgs) != 2 || msgs[0].Text() != "summary" || msgs[1].Text() != "3" {
+		t.Errorf("ListMessages() = %v, want [summary 3]", msgs)
+	}
+	if n := countLines(t, filepath.Join(dir, "A.jsonl")); n != 2 {
+		t.Errorf("file holds %d records, want 2", n)
+	}
+}
+
+func TestFileMemory_TornWrite(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	mem, _ := NewFileMemory(dir)
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1")})
+	// Simulate a crash in the middle of a write.
+	f, err := os.OpenFile(filepath.Join(dir, "A.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"id":"m2","role":"us`)
+	f.Close()
+
+	reopened, _ := NewFileMemory(dir)
+	msgs, err := reopened.ListMessages(ctx, "A")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ListMessages() = %d messages, %v, want 1 message", len(msgs), err)
+	}
+	if err := reopened.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("2")}); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	msgs, err = reopened.ListMessages(ctx, "A")
+	if err != nil || len(msgs) != 2 || msgs[1].Text() != "2" {
+		t.Fatalf("ListMessages() after repair = %v, %v, want 2 messages", msgs, err)
+	}
+}
+
+func TestFileMemory_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	mem, _ := NewFileMemory(t.TempDir(), WithSyncMode(SyncNever))
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_ = mem.AddMessages(ctx, fmt.Sprint("conv", i%2), []*blades.Message{blades.UserMessage(fmt.Sprint(i, j))})
+				_, _ = mem.ListMessages(ctx, fmt.Sprint("conv", i%2))
+			}
+		}(i)
+	}
+	wg.Wait()
+	for _, id := range []string{"conv0", "conv1"} {
+		if msgs, err := mem.ListMessages(ctx, id); err != nil || len(msgs) != 100 {
+			t.Errorf("ListMessages(%s) = %d messages, %v, want 100", id, len(msgs), err)
+		}
+	}
+}
+
+func countLines(t *testing.T, path string) int {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(b, []byte("\n"))
+}
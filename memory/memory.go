@@ -39,6 +39,17 @@ func (m *InMemory) AddMessages(ctx context.Context, id string, msgs []*blades.Me
 	return nil
 }
 
+// ReplaceMessages replaces the messages of the conversation and applies the per-conversation limit.
+func (m *InMemory) ReplaceMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.maxMessages > 0 && len(msgs) > m.maxMessages {
+		msgs = msgs[len(msgs)-m.maxMessages:]
+	}
+	m.store[id] = append([]*blades.Message(nil), msgs...)
+	return nil
+}
+
 // ListMessages returns a shallow copy of the stored messages for the conversation.
 func (m *InMemory) ListMessages(ctx context.Context, id string) ([]*blades.Message, error) {
 	m.mu.RLock()
@@ -2,9 +2,11 @@ package memory
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/go-kratos/blades"
+	"github.com/go-kratos/blades/bladestest"
 )
 
 func TestInMemory_PerConversationLimit(t *testing.T) {
@@ -50,3 +52,37 @@ func TestInMemory_Unlimited(t *testing.T) {
 		t.Fatalf("expected 4, got %d", len(msgs))
 	}
 }
+
+func TestInMemory_OutputRepair(t *testing.T) {
+	type city struct {
+		Name    string `json:"name"`
+		Country string `json:"country"`
+	}
+	ctx := context.Background()
+	provider := bladestest.NewProvider(t,
+		bladestest.Text(`{"name":"Paris"}`),
+		bladestest.Text(`{"name":"Paris","country":"France"}`),
+	)
+	mem := NewInMemory(0)
+	agent := blades.NewAgent("extractor", blades.WithProvider(provider), blades.WithMemory(mem))
+	got, err := blades.NewOutputConverter[city](agent).Run(ctx, blades.NewConversation("A", blades.UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got.Country != "France" {
+		t.Errorf("Run() = %+v", got)
+	}
+	// The repair is sent alone, the rejected answer is loaded from memory.
+	requests := provider.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("provider received %d requests, want 2", len(requests))
+	}
+	repair := requests[1].Messages
+	if len(repair) != 4 || repair[1].Text() != "The capital of France." || repair[2].Text() != `{"name":"Paris"}` || !strings.Contains(repair[3].Text(), "country") {
+		t.Errorf("repair request = %d messages, want the history once and the repair", len(repair))
+	}
+	msgs, _ := mem.ListMessages(ctx, "A")
+	if len(msgs) != 5 || msgs[1].Text() != "The capital of France." || msgs[2].Text() != `{"name":"Paris"}` || msgs[4].Text() != `{"name":"Paris","country":"France"}` {
+		t.Errorf("ListMessages() = %d messages, want every message stored once", len(msgs))
+	}
+}
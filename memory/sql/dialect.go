@@ -0,0 +1,69 @@
+package sql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect describes the SQL syntax differences between database engines.
+type Dialect struct {
+	name      string
+	serial    string
+	text      string
+	timestamp string
+	// upsert is the conflict clause used to refresh updated_at of an existing conversation.
+	upsert      string
+	placeholder func(n int) string
+}
+
+var (
+	// Postgres is the dialect for PostgreSQL, for use with drivers such as pgx or lib/pq.
+	Postgres = Dialect{
+		name:        "postgres",
+		serial:      "BIGSERIAL PRIMARY KEY",
+		text:        "TEXT",
+		timestamp:   "TIMESTAMPTZ",
+		upsert:      "ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at",
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+	}
+	// MySQL is the dialect for MySQL and MariaDB, for use with go-sql-driver/mysql.
+	MySQL = Dialect{
+		name:        "mysql",
+		serial:      "BIGINT AUTO_INCREMENT PRIMARY KEY",
+		text:        "LONGTEXT",
+		timestamp:   "DATETIME(6)",
+		upsert:      "ON DUPLICATE KEY UPDATE updated_at = VALUES(updated_at)",
+		placeholder: func(int) string { return "?" },
+	}
+	// SQLite is the dialect for SQLite, for use with drivers such as modernc.org/sqlite or mattn/go-sqlite3.
+	SQLite = Dialect{
+		name:        "sqlite",
+		serial:      "INTEGER PRIMARY KEY AUTOINCREMENT",
+		text:        "TEXT",
+		timestamp:   "TIMESTAMP",
+		upsert:      "ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at",
+		placeholder: func(int) string { return "?" },
+	}
+)
+
+// String returns the name of the dialect.
+func (d Dialect) String() string {
+	return d.name
+}
+
+// rebind replaces the "?" placeholders of a query with the dialect placeholders.
+func (d Dialect) rebind(query string) string {
+	var (
+		buf strings.Builder
+		n   int
+	)
+	for _, r := range query {
+		if r != '?' {
+			buf.WriteRune(r)
+			continue
+		}
+		n++
+		buf.WriteString(d.placeholder(n))
+	}
+	return buf.String()
+}
@@ -0,0 +1,252 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	// ErrInvalidPageToken indicates a page token that was not returned by ListMessagesPage.
+	ErrInvalidPageToken = errors.New("sql: invalid page token")
+)
+
+// Option configures a Memory.
+type Option func(*Memory)
+
+// WithTablePrefix sets the prefix of the table names, the default is "blades_".
+func WithTablePrefix(prefix string) Option {
+	return func(m *Memory) {
+		m.prefix = prefix
+	}
+}
+
+// WithMaxMessages makes ListMessages return only the last n messages of a conversation, n <= 0 means unlimited.
+func WithMaxMessages(n int) Option {
+	return func(m *Memory) {
+		m.maxMessages = n
+	}
+}
+
+// WithSoftDelete makes Clear mark messages as deleted instead of removing the rows,
+// so that the history stays available for auditing.
+func WithSoftDelete() Option {
+	return func(m *Memory) {
+		m.softDelete = true
+	}
+}
+
+// WithoutMigrations skips schema migrations in NewMemory, for deployments that
+// manage the schema separately or call Migrate explicitly.
+func WithoutMigrations() Option {
+	return func(m *Memory) {
+		m.skipMigrations = true
+	}
+}
+
+// Memory is a blades.Memory implementation backed by database/sql. Messages are
+// stored one row each with their role, status and text in queryable columns and
+// the full message encoded as JSON.
+type Memory struct {
+	db             *sql.DB
+	dialect        Dialect
+	prefix         string
+	maxMessages    int
+	softDelete     bool
+	skipMigrations bool
+}
+
+// NewMemory creates a SQL-backed memory and migrates the schema to the latest version.
+func NewMemory(ctx context.Context, db *sql.DB, dialect Dialect, opts ...Option) (*Memory, error) {
+	m := &Memory{
+		db:      db,
+		dialect: dialect,
+		prefix:  "blades_",
+	}
+	for _, apply := range opts {
+		apply(m)
+	}
+	if !m.skipMigrations {
+		if err := m.Migrate(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// query expands the table prefix and placeholders of a query.
+func (m *Memory) query(query string) string {
+	return m.dialect.rebind(m.expand(query))
+}
+
+// AddMessages stores messages in a single transaction, creating the conversation on first use.
+func (m *Memory) AddMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := m.insert(ctx, tx, id, msgs, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplaceMessages replaces the messages of the conversation in a single transaction. The
+// previous messages are deleted, or marked as deleted with WithSoftDelete.
+func (m *Memory) ReplaceMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := time.Now().UTC()
+	if m.softDelete {
+		_, err = tx.ExecContext(ctx, m.query(`UPDATE {prefix}messages SET deleted_at = ?
+			WHERE conversation_id = ? AND deleted_at IS NULL`), now, id)
+	} else {
+		_, err = tx.ExecContext(ctx, m.query(`DELETE FROM {prefix}messages WHERE conversation_id = ?`), id)
+	}
+	if err != nil {
+		return err
+	}
+	if err := m.insert(ctx, tx, id, msgs, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insert stores messages in the transaction, creating the conversation on first use.
+func (m *Memory) insert(ctx context.Context, tx *sql.Tx, id string, msgs []*blades.Message, now time.Time) error {
+	upsert := m.query(`INSERT INTO {prefix}conversations (id, created_at, updated_at) VALUES (?, ?, ?) `) + m.dialect.upsert
+	if _, err := tx.ExecContext(ctx, upsert, id, now, now); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, m.query(`INSERT INTO {prefix}messages
+		(conversation_id, message_id, role, status, text, content, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, msg := range msgs {
+		content, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, id, msg.ID, string(msg.Role), string(msg.Status), msg.Text(), string(content), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListMessages returns the messages of the conversation in insertion order.
+func (m *Memory) ListMessages(ctx context.Context, id string) ([]*blades.Message, error) {
+	if m.maxMessages <= 0 {
+		return m.list(ctx, m.query(`SELECT seq, content FROM {prefix}messages
+			WHERE conversation_id = ? AND deleted_at IS NULL ORDER BY seq`), id)
+	}
+	msgs, err := m.list(ctx, m.query(`SELECT seq, content FROM {prefix}messages
+		WHERE conversation_id = ? AND deleted_at IS NULL ORDER BY seq DESC LIMIT ?`), id, m.maxMessages)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	return msgs, nil
+}
+
+// ListMessagesPage returns up to pageSize messages of the conversation in insertion order,
+// starting after pageToken. An empty pageToken starts at the first message and an empty
+// next token means there are no more messages.
+func (m *Memory) ListMessagesPage(ctx context.Context, id, pageToken string, pageSize int) ([]*blades.Message, string, error) {
+	var after int64
+	if pageToken != "" {
+		v, err := strconv.ParseInt(pageToken, 10, 64)
+		if err != nil || v < 0 {
+			return nil, "", ErrInvalidPageToken
+		}
+		after = v
+	}
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	rows, err := m.db.QueryContext(ctx, m.query(`SELECT seq, content FROM {prefix}messages
+		WHERE conversation_id = ? AND deleted_at IS NULL AND seq > ? ORDER BY seq LIMIT ?`), id, after, pageSize+1)
+	if err != nil {
+		return nil, "", err
+	}
+	msgs, seqs, err := scanMessages(rows)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(msgs) <= pageSize {
+		return msgs, "", nil
+	}
+	return msgs[:pageSize], strconv.FormatInt(seqs[pageSize-1], 10), nil
+}
+
+// Clear deletes the messages of the conversation, or marks them as deleted with WithSoftDelete.
+func (m *Memory) Clear(ctx context.Context, id string) error {
+	if m.softDelete {
+		_, err := m.db.ExecContext(ctx, m.query(`UPDATE {prefix}messages SET deleted_at = ?
+			WHERE conversation_id = ? AND deleted_at IS NULL`), time.Now().UTC(), id)
+		return err
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, m.query(`DELETE FROM {prefix}messages WHERE conversation_id = ?`), id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, m.query(`DELETE FROM {prefix}conversations WHERE id = ?`), id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Memory) list(ctx context.Context, query string, args ...any) ([]*blades.Message, error) {
+	rows, err := m.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	msgs, _, err := scanMessages(rows)
+	return msgs, err
+}
+
+// scanMessages decodes (seq, content) rows and closes them.
+func scanMessages(rows *sql.Rows) ([]*blades.Message, []int64, error) {
+	defer rows.Close()
+	var (
+		msgs []*blades.Message
+		seqs []int64
+	)
+	for rows.Next() {
+		var (
+			seq     int64
+			content string
+		)
+		if err := rows.Scan(&seq, &content); err != nil {
+			return nil, nil, err
+		}
+		msg := &blades.Message{}
+		if err := json.Unmarshal([]byte(content), msg); err != nil {
+			return nil, nil, err
+		}
+		msgs = append(msgs, msg)
+		seqs = append(seqs, seq)
+	}
+	return msgs, seqs, rows.Err()
+}
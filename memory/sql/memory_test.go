@@ -0,0 +1,171 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kratos/blades"
+	_ "modernc.org/sqlite"
+)
+
+func newTestMemory(t *testing.T, opts ...Option) (*Memory, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "memory.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mem, err := NewMemory(context.Background(), db, SQLite, opts...)
+	if err != nil {
+		t.Fatalf("NewMemory() error = %v", err)
+	}
+	return mem, db
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	mem, db := newTestMemory(t)
+	msgs := []*blades.Message{
+		blades.UserMessage("What is the weather in Paris?"),
+		{
+			ID:        "m2",
+			Role:      blades.RoleAssistant,
+			Status:    blades.StatusCompleted,
+			ToolCalls: []*blades.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Paris"}`}},
+		},
+		{
+			ID:    "m3",
+			Role:  blades.RoleUser,
+			Parts: []blades.Part{blades.DataPart{Name: "sky.png", Bytes: []byte{0x89}, MimeType: blades.MimeImagePNG}},
+		},
+	}
+	if err := mem.AddMessages(ctx, "A", msgs); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	if err := mem.AddMessages(ctx, "B", []*blades.Message{blades.UserMessage("other")}); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	got, err := mem.ListMessages(ctx, "A")
+	if err != nil {
+		t.Fatalf("ListMessages() error = %v", err)
+	}
+	if len(got) != 3 || got[0].Text() != "What is the weather in Paris?" || got[1].ToolCalls[0].Name != "get_weather" || got[2].Data() == nil {
+		t.Fatalf("ListMessages() = %v", got)
+	}
+	// Migrating an up-to-date schema is a no-op.
+	if err := mem.Migrate(ctx); err != nil {
+		t.Errorf("Migrate() error = %v", err)
+	}
+	var role string
+	if err := db.QueryRow(`SELECT role FROM blades_messages WHERE message_id = 'm2'`).Scan(&role); err != nil || role != "assistant" {
+		t.Errorf("role column = %q, %v", role, err)
+	}
+	if err := mem.Clear(ctx, "A"); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	if got, _ := mem.ListMessages(ctx, "A"); len(got) != 0 {
+		t.Errorf("ListMessages() after Clear() = %d messages, want 0", len(got))
+	}
+	if got, _ := mem.ListMessages(ctx, "B"); len(got) != 1 {
+		t.Errorf("ListMessages(B) = %d messages, want 1", len(got))
+	}
+	var rows int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM blades_messages WHERE conversation_id = 'A'`).Scan(&rows)
+	if rows != 0 {
+		t.Errorf("hard delete left %d rows", rows)
+	}
+}
+
+func TestMemory_SoftDelete(t *testing.T) {
+	ctx := context.Background()
+	mem, db := newTestMemory(t, WithSoftDelete(), WithTablePrefix("chat_"))
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1"), blades.UserMessage("2")})
+	if err := mem.Clear(ctx, "A"); err != nil {
+		t.Fatalf("Clear() error = %v", err)
+	}
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("3")})
+	got, _ := mem.ListMessages(ctx, "A")
+	if len(got) != 1 || got[0].Text() != "3" {
+		t.Errorf("ListMessages() after soft Clear() = %v, want [3]", got)
+	}
+	var deleted int
+	_ = db.QueryRow(`SELECT COUNT(*) FROM chat_messages WHERE deleted_at IS NOT NULL`).Scan(&deleted)
+	if deleted != 2 {
+		t.Errorf("soft deleted rows = %d, want 2", deleted)
+	}
+}
+
+func TestMemory_Replace(t *testing.T) {
+	ctx := context.Background()
+	for _, softDelete := range []bool{false, true} {
+		var opts []Option
+		if softDelete {
+			opts = append(opts, WithSoftDelete())
+		}
+		mem, db := newTestMemory(t, opts...)
+		_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1"), blades.UserMessage("2")})
+		if err := mem.ReplaceMessages(ctx, "A", []*blades.Message{blades.SystemMessage("summary"), blades.UserMessage("2")}); err != nil {
+			t.Fatalf("ReplaceMessages() error = %v", err)
+		}
+		got, _ := mem.ListMessages(ctx, "A")
+		if len(got) != 2 || got[0].Text() != "summary" || got[1].Text() != "2" {
+			t.Errorf("ListMessages() after ReplaceMessages() = %v, want [summary 2]", got)
+		}
+		var rows int
+		_ = db.QueryRow(`SELECT COUNT(*) FROM blades_messages`).Scan(&rows)
+		if want := map[bool]int{false: 2, true: 4}[softDelete]; rows != want {
+			t.Errorf("soft delete %v: %d rows, want %d", softDelete, rows, want)
+		}
+	}
+}
+
+func TestMemory_Pagination(t *testing.T) {
+	ctx := context.Background()
+	mem, _ := newTestMemory(t, WithMaxMessages(3))
+	for i := 1; i <= 5; i++ {
+		_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage(fmt.Sprint(i))})
+	}
+	got, _ := mem.ListMessages(ctx, "A")
+	if len(got) != 3 || got[0].Text() != "3" || got[2].Text() != "5" {
+		t.Errorf("ListMessages() = %v, want 3..5", got)
+	}
+	var (
+		texts []string
+		token string
+	)
+	for pages := 0; ; pages++ {
+		msgs, next, err := mem.ListMessagesPage(ctx, "A", token, 2)
+		if err != nil {
+			t.Fatalf("ListMessagesPage() error = %v", err)
+		}
+		if pages > 3 {
+			t.Fatalf("ListMessagesPage() did not terminate")
+		}
+		for _, msg := range msgs {
+			texts = append(texts, msg.Text())
+		}
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	if fmt.Sprint(texts) != "[1 2 3 4 5]" {
+		t.Errorf("paged messages = %v, want [1 2 3 4 5]", texts)
+	}
+	if _, _, err := mem.ListMessagesPage(ctx, "A", "bogus", 2); err != ErrInvalidPageToken {
+		t.Errorf("ListMessagesPage() error = %v, want ErrInvalidPageToken", err)
+	}
+}
+
+func TestDialectRebind(t *testing.T) {
+	query := "SELECT * FROM t WHERE a = ? AND b = ?"
+	if got := Postgres.rebind(query); got != "SELECT * FROM t WHERE a = $1 AND b = $2" {
+		t.Errorf("Postgres.rebind() = %q", got)
+	}
+	if got := MySQL.rebind(query); got != query {
+		t.Errorf("MySQL.rebind() = %q", got)
+	}
+}
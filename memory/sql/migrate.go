@@ -0,0 +1,82 @@
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// migrations are the schema versions in order, each one is a list of statements
+// with {prefix}, {serial}, {text} and {timestamp} expanded per dialect.
+var migrations = [][]string{
+	{
+		`CREATE TABLE {prefix}conversations (
+			id VARCHAR(255) NOT NULL PRIMARY KEY,
+			created_at {timestamp} NOT NULL,
+			updated_at {timestamp} NOT NULL
+		)`,
+		`CREATE TABLE {prefix}messages (
+			seq {serial},
+			conversation_id VARCHAR(255) NOT NULL,
+			message_id VARCHAR(255) NOT NULL,
+			role VARCHAR(32) NOT NULL,
+			status VARCHAR(32) NOT NULL,
+			text {text},
+			content {text} NOT NULL,
+			created_at {timestamp} NOT NULL,
+			deleted_at {timestamp} NULL
+		)`,
+		`CREATE INDEX {prefix}messages_conversation_idx ON {prefix}messages (conversation_id, seq)`,
+	},
+}
+
+// expand fills the placeholders of a schema statement.
+func (m *Memory) expand(stmt string) string {
+	return strings.NewReplacer(
+		"{prefix}", m.prefix,
+		"{serial}", m.dialect.serial,
+		"{text}", m.dialect.text,
+		"{timestamp}", m.dialect.timestamp,
+	).Replace(stmt)
+}
+
+// Migrate creates or upgrades the schema to the latest version. Each version is
+// applied in its own transaction and recorded in the schema_migrations table.
+// Concurrent migrations from several processes are not coordinated.
+func (m *Memory) Migrate(ctx context.Context) error {
+	if _, err := m.db.ExecContext(ctx, m.expand(`CREATE TABLE IF NOT EXISTS {prefix}schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		applied_at {timestamp} NOT NULL
+	)`)); err != nil {
+		return err
+	}
+	var current sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, m.expand(`SELECT MAX(version) FROM {prefix}schema_migrations`)).Scan(&current); err != nil {
+		return err
+	}
+	for i := int(current.Int64); i < len(migrations); i++ {
+		if err := m.migrate(ctx, i+1, migrations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) migrate(ctx context.Context, version int, stmts []string) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, m.expand(stmt)); err != nil {
+			return err
+		}
+	}
+	query := m.dialect.rebind(m.expand(`INSERT INTO {prefix}schema_migrations (version, applied_at) VALUES (?, ?)`))
+	if _, err := tx.ExecContext(ctx, query, version, time.Now().UTC()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,284 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-kratos/blades"
+)
+
+var (
+	// ErrEmptySummary indicates the summarizer returned no text.
+	ErrEmptySummary = errors.New("memory: empty summary")
+)
+
+// summaryKey marks the system message that holds the summary of the evicted history.
+const summaryKey = "summary"
+
+// summaryPrefix introduces the summary text in the stored system message.
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+// defaultSummaryInstructions asks the summarizer for a summary that can replace the history.
+const defaultSummaryInstructions = `Summarize the conversation below so that it can replace the original messages as context for continuing the conversation.
+Keep facts, decisions, user preferences, open questions and the results of tool calls. Be concise and do not add anything that was not said.`
+
+// SummaryOption configures a SummaryMemory.
+type SummaryOption func(*SummaryMemory)
+
+// SummarizeAfterMessages summarizes a conversation once it holds more than n messages.
+func SummarizeAfterMessages(n int) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.maxMessages = n
+	}
+}
+
+// SummarizeAfterTokens summarizes a conversation once its estimated size exceeds n tokens.
+// The recent tail that is kept verbatim is then limited to half of n.
+func SummarizeAfterTokens(n int) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.maxTokens = n
+	}
+}
+
+// KeepRecent sets the number of most recent messages that are kept verbatim.
+func KeepRecent(n int) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.keepRecent = n
+	}
+}
+
+// WithTokenizer sets the tokenizer used to measure the token budget, the default is blades.EstimateTokens.
+func WithTokenizer(tokenizer blades.Tokenizer) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.tokenizer = tokenizer
+	}
+}
+
+// WithSummaryInstructions sets the instructions sent to the summarizer.
+func WithSummaryInstructions(instructions string) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.instructions = instructions
+	}
+}
+
+// WithSummaryErrorHandler sets a function reporting the errors of summarizing a conversation,
+// which do not fail AddMessages once the messages are stored. Defaults to ignoring them.
+func WithSummaryErrorHandler(handler func(ctx context.Context, id string, err error)) SummaryOption {
+	return func(m *SummaryMemory) {
+		m.onError = handler
+	}
+}
+
+// SummaryMemory wraps a blades.Memory and compresses old history. Once a conversation
+// exceeds its message or token budget, the oldest messages are summarized by a runner
+// into a single system message and only the recent tail is kept verbatim. A tool result
+// is never separated from the assistant message that requested it.
+type SummaryMemory struct {
+	memory       blades.Memory
+	summarizer   blades.Runner
+	maxMessages  int
+	maxTokens    int
+	keepRecent   int
+	instructions string
+	tokenizer    blades.Tokenizer
+	onError      func(ctx context.Context, id string, err error)
+	mu           sync.Mutex
+	locks        map[string]*sync.Mutex
+}
+
+// NewSummaryMemory wraps memory so that history beyond the budget is summarized by
+// summarizer. By default a conversation is summarized after 50 messages and the last
+// 10 messages are kept verbatim.
+func NewSummaryMemory(memory blades.Memory, summarizer blades.Runner, opts ...SummaryOption) *SummaryMemory {
+	m := &SummaryMemory{
+		memory:       memory,
+		summarizer:   summarizer,
+		maxMessages:  50,
+		keepRecent:   10,
+		instructions: defaultSummaryInstructions,
+		tokenizer:    blades.TokenizerFunc(blades.EstimateTokens),
+		locks:        make(map[string]*sync.Mutex),
+	}
+	for _, apply := range opts {
+		apply(m)
+	}
+	return m
+}
+
+// AddMessages appends messages to the underlying memory and summarizes the conversation
+// when it exceeds the budget. The summary and the tail replace the stored conversation, in
+// a single step when the underlying memory implements blades.MemoryReplacer. Summarizing is
+// best-effort: once the messages are stored, its errors leave the history as it is and are
+// reported to the handler of WithSummaryErrorHandler instead of being returned.
+func (m *SummaryMemory) AddMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	lock := m.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := m.memory.AddMessages(ctx, id, msgs); err != nil {
+		return err
+	}
+	if err := m.compact(ctx, id); err != nil && m.onError != nil {
+		m.onError(ctx, id, err)
+	}
+	return nil
+}
+
+// compact summarizes the conversation when it exceeds the budget.
+func (m *SummaryMemory) compact(ctx context.Context, id string) error {
+	history, err := m.memory.ListMessages(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !m.exceeds(history) {
+		return nil
+	}
+	split := m.split(history)
+	if split == 0 || (split == 1 && isSummary(history[0])) {
+		return nil
+	}
+	summary, err := m.summarize(ctx, history[:split])
+	if err != nil {
+		return err
+	}
+	compacted := make([]*blades.Message, 0, len(history)-split+1)
+	compacted = append(compacted, summary)
+	compacted = append(compacted, history[split:]...)
+	return m.replace(ctx, id, history, compacted)
+}
+
+// replace stores the compacted conversation in place of the history, in a single step when the
+// memory is a blades.MemoryReplacer. Other memories are cleared before the compacted
+// conversation is added, and the history is restored when it cannot be added.
+func (m *SummaryMemory) replace(ctx context.Context, id string, history, compacted []*blades.Message) error {
+	if r, ok := m.memory.(blades.MemoryReplacer); ok {
+		return r.ReplaceMessages(ctx, id, compacted)
+	}
+	if err := m.memory.Clear(ctx, id); err != nil {
+		return err
+	}
+	err := m.memory.AddMessages(ctx, id, compacted)
+	if err == nil {
+		return nil
+	}
+	// The compacted conversation may have been partially added.
+	if clearErr := m.memory.Clear(ctx, id); clearErr != nil {
+		return errors.Join(err, clearErr)
+	}
+	if restoreErr := m.memory.AddMessages(ctx, id, history); restoreErr != nil {
+		return errors.Join(err, restoreErr)
+	}
+	return err
+}
+
+// ListMessages returns the summary, if any, followed by the recent messages.
+func (m *SummaryMemory) ListMessages(ctx context.Context, id string) ([]*blades.Message, error) {
+	return m.memory.ListMessages(ctx, id)
+}
+
+// Clear removes the conversation from the underlying memory.
+func (m *SummaryMemory) Clear(ctx context.Context, id string) error {
+	lock := m.lock(id)
+	lock.Lock()
+	defer lock.Unlock()
+	return m.memory.Clear(ctx, id)
+}
+
+// lock returns the lock serializing updates of the conversation.
+func (m *SummaryMemory) lock(id string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.locks[id]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.locks[id] = lock
+	}
+	return lock
+}
+
+// exceeds reports whether the history is over the message or token budget.
+func (m *SummaryMemory) exceeds(history []*blades.Message) bool {
+	if m.maxMessages > 0 && len(history) > m.maxMessages {
+		return true
+	}
+	return m.maxTokens > 0 && m.tokens(history) > m.maxTokens
+}
+
+func (m *SummaryMemory) tokens(msgs []*blades.Message) int {
+	var n int
+	for _, msg := range msgs {
+		n += m.tokenizer.CountTokens(msg)
+	}
+	return n
+}
+
+// split returns the index of the first message of the verbatim tail. The tail holds
+// at most keepRecent messages and half of the token budget, and never starts with
+// a tool result whose call would be summarized away.
+func (m *SummaryMemory) split(history []*blades.Message) int {
+	split := len(history) - m.keepRecent
+	if split < 0 {
+		split = 0
+	}
+	if m.maxTokens > 0 {
+		for split < len(history)-1 && m.tokens(history[split:]) > m.maxTokens/2 {
+			split++
+		}
+	}
+	for split > 0 && split < len(history) && history[split].Role == blades.RoleTool {
+		split--
+	}
+	return split
+}
+
+// summarize runs the summarizer over the evicted messages, including any earlier summary.
+func (m *SummaryMemory) summarize(ctx context.Context, msgs []*blades.Message) (*blades.Message, error) {
+	prompt := blades.NewPrompt(
+		blades.SystemMessage(m.instructions),
+		blades.UserMessage(transcript(msgs)),
+	)
+	res, err := m.summarizer.Run(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(res.Text())
+	if text == "" {
+		return nil, ErrEmptySummary
+	}
+	summary := blades.SystemMessage(summaryPrefix + text)
+	summary.Status = blades.StatusCompleted
+	summary.Metadata = map[string]string{summaryKey: "true"}
+	return summary, nil
+}
+
+// isSummary reports whether the message is a summary written by SummaryMemory.
+func isSummary(msg *blades.Message) bool {
+	return msg.Role == blades.RoleSystem && msg.Metadata[summaryKey] == "true"
+}
+
+// transcript renders messages as plain text for the summarizer.
+func transcript(msgs []*blades.Message) string {
+	var buf strings.Builder
+	for _, msg := range msgs {
+		switch msg.Role {
+		case blades.RoleTool:
+			for _, call := range msg.ToolCalls {
+				buf.WriteString("tool " + call.Name + " returned: " + call.Result + "\n")
+			}
+			continue
+		case blades.RoleSystem:
+			if isSummary(msg) {
+				buf.WriteString("earlier summary: " + strings.TrimPrefix(msg.Text(), summaryPrefix) + "\n")
+				continue
+			}
+		}
+		if text := msg.Text(); text != "" {
+			buf.WriteString(string(msg.Role) + ": " + text + "\n")
+		}
+		for _, call := range msg.ToolCalls {
+			buf.WriteString(string(msg.Role) + " called " + call.Name + "(" + call.Arguments + ")\n")
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-kratos/blades"
+)
+
+// summarizer is a blades.Runner that records its prompts and returns a fixed summary.
+type summarizer struct {
+	prompts []*blades.Prompt
+	err     error
+}
+
+func (s *summarizer) Run(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (*blades.Generation, error) {
+	s.prompts = append(s.prompts, prompt)
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &blades.Generation{Messages: []*blades.Message{blades.AssistantMessage("The user asked about the weather.")}}, nil
+}
+
+func (s *summarizer) RunStream(ctx context.Context, prompt *blades.Prompt, opts ...blades.ModelOption) (blades.Streamer[*blades.Generation], error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestSummaryMemory(t *testing.T) {
+	ctx := context.Background()
+	runner := &summarizer{}
+	mem := NewSummaryMemory(NewInMemory(0), runner, SummarizeAfterMessages(4), KeepRecent(2))
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{
+		blades.UserMessage("Hi"),
+		blades.AssistantMessage("Hello!"),
+		blades.UserMessage("What is the weather in Paris?"),
+	})
+	if len(runner.prompts) != 0 {
+		t.Fatalf("summarizer called %d times under budget, want 0", len(runner.prompts))
+	}
+	// The tail of two would start with the tool result, so the call is kept with it.
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{
+		{Role: blades.RoleAssistant, ToolCalls: []*blades.ToolCall{{ID: "call_1", Name: "get_weather", Arguments: `{"location":"Paris"}`}}},
+		{Role: blades.RoleTool, ToolCalls: []*blades.ToolCall{{ID: "call_1", Name: "get_weather", Result: "Sunny"}}},
+	})
+	if len(runner.prompts) != 1 {
+		t.Fatalf("summarizer called %d times, want 1", len(runner.prompts))
+	}
+	transcript := runner.prompts[0].Messages[1].Text()
+	if !strings.Contains(transcript, "user: What is the weather in Paris?") || strings.Contains(transcript, "get_weather") {
+		t.Errorf("transcript = %q", transcript)
+	}
+	msgs, _ := mem.ListMessages(ctx, "A")
+	if len(msgs) != 3 {
+		t.Fatalf("ListMessages() = %d messages, want 3", len(msgs))
+	}
+	if !isSummary(msgs[0]) || !strings.HasSuffix(msgs[0].Text(), "The user asked about the weather.") {
+		t.Errorf("summary = %+v", msgs[0])
+	}
+	if msgs[1].Role != blades.RoleAssistant || msgs[2].Role != blades.RoleTool {
+		t.Errorf("tail roles = %s, %s, want assistant, tool", msgs[1].Role, msgs[2].Role)
+	}
+
+	// A later summary folds in the earlier one.
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.AssistantMessage("It is sunny."), blades.UserMessage("Thanks")})
+	if len(runner.prompts) != 2 {
+		t.Fatalf("summarizer called %d times, want 2", len(runner.prompts))
+	}
+	if transcript := runner.prompts[1].Messages[1].Text(); !strings.HasPrefix(transcript, "earlier summary: The user asked about the weather.") {
+		t.Errorf("second transcript = %q", transcript)
+	}
+	msgs, _ = mem.ListMessages(ctx, "A")
+	if len(msgs) != 3 || !isSummary(msgs[0]) || msgs[2].Text() != "Thanks" {
+		t.Errorf("ListMessages() = %v", msgs)
+	}
+}
+
+func TestSummaryMemory_Tokens(t *testing.T) {
+	ctx := context.Background()
+	runner := &summarizer{}
+	mem := NewSummaryMemory(NewInMemory(0), runner,
+		SummarizeAfterMessages(0),
+		SummarizeAfterTokens(10),
+		WithTokenizer(blades.TokenizerFunc(func(*blades.Message) int { return 3 })),
+	)
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1"), blades.UserMessage("2"), blades.UserMessage("3")})
+	if len(runner.prompts) != 0 {
+		t.Fatalf("summarizer called under budget")
+	}
+	_ = mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("4")})
+	msgs, _ := mem.ListMessages(ctx, "A")
+	// The tail is limited to half of the budget, 5 tokens, which is one message.
+	if len(msgs) != 2 || !isSummary(msgs[0]) || msgs[1].Text() != "4" {
+		t.Errorf("ListMessages() = %v", msgs)
+	}
+}
+
+func TestSummaryMemory_Error(t *testing.T) {
+	ctx := context.Background()
+	runner := &summarizer{err: errors.New("unavailable")}
+	var reported []error
+	mem := NewSummaryMemory(NewInMemory(0), runner, SummarizeAfterMessages(1), KeepRecent(1),
+		WithSummaryErrorHandler(func(ctx context.Context, id string, err error) {
+			reported = append(reported, err)
+		}))
+	// The messages are stored, so a failed summarization does not fail AddMessages.
+	if err := mem.AddMessages(ctx, "A", []*blades.Message{blades.UserMessage("1"), blades.UserMessage("2")}); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	if len(reported) != 1 || reported[0] != runner.err {
+		t.Errorf("reported errors = %v, want the summarizer error", reported)
+	}
+	// The history is left untouched when summarization fails.
+	if msgs, _ := mem.ListMessages(ctx, "A"); len(msgs) != 2 {
+		t.Errorf("ListMessages() = %d messages, want 2", len(msgs))
+	}
+}
+
+// failingMemory is a blades.Memory that cannot replace messages, and whose failAt-th call
+// to AddMessages fails.
+type failingMemory struct {
+	memory blades.Memory
+	adds   int
+	failAt int
+}
+
+func (m *failingMemory) AddMessages(ctx context.Context, id string, msgs []*blades.Message) error {
+	m.adds++
+	if m.adds == m.failAt {
+		return errors.New("disk full")
+	}
+	return m.memory.AddMessages(ctx, id, msgs)
+}
+
+func (m *failingMemory) ListMessages(ctx context.Context, id string) ([]*blades.Message, error) {
+	return m.memory.ListMessages(ctx, id)
+}
+
+func (m *failingMemory) Clear(ctx context.Context, id string) error {
+	return m.memory.Clear(ctx, id)
+}
+
+func TestSummaryMemory_RestoreHistory(t *testing.T) {
+	ctx := context.Background()
+	// The second add stores the compacted conversation after the history was cleared.
+	store := &failingMemory{memory: NewInMemory(0), failAt: 2}
+	var reported error
+	mem := NewSummaryMemory(store, &summarizer{}, SummarizeAfterMessages(2), KeepRecent(1),
+		WithSummaryErrorHandler(func(ctx context.Context, id string, err error) {
+			reported = err
+		}))
+	history := []*blades.Message{blades.UserMessage("1"), blades.AssistantMessage("2"), blades.UserMessage("3")}
+	if err := mem.AddMessages(ctx, "A", history); err != nil {
+		t.Fatalf("AddMessages() error = %v", err)
+	}
+	if reported == nil {
+		t.Errorf("reported error = nil, want the memory error")
+	}
+	msgs, _ := mem.ListMessages(ctx, "A")
+	if len(msgs) != 3 || msgs[0].Text() != "1" || msgs[2].Text() != "3" {
+		t.Errorf("ListMessages() = %v, want the restored history", msgs)
+	}
+}
@@ -1,6 +1,7 @@
 package blades
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -52,14 +53,24 @@ type DataPart struct {
 	MimeType MimeType `json:"mimeType"`
 }
 
-// Part is a part of a message, which can be text or a file.
+// ReasoningPart is the reasoning a model produced before its answer.
+type ReasoningPart struct {
+	Text string `json:"text"`
+	// Signature is an opaque provider signature that must be sent back with the reasoning.
+	Signature string `json:"signature,omitempty"`
+	// Redacted is the encrypted reasoning returned by the provider in place of Text.
+	Redacted string `json:"redacted,omitempty"`
+}
+
+// Part is a part of a message, which can be text, reasoning or a file.
 type Part interface {
 	isPart()
 }
 
-func (TextPart) isPart() {}
-func (FilePart) isPart() {}
-func (DataPart) isPart() {}
+func (TextPart) isPart()      {}
+func (FilePart) isPart()      {}
+func (DataPart) isPart()      {}
+func (ReasoningPart) isPart() {}
 
 // ToolCall represents a call to an external tool.
 type ToolCall struct {
@@ -79,6 +90,101 @@ type Message struct {
 	Metadata  map[string]string `json:"metadata,omitempty"`
 }
 
+// partJSON is the JSON form of a Part, the type tag identifies the concrete part.
+type partJSON struct {
+	Type      string   `json:"type"`
+	Text      string   `json:"text,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	URI       string   `json:"uri,omitempty"`
+	Bytes     []byte   `json:"bytes,omitempty"`
+	MimeType  MimeType `json:"mimeType,omitempty"`
+	Signature string   `json:"signature,omitempty"`
+	Redacted  string   `json:"redacted,omitempty"`
+}
+
+// messageJSON mirrors Message with parts in their tagged JSON form.
+type messageJSON struct {
+	ID        string            `json:"id"`
+	Role      Role              `json:"role"`
+	Parts     []partJSON        `json:"parts"`
+	Status    Status            `json:"status"`
+	ToolCalls []*ToolCall       `json:"toolCalls,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// MarshalJSON encodes the message with a "type" tag on each part ("text", "reasoning", "file" or "data"),
+// so that the parts can be decoded back to their concrete types.
+func (m Message) MarshalJSON() ([]byte, error) {
+	out := messageJSON{
+		ID:        m.ID,
+		Role:      m.Role,
+		Parts:     make([]partJSON, 0, len(m.Parts)),
+		Status:    m.Status,
+		ToolCalls: m.ToolCalls,
+		Metadata:  m.Metadata,
+	}
+	for _, part := range m.Parts {
+		switch v := part.(type) {
+		case TextPart:
+			out.Parts = append(out.Parts, partJSON{Type: "text", Text: v.Text})
+		case ReasoningPart:
+			out.Parts = append(out.Parts, partJSON{Type: "reasoning", Text: v.Text, Signature: v.Signature, Redacted: v.Redacted})
+		case FilePart:
+			out.Parts = append(out.Parts, partJSON{Type: "file", Name: v.Name, URI: v.URI, MimeType: v.MimeType})
+		case DataPart:
+			out.Parts = append(out.Parts, partJSON{Type: "data", Name: v.Name, Bytes: v.Bytes, MimeType: v.MimeType})
+		default:
+			return nil, fmt.Errorf("blades: cannot marshal part of type %T", part)
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a message encoded by MarshalJSON. Parts without a type tag
+// are recognized by their fields: "uri" for files, "bytes" for data and text otherwise.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var in messageJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*m = Message{
+		ID:        in.ID,
+		Role:      in.Role,
+		Status:    in.Status,
+		ToolCalls: in.ToolCalls,
+		Metadata:  in.Metadata,
+	}
+	if in.Parts != nil {
+		m.Parts = make([]Part, 0, len(in.Parts))
+	}
+	for _, part := range in.Parts {
+		typ := part.Type
+		if typ == "" {
+			switch {
+			case part.URI != "":
+				typ = "file"
+			case part.Bytes != nil:
+				typ = "data"
+			default:
+				typ = "text"
+			}
+		}
+		switch typ {
+		case "text":
+			m.Parts = append(m.Parts, TextPart{Text: part.Text})
+		case "reasoning":
+			m.Parts = append(m.Parts, ReasoningPart{Text: part.Text, Signature: part.Signature, Redacted: part.Redacted})
+		case "file":
+			m.Parts = append(m.Parts, FilePart{Name: part.Name, URI: part.URI, MimeType: part.MimeType})
+		case "data":
+			m.Parts = append(m.Parts, DataPart{Name: part.Name, Bytes: part.Bytes, MimeType: part.MimeType})
+		default:
+			return fmt.Errorf("blades: unknown part type %q", part.Type)
+		}
+	}
+	return nil
+}
+
 // Text returns the first text part of the message, or an empty string if none exists.
 func (m *Message) Text() string {
 	for _, part := range m.Parts {
@@ -89,6 +195,17 @@ func (m *Message) Text() string {
 	return ""
 }
 
+// Reasoning returns the text of the reasoning parts of the message joined together.
+func (m *Message) Reasoning() string {
+	var buf strings.Builder
+	for _, part := range m.Parts {
+		if reasoning, ok := part.(ReasoningPart); ok {
+			buf.WriteString(reasoning.Text)
+		}
+	}
+	return buf.String()
+}
+
 // File returns the first file part of the message, or nil if none exists.
 func (m *Message) File() *FilePart {
 	for _, part := range m.Parts {
@@ -115,6 +232,8 @@ func (m *Message) String() string {
 		switch v := part.(type) {
 		case TextPart:
 			buf.WriteString("[Text: " + v.Text + ")]")
+		case ReasoningPart:
+			buf.WriteString("[Reasoning: " + v.Text + "]")
 		case FilePart:
 			buf.WriteString("[File: " + v.Name + " (" + string(v.MimeType) + ")]")
 		case DataPart:
@@ -126,7 +245,7 @@ func (m *Message) String() string {
 
 // contentPart is a type constraint for valid content inputs.
 type contentPart interface {
-	string | TextPart | FilePart | DataPart
+	string | TextPart | ReasoningPart | FilePart | DataPart
 }
 
 // UserMessage creates a user-authored message from parts.
@@ -154,6 +273,8 @@ func Parts[T contentPart](inputs ...T) []Part {
 			parts = append(parts, TextPart{v})
 		case TextPart:
 			parts = append(parts, v)
+		case ReasoningPart:
+			parts = append(parts, v)
 		case FilePart:
 			parts = append(parts, v)
 		case DataPart:
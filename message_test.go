@@ -0,0 +1,87 @@
+package blades
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMessageJSON(t *testing.T) {
+	prompt := NewConversation("conv_1",
+		SystemMessage("You are helpful."),
+		&Message{
+			ID:   "m1",
+			Role: RoleUser,
+			Parts: []Part{
+				TextPart{Text: "Compare these images"},
+				FilePart{Name: "cat.png", URI: "https://example.com/cat.png", MimeType: MimeImagePNG},
+				DataPart{Name: "dog.png", Bytes: []byte{0x89, 0x50}, MimeType: MimeImagePNG},
+			},
+			ToolCalls: []*ToolCall{{ID: "call_1", Name: "lookup", Arguments: `{}`, Result: "ok"}},
+			Metadata:  map[string]string{"source": "test"},
+		},
+	)
+	b, err := json.Marshal(prompt)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, tag := range []string{`"type":"text"`, `"type":"file"`, `"type":"data"`} {
+		if !strings.Contains(string(b), tag) {
+			t.Errorf("Marshal() = %s, want %s", b, tag)
+		}
+	}
+	var got Prompt
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.ConversationID != "conv_1" || len(got.Messages) != 2 {
+		t.Fatalf("Unmarshal() = %+v", got)
+	}
+	msg := got.Messages[1]
+	if msg.Text() != "Compare these images" || msg.File().URI != "https://example.com/cat.png" || !bytes.Equal(msg.Data().Bytes, []byte{0x89, 0x50}) {
+		t.Errorf("parts = %v", msg.Parts)
+	}
+	if msg.ToolCalls[0].Result != "ok" || msg.Metadata["source"] != "test" {
+		t.Errorf("message = %+v", msg)
+	}
+
+	reasoning := ReasoningPart{Text: "The user is done.", Signature: "sig"}
+	gen := &Generation{Messages: []*Message{{ID: "m2", Role: RoleAssistant, Parts: []Part{reasoning, TextPart{Text: "Done"}}}}}
+	b, err = json.Marshal(gen)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var gotGen Generation
+	if err := json.Unmarshal(b, &gotGen); err != nil || gotGen.Text() != "Done" {
+		t.Errorf("Generation round trip = %q, %v", gotGen.Text(), err)
+	}
+	if part, ok := gotGen.Messages[0].Parts[0].(ReasoningPart); !ok || part != reasoning {
+		t.Errorf("reasoning part = %+v, want %+v", gotGen.Messages[0].Parts[0], reasoning)
+	}
+}
+
+func TestMessageUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    Part
+		wantErr bool
+	}{
+		{name: "untagged text", data: `{"parts":[{"text":"hi"}]}`, want: TextPart{Text: "hi"}},
+		{name: "untagged file", data: `{"parts":[{"name":"a.pdf","uri":"file:///a.pdf","mimeType":"application/pdf"}]}`, want: FilePart{Name: "a.pdf", URI: "file:///a.pdf", MimeType: "application/pdf"}},
+		{name: "unknown type", data: `{"parts":[{"type":"video"}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg Message
+			err := json.Unmarshal([]byte(tt.data), &msg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && msg.Parts[0] != tt.want {
+				t.Errorf("Unmarshal() part = %#v, want %#v", msg.Parts[0], tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,9 @@ package blades
 
 import (
 	"context"
+	"encoding/json"
+
+	"github.com/google/jsonschema-go/jsonschema"
 )
 
 // ModelOption configures a single request. Providers may ignore options
@@ -15,8 +18,46 @@ type ModelOptions struct {
 	Temperature     float64
 	TopP            float64
 	ReasoningEffort string
-	Image           ImageOptions
-	Audio           AudioOptions
+	// ResponseFormat constrains the response text to JSON conforming to a schema.
+	ResponseFormat *ResponseFormat
+	Image          ImageOptions
+	Audio          AudioOptions
+	// Extensions holds provider-specific options keyed by names that each provider documents.
+	Extensions map[string]any
+}
+
+// ResponseFormat describes the JSON schema the response text must conform to. Providers with
+// native structured output enforce the schema, the others emulate it by adding Instructions as
+// a system message.
+type ResponseFormat struct {
+	// Name identifies the schema, it may only contain letters, digits, underscores and dashes.
+	Name   string
+	Schema *jsonschema.Schema
+}
+
+// Instructions returns a system prompt asking for a JSON response conforming to the schema.
+func (f *ResponseFormat) Instructions() (string, error) {
+	b, err := json.Marshal(f.Schema)
+	if err != nil {
+		return "", err
+	}
+	return "Your response should be in JSON format.\n" +
+		"Do not include any explanations, only provide a RFC8259 compliant JSON response following this format without deviation.\n" +
+		"Do not include markdown code blocks in your response.\n" +
+		"Here is the JSON Schema instance your output must adhere to:\n" + string(b), nil
+}
+
+// ResponseFormatSupporter is implemented by providers and runners that honor the
+// ResponseFormat of the model options, natively or by emulating it.
+type ResponseFormatSupporter interface {
+	SupportsResponseFormat() bool
+}
+
+// SupportsResponseFormat reports whether the provider or runner honors the ResponseFormat of
+// the model options. Those that do not implement ResponseFormatSupporter are assumed to ignore it.
+func SupportsResponseFormat(v any) bool {
+	s, ok := v.(ResponseFormatSupporter)
+	return ok && s.SupportsResponseFormat()
 }
 
 // ImageOptions holds configuration for image generation requests.
@@ -53,12 +94,18 @@ type ModelRequest struct {
 // ModelResponse is a single assistant message as a result of generation.
 type ModelResponse struct {
 	Messages []*Message `json:"message"`
+	// Usage is the token usage of the call when the provider reports it. Streaming providers
+	// report it on the last response of the stream.
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 // ModelProvider is an interface for multimodal chat-style models.
+// Providers translate a single model turn; requested tool calls are returned as
+// ToolCalls on the assistant message and executed by the Agent.
 type ModelProvider interface {
 	// Generate Generate executes the request and returns a single assistant response.
 	Generate(context.Context, *ModelRequest, ...ModelOption) (*ModelResponse, error)
 	// NewStream executes the request and returns a stream of assistant responses.
+	// The last response of the stream carries the completed assistant message.
 	NewStream(context.Context, *ModelRequest, ...ModelOption) (Streamer[*ModelResponse], error)
 }
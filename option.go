@@ -1,6 +1,8 @@
 package blades
 
-// MaxIterations sets the maximum number of iterations for the model.
+import "github.com/google/jsonschema-go/jsonschema"
+
+// MaxIterations sets the maximum number of model calls the Agent makes while executing tool calls.
 func MaxIterations(n int) ModelOption {
 	return func(o *ModelOptions) {
 		o.MaxIterations = n
@@ -35,6 +37,23 @@ func ReasoningEffort(effort string) ModelOption {
 	}
 }
 
+// ResponseSchema constrains the response text to JSON conforming to the named schema.
+func ResponseSchema(name string, schema *jsonschema.Schema) ModelOption {
+	return func(o *ModelOptions) {
+		o.ResponseFormat = &ResponseFormat{Name: name, Schema: schema}
+	}
+}
+
+// Extension sets a provider-specific option, providers ignore keys they do not support.
+func Extension(key string, value any) ModelOption {
+	return func(o *ModelOptions) {
+		if o.Extensions == nil {
+			o.Extensions = make(map[string]any)
+		}
+		o.Extensions[key] = value
+	}
+}
+
 // ImageBackground sets the image background preference.
 func ImageBackground(background string) ModelOption {
 	return func(o *ModelOptions) {
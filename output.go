@@ -3,64 +3,381 @@ package blades
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/google/jsonschema-go/jsonschema"
 )
 
+var (
+	// ErrInvalidOutput is matched by the OutputError returned when no answer conforms to the schema.
+	ErrInvalidOutput = errors.New("blades: output does not conform to the schema")
+)
+
+// defaultMaxRepairs is the number of repair attempts made after an invalid answer by default.
+const defaultMaxRepairs = 2
+
+// schemaNamePattern matches the schema names accepted by providers.
+var schemaNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// OutputAttempt is an answer rejected by an OutputConverter, with the reason it was rejected.
+type OutputAttempt struct {
+	Text string
+	Err  error
+}
+
+// OutputError is returned by an OutputConverter when no answer conforms to the schema, it
+// reports every attempt. It matches ErrInvalidOutput and the errors of the attempts.
+type OutputError struct {
+	Attempts []OutputAttempt
+}
+
+func (e *OutputError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s after %d attempts", ErrInvalidOutput, len(e.Attempts))
+	for i, attempt := range e.Attempts {
+		fmt.Fprintf(&b, "; attempt %d: %v", i+1, attempt.Err)
+	}
+	return b.String()
+}
+
+func (e *OutputError) Unwrap() []error {
+	errs := []error{ErrInvalidOutput}
+	for _, attempt := range e.Attempts {
+		errs = append(errs, attempt.Err)
+	}
+	return errs
+}
+
+// OutputOption configures an OutputConverter.
+type OutputOption func(*outputOptions)
+
+type outputOptions struct {
+	maxRepairs int
+}
+
+// WithMaxRepairs sets how many times an invalid answer is sent back to the runner with the
+// validation error to be repaired, zero disables repairs. Defaults to 2.
+func WithMaxRepairs(n int) OutputOption {
+	return func(o *outputOptions) {
+		o.maxRepairs = n
+	}
+}
+
 // OutputConverter is a wrapper around a Runnable runner that ensures the output conforms to a specified type T using JSON schema validation.
 type OutputConverter[T any] struct {
-	runner Runner
+	runner     Runner
+	maxRepairs int
 }
 
 // NewOutput creates a new Output instance that wraps the given Runnable runner.
-func NewOutputConverter[T any](runner Runner) *OutputConverter[T] {
-	return &OutputConverter[T]{runner: runner}
+func NewOutputConverter[T any](runner Runner, opts ...OutputOption) *OutputConverter[T] {
+	o := outputOptions{maxRepairs: defaultMaxRepairs}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &OutputConverter[T]{runner: runner, maxRepairs: o.maxRepairs}
+}
+
+// PartialOutput is a value of an answer streamed by an OutputConverter.
+type PartialOutput[T any] struct {
+	// Value holds the fields of the answer received so far.
+	Value T
+	// Complete is set on the last value of the stream, decoded from the whole answer once it
+	// has been validated against the schema.
+	Complete bool
 }
 
 // Run processes the given prompt using the wrapped runner and ensures the output conforms to type T.
+// The JSON schema of T is sent as the ResponseSchema of the request to runners that support it,
+// see SupportsResponseFormat, and as a system message prepended to the prompt otherwise. An answer that is not valid JSON or does not
+// validate against the schema is sent back with the error for the runner to repair, and an
+// OutputError reporting every attempt is returned when the repairs are exhausted. Repairs
+// continue the conversation of the prompt: a runner that keeps the conversation, see
+// KeepsConversation, is sent only the repair request, others the whole transcript.
 func (o *OutputConverter[T]) Run(ctx context.Context, prompt *Prompt, opts ...ModelOption) (T, error) {
 	var result T
-	schema, err := jsonschema.For[T](nil)
+	schema, err := outputSchema[T]()
 	if err != nil {
 		return result, err
 	}
-	// Convert the schema to JSON Schema format
-	b, err := schema.MarshalJSON()
+	p, opts, err := o.request(prompt, schema, opts)
 	if err != nil {
 		return result, err
 	}
-	buf := strings.Builder{}
-	buf.WriteString(`Your response should be in JSON format.
-				Do not include any explanations, only provide a RFC8259 compliant JSON response following this format without deviation.
-				Do not include markdown code blocks in your response.
-				Here is the JSON Schema instance your output must adhere to:
-				`)
-	buf.WriteString(string(b))
-	p := NewPrompt(SystemMessage(buf.String()))
-	p.Messages = append(p.Messages, prompt.Messages...)
-	res, err := o.runner.Run(ctx, p, opts...)
+	var attempts []OutputAttempt
+	for {
+		res, err := o.runner.Run(ctx, p, opts...)
+		if err != nil {
+			return result, err
+		}
+		text := res.Text()
+		result, err = decodeOutput[T](schema, text)
+		if err == nil {
+			return result, nil
+		}
+		attempts = append(attempts, OutputAttempt{Text: text, Err: err})
+		if len(attempts) > o.maxRepairs {
+			return result, &OutputError{Attempts: attempts}
+		}
+		p = o.repairPrompt(prompt, p, text, err)
+	}
+}
+
+// RunStream processes the given prompt like Run, streaming the answer of the wrapped runner.
+// The answer is decoded as it arrives, and a value is sent whenever more of its fields are
+// received: strings are filled in progressively, while numbers, booleans and keys are sent
+// once complete. The last value is the validated answer with Complete set. When an answer
+// is repaired, the values of the repair attempt start over.
+func (o *OutputConverter[T]) RunStream(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[*PartialOutput[T]], error) {
+	schema, err := outputSchema[T]()
+	if err != nil {
+		return nil, err
+	}
+	p, opts, err := o.request(prompt, schema, opts)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := o.runner.RunStream(ctx, p, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[*PartialOutput[T]]()
+	pipe.Go(func() error {
+		var attempts []OutputAttempt
+		for {
+			text, err := forwardPartials(stream, pipe.Send)
+			if err != nil {
+				return err
+			}
+			result, err := decodeOutput[T](schema, text)
+			if err == nil {
+				pipe.Send(&PartialOutput[T]{Value: result, Complete: true})
+				return nil
+			}
+			attempts = append(attempts, OutputAttempt{Text: text, Err: err})
+			if len(attempts) > o.maxRepairs {
+				return &OutputError{Attempts: attempts}
+			}
+			p = o.repairPrompt(prompt, p, text, err)
+			if stream, err = o.runner.RunStream(ctx, p, opts...); err != nil {
+				return err
+			}
+		}
+	})
+	return pipe, nil
+}
+
+// forwardPartials sends the values decoded from the text deltas of the stream, and returns
+// the text of the last completed assistant message.
+func forwardPartials[T any](stream Streamer[*Generation], send func(*PartialOutput[T])) (string, error) {
+	defer stream.Close()
+	var (
+		text   string
+		delta  strings.Builder
+		latest string
+	)
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			return "", err
+		}
+		for _, msg := range gen.Messages {
+			// A completed or tool message ends a model iteration, the next one answers anew.
+			if msg.Role != RoleAssistant || msg.Status == StatusCompleted {
+				if msg.Role == RoleAssistant {
+					text = msg.Text()
+				}
+				delta.Reset()
+				continue
+			}
+			delta.WriteString(msg.Text())
+			closed, ok := closeJSON(delta.String())
+			if !ok || closed == latest {
+				continue
+			}
+			var value T
+			if err := json.Unmarshal([]byte(closed), &value); err != nil {
+				continue
+			}
+			latest = closed
+			send(&PartialOutput[T]{Value: value})
+		}
+	}
+	return text, nil
+}
+
+// request asks the runner for JSON conforming to the schema, with the ResponseSchema option
+// when the runner supports it and with the schema instructions as a system message otherwise.
+func (o *OutputConverter[T]) request(prompt *Prompt, schema *jsonschema.Resolved, opts []ModelOption) (*Prompt, []ModelOption, error) {
+	format := &ResponseFormat{Name: schemaName[T](), Schema: schema.Schema()}
+	if SupportsResponseFormat(o.runner) {
+		p := &Prompt{ConversationID: prompt.ConversationID, Messages: prompt.Messages}
+		return p, append(slices.Clip(opts), ResponseSchema(format.Name, format.Schema)), nil
+	}
+	instructions, err := format.Instructions()
+	if err != nil {
+		return nil, nil, err
+	}
+	messages := append([]*Message{SystemMessage(instructions)}, prompt.Messages...)
+	return &Prompt{ConversationID: prompt.ConversationID, Messages: messages}, opts, nil
+}
+
+// outputSchema returns the resolved JSON schema of T.
+func outputSchema[T any]() (*jsonschema.Resolved, error) {
+	schema, err := jsonschema.For[T](nil)
 	if err != nil {
+		return nil, err
+	}
+	return schema.Resolve(nil)
+}
+
+// repairPrompt continues the conversation of the last attempt with the rejected answer and
+// a request to correct it. A runner keeping the conversation already stored the last attempt,
+// so it is sent only the request.
+func (o *OutputConverter[T]) repairPrompt(prompt, last *Prompt, text string, err error) *Prompt {
+	repair := UserMessage(fmt.Sprintf("Your response does not conform to the JSON schema: %v\nRespond again with only the corrected JSON.", err))
+	if KeepsConversation(o.runner) {
+		return &Prompt{ConversationID: prompt.ConversationID, Messages: []*Message{repair}}
+	}
+	messages := append(slices.Clone(last.Messages), AssistantMessage(text), repair)
+	return &Prompt{ConversationID: prompt.ConversationID, Messages: messages}
+}
+
+// decodeOutput validates the JSON of a response text against the schema and decodes it.
+func decodeOutput[T any](schema *jsonschema.Resolved, text string) (T, error) {
+	var result T
+	data := []byte(extractJSON(text))
+	var instance any
+	if err := json.Unmarshal(data, &instance); err != nil {
 		return result, err
 	}
-	text := res.Text()
-	text = strings.TrimSpace(text)
-	text = strings.Trim(text, "```json")
-	text = strings.Trim(text, "```")
-	if err := json.Unmarshal([]byte(text), &result); err != nil {
+	if err := schema.Validate(instance); err != nil {
+		return result, err
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
 		return result, err
 	}
 	return result, nil
 }
 
-// RunStream processes the given prompt using the wrapped runner and returns a Streamable that yields a single output of type T.
-func (o *OutputConverter[T]) RunStream(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[T], error) {
-	result, err := o.Run(ctx, prompt, opts...)
-	if err != nil {
-		return nil, err
+// schemaName returns the name of T when it is a valid schema name, and "response" otherwise.
+func schemaName[T any]() string {
+	if name := reflect.TypeFor[T]().Name(); schemaNamePattern.MatchString(name) {
+		return name
+	}
+	return "response"
+}
+
+// extractJSON returns the JSON of a response text, without the markdown code fence that
+// models emulating structured output sometimes wrap it in.
+func extractJSON(text string) string {
+	text = strings.TrimSpace(text)
+	body, ok := strings.CutPrefix(text, "```")
+	if !ok {
+		return text
+	}
+	// The opening fence may carry an info string such as json.
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(body), "```"))
+}
+
+// closeJSON completes the JSON of a partial response text so that it decodes to the values
+// received so far. The text is cut after its last complete value, or closed at the end of an
+// unterminated string value, and the objects and arrays left open are closed. Text before the
+// first object or array, such as an opening code fence, is skipped. It reports false when no
+// object or array has started.
+func closeJSON(text string) (string, bool) {
+	start := strings.IndexAny(text, "{[")
+	if start < 0 {
+		return "", false
+	}
+	var (
+		closers     []byte // closers of the open objects and arrays
+		keys        []bool // whether the next string of each open object is a key
+		safe        int    // end of the text that is valid once closed
+		safeClosers []byte
+		inString    bool
+		isKey       bool
+		escape      = -1 // start of the escape sequence being read in a string
+		literal     bool // whether a number, true, false or null is being read
+	)
+	mark := func(end int) {
+		safe = end
+		safeClosers = append(safeClosers[:0], closers...)
+	}
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			switch {
+			case escape >= 0:
+				// Escapes are two bytes long, or six for \uXXXX.
+				if i == escape+5 || (i == escape+1 && c != 'u') {
+					escape = -1
+				}
+			case c == '\\':
+				escape = i
+			case c == '"':
+				inString = false
+				if isKey {
+					keys[len(keys)-1] = false
+				} else {
+					mark(i + 1)
+				}
+			}
+			continue
+		}
+		if literal && strings.IndexByte(",:}] \t\r\n", c) >= 0 {
+			literal = false
+			mark(i)
+		}
+		switch c {
+		case '"':
+			inString = true
+			isKey = len(keys) > 0 && keys[len(keys)-1]
+		case '{', '[':
+			if c == '{' {
+				closers = append(closers, '}')
+			} else {
+				closers = append(closers, ']')
+			}
+			keys = append(keys, c == '{')
+			mark(i + 1)
+		case '}', ']':
+			closers, keys = closers[:len(closers)-1], keys[:len(keys)-1]
+			if len(closers) == 0 {
+				return text[start : i+1], true
+			}
+			mark(i + 1)
+		case ',':
+			if closers[len(closers)-1] == '}' {
+				keys[len(keys)-1] = true
+			}
+		case ':', ' ', '\t', '\r', '\n':
+		default:
+			literal = true
+		}
+	}
+	var b strings.Builder
+	if inString && !isKey {
+		end := len(text)
+		if escape >= 0 {
+			end = escape
+		}
+		b.WriteString(text[start:end])
+		b.WriteByte('"')
+		safeClosers = closers
+	} else {
+		b.WriteString(text[start:safe])
+	}
+	for i := len(safeClosers) - 1; i >= 0; i-- {
+		b.WriteByte(safeClosers[i])
 	}
-	stream := NewStreamPipe[T]()
-	stream.Send(result)
-	stream.Close()
-	return stream, nil
+	return b.String(), true
 }
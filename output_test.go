@@ -0,0 +1,250 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// formatProvider answers with its text and records each request with its response format.
+// It supports the response format when native is set.
+type formatProvider struct {
+	text     string
+	native   bool
+	requests []*ModelRequest
+	formats  []*ResponseFormat
+}
+
+func (p *formatProvider) SupportsResponseFormat() bool {
+	return p.native
+}
+
+func (p *formatProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	opt := ModelOptions{}
+	for _, apply := range opts {
+		apply(&opt)
+	}
+	p.requests = append(p.requests, req)
+	p.formats = append(p.formats, opt.ResponseFormat)
+	return textResponse(p.text), nil
+}
+
+func (p *formatProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	res, err := p.Generate(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Send(res)
+	pipe.Close()
+	return pipe, nil
+}
+
+type city struct {
+	Name    string `json:"name"`
+	Country string `json:"country"`
+}
+
+func TestOutputConverter(t *testing.T) {
+	provider := &formatProvider{text: `{"name":"Paris","country":"France"}`, native: true}
+	agent := NewAgent("extractor", WithProvider(provider))
+	got, err := NewOutputConverter[city](agent).Run(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != (city{Name: "Paris", Country: "France"}) {
+		t.Errorf("Run() = %+v", got)
+	}
+	format := provider.formats[0]
+	if format == nil || format.Name != "city" || format.Schema == nil || len(format.Schema.Required) != 2 {
+		t.Fatalf("response format = %+v, want the city schema", format)
+	}
+	if messages := provider.requests[0].Messages; len(messages) != 1 || messages[0].Role != RoleUser {
+		t.Errorf("request messages = %d, want only the prompt", len(messages))
+	}
+}
+
+func TestOutputConverterInstructions(t *testing.T) {
+	// The schema is sent as a system message to providers that ignore the response format.
+	provider := &formatProvider{text: `{"name":"Paris","country":"France"}`}
+	agent := NewAgent("extractor", WithProvider(provider))
+	got, err := NewOutputConverter[city](agent).Run(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != (city{Name: "Paris", Country: "France"}) {
+		t.Errorf("Run() = %+v", got)
+	}
+	if provider.formats[0] != nil {
+		t.Errorf("response format = %+v, want none", provider.formats[0])
+	}
+	messages := provider.requests[0].Messages
+	if len(messages) != 2 || messages[0].Role != RoleSystem || !strings.Contains(messages[0].Text(), `"country"`) {
+		t.Errorf("request messages = %d, want the schema instructions before the prompt", len(messages))
+	}
+}
+
+func TestOutputConverterRepair(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		textResponse(`{"name":"Paris",}`),
+		textResponse(`{"name":"Paris"}`),
+		textResponse("```json\n{\"name\":\"Paris\",\"country\":\"France\"}\n```"),
+	}}
+	agent := NewAgent("extractor", WithProvider(provider))
+	got, err := NewOutputConverter[city](agent).Run(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != (city{Name: "Paris", Country: "France"}) {
+		t.Errorf("Run() = %+v", got)
+	}
+	if len(provider.requests) != 3 {
+		t.Fatalf("provider received %d requests, want 3", len(provider.requests))
+	}
+	messages := provider.requests[2].Messages
+	if len(messages) != 6 || messages[4].Text() != `{"name":"Paris"}` || !strings.Contains(messages[5].Text(), "country") {
+		t.Errorf("repair request = %d messages, want the rejected answers and the missing property", len(messages))
+	}
+}
+
+func TestOutputConverterInvalid(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		textResponse("Paris, France"),
+		textResponse(`{"name":"Paris","country":"France","population":2102650}`),
+	}}
+	agent := NewAgent("extractor", WithProvider(provider))
+	_, err := NewOutputConverter[city](agent, WithMaxRepairs(1)).Run(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	var outputErr *OutputError
+	if !errors.Is(err, ErrInvalidOutput) || !errors.As(err, &outputErr) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrInvalidOutput)
+	}
+	if len(outputErr.Attempts) != 2 || outputErr.Attempts[0].Text != "Paris, France" || !strings.Contains(outputErr.Attempts[1].Err.Error(), "population") {
+		t.Errorf("attempts = %+v", outputErr.Attempts)
+	}
+	if !strings.Contains(err.Error(), "after 2 attempts; attempt 1:") {
+		t.Errorf("Run() error = %q, want every attempt reported", err)
+	}
+}
+
+func TestOutputConverterStream(t *testing.T) {
+	provider := &chunkProvider{words: []string{`{"name":"Pa`, `ris","coun`, `try":"Fra`, `nce"}`}}
+	agent := NewAgent("extractor", WithProvider(provider))
+	stream, err := NewOutputConverter[city](agent).RunStream(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	var got []PartialOutput[city]
+	for stream.Next() {
+		partial, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		got = append(got, *partial)
+	}
+	want := []PartialOutput[city]{
+		{Value: city{Name: "Pa"}},
+		{Value: city{Name: "Paris"}},
+		{Value: city{Name: "Paris", Country: "Fra"}},
+		{Value: city{Name: "Paris", Country: "France"}},
+		{Value: city{Name: "Paris", Country: "France"}, Complete: true},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("RunStream() = %+v, want %+v", got, want)
+	}
+}
+
+func TestOutputConverterStreamRepair(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{
+		textResponse(`{"name":"Paris"}`),
+		textResponse(`{"name":"Paris","country":"France"}`),
+	}}
+	agent := NewAgent("extractor", WithProvider(provider))
+	stream, err := NewOutputConverter[city](agent).RunStream(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	var got []PartialOutput[city]
+	for stream.Next() {
+		partial, err := stream.Current()
+		if err != nil {
+			t.Fatalf("Current() error = %v", err)
+		}
+		got = append(got, *partial)
+	}
+	if len(got) != 1 || got[0] != (PartialOutput[city]{Value: city{Name: "Paris", Country: "France"}, Complete: true}) {
+		t.Errorf("RunStream() = %+v, want the repaired answer", got)
+	}
+	if len(provider.requests) != 2 {
+		t.Errorf("provider received %d requests, want 2", len(provider.requests))
+	}
+}
+
+func TestOutputConverterStreamInvalid(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{textResponse("Paris, France")}}
+	agent := NewAgent("extractor", WithProvider(provider))
+	stream, err := NewOutputConverter[city](agent, WithMaxRepairs(0)).RunStream(context.Background(), NewPrompt(UserMessage("The capital of France.")))
+	if err != nil {
+		t.Fatalf("RunStream() error = %v", err)
+	}
+	for stream.Next() {
+		if _, err = stream.Current(); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrInvalidOutput) {
+		t.Errorf("Current() error = %v, want %v", err, ErrInvalidOutput)
+	}
+}
+
+func TestCloseJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+		ok   bool
+	}{
+		{text: "", ok: false},
+		{text: "```json\n", ok: false},
+		{text: "```json\n{", want: `{}`, ok: true},
+		{text: `{"na`, want: `{}`, ok: true},
+		{text: `{"name":`, want: `{}`, ok: true},
+		{text: `{"name":"Pa`, want: `{"name":"Pa"}`, ok: true},
+		{text: `{"name":"Paris",`, want: `{"name":"Paris"}`, ok: true},
+		{text: `{"name":"Pa\`, want: `{"name":"Pa"}`, ok: true},
+		{text: `{"name":"Pa\u00`, want: `{"name":"Pa"}`, ok: true},
+		{text: `{"name":"Pa\"r`, want: `{"name":"Pa\"r"}`, ok: true},
+		{text: `{"age":4`, want: `{}`, ok: true},
+		{text: `{"age":42,"ok":tr`, want: `{"age":42}`, ok: true},
+		{text: `{"age":42 `, want: `{"age":42}`, ok: true},
+		{text: `{"tags":["a","b`, want: `{"tags":["a","b"]}`, ok: true},
+		{text: `{"geo":{"lat":1.5,"lng":`, want: `{"geo":{"lat":1.5}}`, ok: true},
+		{text: `[{"name":"Paris"},{"na`, want: `[{"name":"Paris"},{}]`, ok: true},
+		{text: "{\"name\":\"Paris\"}\n```", want: `{"name":"Paris"}`, ok: true},
+	}
+	for _, tt := range tests {
+		got, ok := closeJSON(tt.text)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("closeJSON(%q) = %q, %v, want %q, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: `{"name":"json"}`, want: `{"name":"json"}`},
+		{text: `"json"`, want: `"json"`},
+		{text: `  ["son", "jo"]  `, want: `["son", "jo"]`},
+		{text: "```json\n{\"name\":\"Paris\"}\n```", want: `{"name":"Paris"}`},
+		{text: "```\n{\"name\":\"Paris\"}\n```\n", want: `{"name":"Paris"}`},
+		{text: "```{\"name\":\"Paris\"}```", want: `{"name":"Paris"}`},
+	}
+	for _, tt := range tests {
+		if got := extractJSON(tt.text); got != tt.want {
+			t.Errorf("extractJSON(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
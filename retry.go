@@ -0,0 +1,221 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryOption configures the retries of Retry and NewRetryProvider.
+type RetryOption func(*retrier)
+
+// WithMaxAttempts sets the maximum number of attempts, including the first one. Defaults to 3.
+func WithMaxAttempts(n int) RetryOption {
+	return func(r *retrier) {
+		r.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry, doubled on every following retry up to max.
+// An error whose Retry-After delay is longer than max is not retried. Defaults to 500ms and 30s.
+func WithBackoff(initial, max time.Duration) RetryOption {
+	return func(r *retrier) {
+		r.initial = initial
+		r.max = max
+	}
+}
+
+// WithJitter sets the fraction of each delay that is randomized, from 0 for a fixed delay to 1.
+// Defaults to 0.5, so that each delay is between half and all of the backoff.
+func WithJitter(fraction float64) RetryOption {
+	return func(r *retrier) {
+		r.jitter = fraction
+	}
+}
+
+// WithRetryIf sets the function that decides which errors are retried. Defaults to IsRetryable.
+func WithRetryIf(retryable func(error) bool) RetryOption {
+	return func(r *retrier) {
+		r.retryable = retryable
+	}
+}
+
+// retrier retries failed calls with exponential backoff.
+type retrier struct {
+	maxAttempts int
+	initial     time.Duration
+	max         time.Duration
+	jitter      float64
+	retryable   func(error) bool
+}
+
+func newRetrier(opts ...RetryOption) *retrier {
+	r := &retrier{
+		maxAttempts: 3,
+		initial:     500 * time.Millisecond,
+		max:         30 * time.Second,
+		jitter:      0.5,
+		retryable:   IsRetryable,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// delay returns the delay before retrying a failed attempt, numbered from zero. The delay
+// requested by the provider takes precedence over the backoff, and may exceed max.
+func (r *retrier) delay(attempt int, err error) time.Duration {
+	var modelErr *ModelError
+	if errors.As(err, &modelErr) && modelErr.RetryAfter > 0 {
+		return modelErr.RetryAfter
+	}
+	d := r.initial
+	for i := 0; i < attempt && d < r.max; i++ {
+		d *= 2
+	}
+	d = min(d, r.max)
+	if r.jitter > 0 {
+		d -= time.Duration(rand.Float64() * r.jitter * float64(d))
+	}
+	return d
+}
+
+// wait reports whether the error of the attempt is retried, after waiting for its delay.
+func (r *retrier) wait(ctx context.Context, attempt int, err error) bool {
+	if attempt+1 >= r.maxAttempts || ctx.Err() != nil || !r.retryable(err) {
+		return false
+	}
+	d := r.delay(attempt, err)
+	if d > r.max {
+		// The provider asks to wait longer than the caller is willing to.
+		return false
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// do calls fn until it succeeds or its error is not retried.
+func (r *retrier) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !r.wait(ctx, attempt, err) {
+			return err
+		}
+	}
+}
+
+// retryStream opens a stream, retrying while opening fails or the stream fails before yielding
+// its first value. Once a value is yielded, errors are returned to the consumer as they are,
+// since the values already consumed cannot be taken back.
+func retryStream[T any](ctx context.Context, r *retrier, open func() (Streamer[T], error)) (Streamer[T], error) {
+	attempt := 0
+	connect := func() (Streamer[T], error) {
+		for ; ; attempt++ {
+			stream, err := open()
+			if err == nil || !r.wait(ctx, attempt, err) {
+				return stream, err
+			}
+		}
+	}
+	stream, err := connect()
+	if err != nil {
+		return nil, err
+	}
+	pipe := NewStreamPipe[T]()
+	pipe.Go(func() error {
+		for {
+			sent, err := forwardStream(pipe, stream)
+			if err == nil || sent || !r.wait(ctx, attempt, err) {
+				return err
+			}
+			attempt++
+			if stream, err = connect(); err != nil {
+				return err
+			}
+		}
+	})
+	return pipe, nil
+}
+
+// forwardStream sends the values of the stream to the pipe, and reports whether any was sent.
+func forwardStream[T any](pipe *StreamPipe[T], stream Streamer[T]) (bool, error) {
+	defer stream.Close()
+	var sent bool
+	for stream.Next() {
+		v, err := stream.Current()
+		if err != nil {
+			return sent, err
+		}
+		pipe.Send(v)
+		sent = true
+	}
+	return sent, nil
+}
+
+// Retry returns a Middleware that retries failed model calls with exponential backoff and jitter,
+// honoring the delay requested by the provider. Streams are only retried until they yield their
+// first generation.
+func Retry(opts ...RetryOption) Middleware {
+	r := newRetrier(opts...)
+	return func(next Handler) Handler {
+		return Handler{
+			Run: func(ctx context.Context, prompt *Prompt, opts ...ModelOption) (*Generation, error) {
+				var gen *Generation
+				err := r.do(ctx, func() error {
+					var err error
+					gen, err = next.Run(ctx, prompt, opts...)
+					return err
+				})
+				return gen, err
+			},
+			Stream: func(ctx context.Context, prompt *Prompt, opts ...ModelOption) (Streamer[*Generation], error) {
+				return retryStream(ctx, r, func() (Streamer[*Generation], error) {
+					return next.Stream(ctx, prompt, opts...)
+				})
+			},
+		}
+	}
+}
+
+// retryProvider is a ModelProvider that retries the calls of another provider.
+type retryProvider struct {
+	provider ModelProvider
+	retrier  *retrier
+}
+
+// NewRetryProvider wraps a ModelProvider to retry failed calls in the same way as Retry, for
+// callers that use the provider directly.
+func NewRetryProvider(provider ModelProvider, opts ...RetryOption) ModelProvider {
+	return &retryProvider{provider: provider, retrier: newRetrier(opts...)}
+}
+
+// SupportsResponseFormat reports whether the wrapped provider honors the ResponseFormat.
+func (p *retryProvider) SupportsResponseFormat() bool {
+	return SupportsResponseFormat(p.provider)
+}
+
+// Generate calls the provider until it succeeds or its error is not retried.
+func (p *retryProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	var res *ModelResponse
+	err := p.retrier.do(ctx, func() error {
+		var err error
+		res, err = p.provider.Generate(ctx, req, opts...)
+		return err
+	})
+	return res, err
+}
+
+// NewStream opens a stream of the provider, retrying until it yields its first response.
+func (p *retryProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	return retryStream(ctx, p.retrier, func() (Streamer[*ModelResponse], error) {
+		return p.provider.NewStream(ctx, req, opts...)
+	})
+}
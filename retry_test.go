@@ -0,0 +1,220 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestNewModelError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		header     http.Header
+		message    string
+		want       error
+		retryAfter time.Duration
+	}{
+		{name: "rate limited", statusCode: 429, header: http.Header{"Retry-After": {"2"}}, message: "slow down", want: ErrRateLimited, retryAfter: 2 * time.Second},
+		{name: "retry after ms", statusCode: 429, header: http.Header{"Retry-After-Ms": {"150"}, "Retry-After": {"1"}}, message: "slow down", want: ErrRateLimited, retryAfter: 150 * time.Millisecond},
+		{name: "overloaded", statusCode: 529, message: "overloaded_error", want: ErrOverloaded},
+		{name: "server error", statusCode: 500, message: "internal error", want: ErrOverloaded},
+		{name: "authentication", statusCode: 401, message: "invalid api key", want: ErrAuthentication},
+		{name: "context length", statusCode: 400, message: "This model's maximum context length is 128000 tokens.", want: ErrContextWindowExceeded},
+		{name: "prompt too long", statusCode: 400, message: "prompt is too long: 210000 tokens > 200000 maximum", want: ErrContextWindowExceeded},
+		{name: "invalid request", statusCode: 400, message: "unknown parameter", want: ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cause := errors.New(tt.message)
+			err := NewModelError(tt.statusCode, tt.header, cause)
+			if !errors.Is(err, tt.want) || !errors.Is(err, cause) {
+				t.Fatalf("NewModelError() = %v, want %v wrapping %v", err, tt.want, cause)
+			}
+			var modelErr *ModelError
+			if !errors.As(err, &modelErr) || modelErr.StatusCode != tt.statusCode || modelErr.RetryAfter != tt.retryAfter {
+				t.Errorf("NewModelError() = %+v, want status %d retry after %v", modelErr, tt.statusCode, tt.retryAfter)
+			}
+		})
+	}
+	cause := errors.New("connection reset")
+	if err := NewModelError(0, nil, cause); err != cause {
+		t.Errorf("NewModelError(0) = %v, want the error unchanged", err)
+	}
+}
+
+// failingProvider fails the first calls with err before answering like the scripted provider.
+type failingProvider struct {
+	scriptedProvider
+	failures int
+	err      error
+	calls    int
+}
+
+func (p *failingProvider) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	if p.calls++; p.calls <= p.failures {
+		return nil, p.err
+	}
+	return p.scriptedProvider.Generate(ctx, req, opts...)
+}
+
+// NewStream fails the first streams before they yield a response.
+func (p *failingProvider) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	p.calls++
+	pipe := NewStreamPipe[*ModelResponse]()
+	if p.calls <= p.failures {
+		pipe.Go(func() error { return p.err })
+		return pipe, nil
+	}
+	res, err := p.scriptedProvider.next(req)
+	if err != nil {
+		return nil, err
+	}
+	pipe.Go(func() error {
+		pipe.Send(res)
+		return nil
+	})
+	return pipe, nil
+}
+
+func TestRetry(t *testing.T) {
+	rateLimited := &ModelError{Kind: ErrRateLimited, StatusCode: 429, Err: errors.New("slow down")}
+	invalid := &ModelError{Kind: ErrInvalidRequest, StatusCode: 400, Err: errors.New("bad request")}
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+		calls    int
+		want     error
+	}{
+		{name: "retried until success", failures: 2, err: rateLimited, calls: 3},
+		{name: "attempts exhausted", failures: 3, err: rateLimited, calls: 3, want: ErrRateLimited},
+		{name: "not retryable", failures: 1, err: invalid, calls: 1, want: ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		for _, stream := range []bool{false, true} {
+			provider := &failingProvider{
+				scriptedProvider: scriptedProvider{responses: []*ModelResponse{textResponse("Hello!")}},
+				failures:         tt.failures,
+				err:              tt.err,
+			}
+			agent := NewAgent("assistant",
+				WithProvider(provider),
+				WithMiddleware(Retry(WithMaxAttempts(3), WithBackoff(time.Millisecond, 5*time.Millisecond))),
+			)
+			var (
+				gen *Generation
+				err error
+			)
+			if stream {
+				gen, err = lastGeneration(agent.RunStream(context.Background(), NewPrompt(UserMessage("Hi"))))
+			} else {
+				gen, err = agent.Run(context.Background(), NewPrompt(UserMessage("Hi")))
+			}
+			if !errors.Is(err, tt.want) || (tt.want == nil && gen.Text() != "Hello!") {
+				t.Errorf("%s (stream %v): error = %v, want %v", tt.name, stream, err, tt.want)
+			}
+			if provider.calls != tt.calls {
+				t.Errorf("%s (stream %v): provider called %d times, want %d", tt.name, stream, provider.calls, tt.calls)
+			}
+		}
+	}
+}
+
+// lastGeneration drains the stream and returns its last generation or its error.
+func lastGeneration(stream Streamer[*Generation], err error) (*Generation, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var last *Generation
+	for stream.Next() {
+		gen, err := stream.Current()
+		if err != nil {
+			return nil, err
+		}
+		last = gen
+	}
+	return last, nil
+}
+
+// partialStream yields a response and then fails.
+type partialStream struct {
+	calls int
+	err   error
+}
+
+func (p *partialStream) Generate(ctx context.Context, req *ModelRequest, opts ...ModelOption) (*ModelResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *partialStream) NewStream(ctx context.Context, req *ModelRequest, opts ...ModelOption) (Streamer[*ModelResponse], error) {
+	p.calls++
+	pipe := NewStreamPipe[*ModelResponse]()
+	pipe.Go(func() error {
+		pipe.Send(&ModelResponse{Messages: []*Message{AssistantMessage("Hel")}})
+		return p.err
+	})
+	return pipe, nil
+}
+
+func TestRetryProviderStreamAfterFirstChunk(t *testing.T) {
+	inner := &partialStream{err: &ModelError{Kind: ErrOverloaded, StatusCode: 503, Err: errors.New("unavailable")}}
+	provider := NewRetryProvider(inner, WithBackoff(time.Millisecond, time.Millisecond))
+	stream, err := provider.NewStream(context.Background(), &ModelRequest{})
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	defer stream.Close()
+	var texts []string
+	for stream.Next() {
+		res, err := stream.Current()
+		if err != nil {
+			if !errors.Is(err, ErrOverloaded) {
+				t.Errorf("Current() error = %v, want %v", err, ErrOverloaded)
+			}
+			break
+		}
+		texts = append(texts, res.Messages[0].Text())
+	}
+	if inner.calls != 1 || len(texts) != 1 {
+		t.Errorf("stream opened %d times yielding %v, want a single attempt", inner.calls, texts)
+	}
+}
+
+func TestRetryAfterExceedsMax(t *testing.T) {
+	provider := &failingProvider{
+		scriptedProvider: scriptedProvider{responses: []*ModelResponse{textResponse("Hello!")}},
+		failures:         1,
+		err:              &ModelError{Kind: ErrRateLimited, StatusCode: 429, RetryAfter: time.Hour, Err: errors.New("slow down")},
+	}
+	start := time.Now()
+	_, err := NewRetryProvider(provider, WithBackoff(time.Millisecond, time.Second)).Generate(context.Background(), &ModelRequest{})
+	if !errors.Is(err, ErrRateLimited) || provider.calls != 1 {
+		t.Errorf("Generate() = %v after %d calls, want the rate limit error without retrying", err, provider.calls)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Generate() took %v, want no wait", elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	r := newRetrier(WithBackoff(100*time.Millisecond, time.Second), WithJitter(0))
+	for attempt, want := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := r.delay(attempt, errors.New("failed")); got != want {
+			t.Errorf("delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+	err := &ModelError{Kind: ErrRateLimited, RetryAfter: 700 * time.Millisecond, Err: errors.New("slow down")}
+	if got := r.delay(0, err); got != 700*time.Millisecond {
+		t.Errorf("delay() with Retry-After = %v, want 700ms", got)
+	}
+	jittered := newRetrier(WithBackoff(100*time.Millisecond, time.Second), WithJitter(0.5))
+	for i := 0; i < 10; i++ {
+		if got := jittered.delay(0, errors.New("failed")); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Errorf("jittered delay = %v, want between 50ms and 100ms", got)
+		}
+	}
+}
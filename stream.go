@@ -1,5 +1,7 @@
 package blades
 
+import "sync"
+
 // MappedStream maps the output of one Streamer to another type.
 type MappedStream[M any, T any] struct {
 	stream   Streamer[M]
@@ -32,47 +34,75 @@ func (ws *MappedStream[M, T]) Close() error {
 
 // StreamPipe directs the yielding of values.
 type StreamPipe[T any] struct {
-	err   error
-	queue chan T
-	next  T
+	mu      sync.Mutex
+	err     error
+	queue   chan T
+	done    chan struct{}
+	once    sync.Once
+	next    T
+	nextErr error
 }
 
 // NewStreamPipe creates a new StreamPipe director.
 func NewStreamPipe[T any]() *StreamPipe[T] {
 	return &StreamPipe[T]{
 		queue: make(chan T, 8),
+		done:  make(chan struct{}),
 	}
 }
 
+// Send yields a value to the consumer, it is dropped if the pipe has been closed.
 func (d *StreamPipe[T]) Send(v T) {
-	d.queue <- v
+	select {
+	case d.queue <- v:
+	case <-d.done:
+	}
 }
 
 // Next returns true if there is a value to yield.
 func (d *StreamPipe[T]) Next() bool {
-	v, ok := <-d.queue
-	if !ok {
-		return false
+	select {
+	case v := <-d.queue:
+		d.next = v
+		return true
+	case <-d.done:
+	}
+	// Drain the values sent before the pipe was closed.
+	select {
+	case v := <-d.queue:
+		d.next = v
+		return true
+	default:
+	}
+	// Yield the terminal error once, so that callers observe it from Current.
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil && d.nextErr == nil {
+		d.next = *new(T)
+		d.nextErr = d.err
+		return true
 	}
-	d.next = v
-	return true
+	return false
 }
 
 // Current returns the value and marks it as yielded.
 func (d *StreamPipe[T]) Current() (T, error) {
-	return d.next, d.err
+	return d.next, d.nextErr
 }
 
 // Go runs the provided function in a goroutine, closing the StreamPipe when done.
 func (d *StreamPipe[T]) Go(fn func() error) {
 	go func() {
 		defer d.Close()
-		d.err = fn()
+		err := fn()
+		d.mu.Lock()
+		d.err = err
+		d.mu.Unlock()
 	}()
 }
 
-// Close closes the StreamPipe.
+// Close closes the StreamPipe, it is safe to call more than once.
 func (d *StreamPipe[T]) Close() error {
-	close(d.queue)
+	d.once.Do(func() { close(d.done) })
 	return nil
 }
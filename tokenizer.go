@@ -0,0 +1,86 @@
+package blades
+
+import "errors"
+
+var (
+	// ErrContextWindowExceeded indicates the instructions, system messages and prompt do not fit
+	// the context window even after all droppable history was removed.
+	ErrContextWindowExceeded = errors.New("context window exceeded")
+)
+
+// Tokenizer counts the tokens a message occupies in the model context.
+type Tokenizer interface {
+	CountTokens(*Message) int
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface.
+type TokenizerFunc func(*Message) int
+
+// CountTokens calls f(m).
+func (f TokenizerFunc) CountTokens(m *Message) int {
+	return f(m)
+}
+
+// EstimateTokens approximates the tokens of a message at four characters per token,
+// plus a small per-message overhead. Text, reasoning and tool calls are counted, files and
+// inline data are not.
+func EstimateTokens(m *Message) int {
+	chars := 0
+	for _, part := range m.Parts {
+		switch v := part.(type) {
+		case TextPart:
+			chars += len(v.Text)
+		case ReasoningPart:
+			chars += len(v.Text)
+		}
+	}
+	for _, call := range m.ToolCalls {
+		chars += len(call.Name) + len(call.Arguments) + len(call.Result)
+	}
+	return chars/4 + 4
+}
+
+// fitHistory drops the oldest history so that the messages fit within budget tokens.
+// System messages are always kept, and an assistant message requesting tool calls is
+// dropped together with the tool messages that follow it.
+func fitHistory(tokenizer Tokenizer, budget int, required []*Message, history []*Message) ([]*Message, error) {
+	total := 0
+	for _, msg := range required {
+		total += tokenizer.CountTokens(msg)
+	}
+	// Split the droppable history into groups that are removed as a whole.
+	var groups [][]int
+	for i, msg := range history {
+		total += tokenizer.CountTokens(msg)
+		switch {
+		case msg.Role == RoleSystem:
+		case msg.Role == RoleTool && len(groups) > 0:
+			groups[len(groups)-1] = append(groups[len(groups)-1], i)
+		default:
+			groups = append(groups, []int{i})
+		}
+	}
+	dropped := make(map[int]bool)
+	for _, group := range groups {
+		if total <= budget {
+			break
+		}
+		for _, i := range group {
+			total -= tokenizer.CountTokens(history[i])
+			dropped[i] = true
+		}
+	}
+	if total > budget {
+		return nil, ErrContextWindowExceeded
+	}
+	if len(dropped) == 0 {
+		return history, nil
+	}
+	kept := make([]*Message, 0, len(history)-len(dropped))
+	for i, msg := range history {
+		if !dropped[i] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept, nil
+}
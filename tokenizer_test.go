@@ -0,0 +1,123 @@
+package blades
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fixedTokens counts every message as ten tokens.
+var fixedTokens = TokenizerFunc(func(*Message) int { return 10 })
+
+// historyMemory is a Memory returning a fixed history and recording the added messages.
+type historyMemory struct {
+	history []*Message
+	added   []*Message
+}
+
+func (m *historyMemory) AddMessages(ctx context.Context, id string, msgs []*Message) error {
+	m.added = append(m.added, msgs...)
+	return nil
+}
+
+func (m *historyMemory) ListMessages(ctx context.Context, id string) ([]*Message, error) {
+	return m.history, nil
+}
+
+func (m *historyMemory) Clear(ctx context.Context, id string) error {
+	return nil
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+		want int
+	}{
+		{name: "empty", msg: &Message{Role: RoleUser}, want: 4},
+		{name: "text", msg: UserMessage("What is the weather?"), want: 9},
+		{name: "reasoning", msg: &Message{Role: RoleAssistant, Parts: []Part{
+			ReasoningPart{Text: "The user wants the weather.", Signature: "sig"},
+			TextPart{Text: "Sunny."},
+		}}, want: 12},
+		{name: "tool call", msg: &Message{Role: RoleAssistant, ToolCalls: []*ToolCall{{Name: "get_weather", Arguments: `{"location":"Paris"}`}}}, want: 11},
+		{name: "file", msg: &Message{Role: RoleUser, Parts: []Part{DataPart{Bytes: make([]byte, 1000)}}}, want: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.msg); got != tt.want {
+				t.Errorf("EstimateTokens() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFitHistory(t *testing.T) {
+	history := []*Message{
+		{ID: "summary", Role: RoleSystem},
+		{ID: "user1", Role: RoleUser},
+		{ID: "call", Role: RoleAssistant, ToolCalls: []*ToolCall{{ID: "call_1", Name: "get_weather"}}},
+		{ID: "result", Role: RoleTool, ToolCalls: []*ToolCall{{ID: "call_1", Name: "get_weather", Result: "Sunny"}}},
+		{ID: "answer", Role: RoleAssistant},
+	}
+	required := []*Message{{ID: "instructions", Role: RoleSystem}, {ID: "prompt", Role: RoleUser}}
+	tests := []struct {
+		name    string
+		budget  int
+		want    []string
+		wantErr error
+	}{
+		{name: "fits", budget: 70, want: []string{"summary", "user1", "call", "result", "answer"}},
+		{name: "drop oldest", budget: 60, want: []string{"summary", "call", "result", "answer"}},
+		{name: "drop tool pair together", budget: 50, want: []string{"summary", "answer"}},
+		{name: "keep system messages", budget: 30, want: []string{"summary"}},
+		{name: "required too large", budget: 20, wantErr: ErrContextWindowExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fitHistory(fixedTokens, tt.budget, required, history)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("fitHistory() error = %v, want %v", err, tt.wantErr)
+			}
+			var ids []string
+			for _, msg := range got {
+				ids = append(ids, msg.ID)
+			}
+			if len(ids) != len(tt.want) {
+				t.Fatalf("fitHistory() = %v, want %v", ids, tt.want)
+			}
+			for i := range ids {
+				if ids[i] != tt.want[i] {
+					t.Errorf("fitHistory() = %v, want %v", ids, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestAgentContextWindow(t *testing.T) {
+	provider := &scriptedProvider{responses: []*ModelResponse{textResponse("Hi")}}
+	mem := &historyMemory{history: []*Message{
+		{ID: "old", Role: RoleUser},
+		{ID: "recent", Role: RoleAssistant},
+	}}
+	agent := NewAgent("assistant",
+		WithProvider(provider),
+		WithInstructions("Be brief."),
+		WithMemory(mem),
+		WithContextWindow(100),
+		WithTokenizer(fixedTokens),
+	)
+	// 100 tokens minus 70 for output leaves room for the instructions, one history message and the prompt.
+	if _, err := agent.Run(context.Background(), NewPrompt(UserMessage("Hello")), MaxOutputTokens(70)); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	msgs := provider.requests[0].Messages
+	if len(msgs) != 3 || msgs[1].ID != "recent" {
+		t.Errorf("request messages = %v, want instructions, recent, prompt", msgs)
+	}
+	if _, err := agent.Run(context.Background(), NewPrompt(UserMessage("Hello")), MaxOutputTokens(90)); !errors.Is(err, ErrContextWindowExceeded) {
+		t.Errorf("Run() error = %v, want ErrContextWindowExceeded", err)
+	}
+}
@@ -0,0 +1,83 @@
+package blades
+
+// Usage reports the tokens consumed by model calls and, when a pricing is set, their cost.
+// InputTokens and OutputTokens are totals: CachedInputTokens is the part of the input read
+// from the provider cache and ReasoningTokens the part of the output spent on reasoning.
+type Usage struct {
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	TotalTokens       int64   `json:"total_tokens"`
+	ReasoningTokens   int64   `json:"reasoning_tokens,omitempty"`
+	CachedInputTokens int64   `json:"cached_input_tokens,omitempty"`
+	Cost              float64 `json:"cost,omitempty"`
+}
+
+// Add adds the token counts and cost of other to the usage.
+func (u *Usage) Add(other *Usage) {
+	if other == nil {
+		return
+	}
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+	u.TotalTokens += other.TotalTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.CachedInputTokens += other.CachedInputTokens
+	u.Cost += other.Cost
+}
+
+// SumUsage returns the sum of the usages, or nil when none of them is set.
+func SumUsage(usages ...*Usage) *Usage {
+	var sum *Usage
+	for _, usage := range usages {
+		if usage == nil {
+			continue
+		}
+		if sum == nil {
+			sum = &Usage{}
+		}
+		sum.Add(usage)
+	}
+	return sum
+}
+
+// Pricing computes the cost of the tokens used by a single call to a model.
+type Pricing interface {
+	Cost(model string, usage *Usage) float64
+}
+
+// PricingFunc is an adapter to allow the use of ordinary functions as Pricing.
+type PricingFunc func(model string, usage *Usage) float64
+
+// Cost calls f(model, usage).
+func (f PricingFunc) Cost(model string, usage *Usage) float64 {
+	return f(model, usage)
+}
+
+// Price is the price of a model in currency units per million tokens.
+type Price struct {
+	Input float64
+	// CachedInput is the price of cached input tokens, Input is used when it is zero.
+	CachedInput float64
+	// Output is the price of output tokens, which include reasoning tokens.
+	Output float64
+}
+
+// PriceTable is a Pricing that looks up the price of each model by name,
+// models missing from the table cost nothing.
+type PriceTable map[string]Price
+
+// Cost returns the cost of the usage at the price of the model.
+func (t PriceTable) Cost(model string, usage *Usage) float64 {
+	price, ok := t[model]
+	if !ok || usage == nil {
+		return 0
+	}
+	cachedPrice := price.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = price.Input
+	}
+	input := float64(usage.InputTokens-usage.CachedInputTokens) * price.Input
+	cached := float64(usage.CachedInputTokens) * cachedPrice
+	output := float64(usage.OutputTokens) * price.Output
+	return (input + cached + output) / 1e6
+}
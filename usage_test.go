@@ -0,0 +1,46 @@
+package blades
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSumUsage(t *testing.T) {
+	if got := SumUsage(nil, nil); got != nil {
+		t.Errorf("SumUsage(nil, nil) = %+v, want nil", got)
+	}
+	got := SumUsage(
+		&Usage{InputTokens: 10, OutputTokens: 5, TotalTokens: 15, CachedInputTokens: 4, Cost: 0.5},
+		nil,
+		&Usage{InputTokens: 20, OutputTokens: 8, TotalTokens: 28, ReasoningTokens: 3, Cost: 0.25},
+	)
+	want := Usage{InputTokens: 30, OutputTokens: 13, TotalTokens: 43, ReasoningTokens: 3, CachedInputTokens: 4, Cost: 0.75}
+	if got == nil || *got != want {
+		t.Errorf("SumUsage() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPriceTableCost(t *testing.T) {
+	table := PriceTable{
+		"gpt-4o":      {Input: 2.5, CachedInput: 1.25, Output: 10},
+		"gpt-4o-mini": {Input: 0.15, Output: 0.6},
+	}
+	tests := []struct {
+		name  string
+		model string
+		usage *Usage
+		want  float64
+	}{
+		{name: "cached input", model: "gpt-4o", usage: &Usage{InputTokens: 1000000, CachedInputTokens: 400000, OutputTokens: 100000}, want: 1.5 + 0.5 + 1},
+		{name: "cached at input price", model: "gpt-4o-mini", usage: &Usage{InputTokens: 2000000, CachedInputTokens: 1000000, OutputTokens: 1000000}, want: 0.3 + 0.6},
+		{name: "unknown model", model: "unknown", usage: &Usage{InputTokens: 1000}, want: 0},
+		{name: "nil usage", model: "gpt-4o", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := table.Cost(tt.model, tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}